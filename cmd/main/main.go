@@ -4,18 +4,23 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/supchaser/test_task/internal/app"
 	"github.com/supchaser/test_task/internal/app/delivery"
 	"github.com/supchaser/test_task/internal/app/repository"
 	"github.com/supchaser/test_task/internal/app/usecase"
 	"github.com/supchaser/test_task/internal/config"
+	"github.com/supchaser/test_task/internal/fetcher"
 	"github.com/supchaser/test_task/internal/middleware"
+	"github.com/supchaser/test_task/internal/storage"
 	"github.com/supchaser/test_task/internal/utils/logger"
+	"github.com/supchaser/test_task/internal/utils/retry"
 	"go.uber.org/zap"
 )
 
@@ -39,33 +44,140 @@ func main() {
 		zap.Int("max_tasks", cfg.MaxActiveTasks),
 	)
 
-	if err := os.MkdirAll("./storage", 0755); err != nil {
+	if err := os.MkdirAll(cfg.StorageDir, 0755); err != nil {
 		logger.Error("failed to create storage directory", zap.Error(err))
 		os.Exit(1)
 	}
 
-	taskRepo := repository.CreateTaskRepository(cfg.MaxActiveTasks)
-	taskUsecase := usecase.CreateTaskUsecase(taskRepo, "")
+	archiveStore, err := newArchiveStore(cfg)
+	if err != nil {
+		logger.Error("failed to create archive store", zap.Error(err))
+		os.Exit(1)
+	}
+
+	outbound, err := fetcher.New(fetcher.Config{
+		ConnectTimeout:        cfg.FetchConnectTimeout,
+		TLSHandshakeTimeout:   cfg.FetchTLSHandshakeTimeout,
+		ResponseHeaderTimeout: cfg.FetchResponseHeaderTimeout,
+		TotalTimeout:          cfg.FetchTotalTimeout,
+		MaxRedirects:          cfg.FetchMaxRedirects,
+		UserAgent:             cfg.FetchUserAgent,
+		ProxyURL:              cfg.FetchProxyURL,
+		MaxIdleConns:          cfg.FetchMaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.FetchMaxIdleConnsPerHost,
+		MaxConnsPerHost:       cfg.FetchMaxConnsPerHost,
+		IdleConnTimeout:       90 * time.Second,
+		Guard: &fetcher.Guard{
+			AllowPrivate:   cfg.FetchAllowPrivate,
+			AllowedSchemes: cfg.FetchAllowedSchemes,
+			AllowedHosts:   cfg.FetchAllowedHosts,
+			DeniedHosts:    cfg.FetchDeniedHosts,
+			AllowedPorts:   cfg.FetchAllowedPorts,
+			DeniedPorts:    cfg.FetchDeniedPorts,
+		},
+	})
+	if err != nil {
+		logger.Error("failed to create http fetcher", zap.Error(err))
+		os.Exit(1)
+	}
+	defer outbound.CloseIdleConnections()
+
+	retryPolicy := retry.Policy{
+		MaxAttempts: cfg.RetryMaxAttempts,
+		BaseBackoff: cfg.RetryBaseBackoff,
+		MaxBackoff:  cfg.RetryMaxBackoff,
+		Jitter:      cfg.RetryJitter,
+	}
+
+	repoOpts := []repository.Option{
+		repository.WithQueueSize(cfg.MaxQueuedTasks),
+		repository.WithMaxObjects(cfg.MaxObjectsPerTask),
+		repository.WithRetryPolicy(retryPolicy),
+		repository.WithFetcher(outbound),
+		repository.WithFilePolicy(cfg.FilePolicy),
+		repository.WithSizeLimits(cfg.MaxObjectSize, cfg.MaxArchiveSize),
+	}
+
+	var taskRepo *repository.TaskRepository
+	if cfg.DataDir != "" {
+		taskRepo, err = repository.CreatePersistentTaskRepository(cfg.MaxActiveTasks, cfg.DataDir, repoOpts...)
+		if err != nil {
+			logger.Error("failed to restore tasks", zap.Error(err))
+			os.Exit(1)
+		}
+	} else {
+		logger.Warn("DATA_DIR is not set, tasks will be kept in memory only")
+		taskRepo = repository.CreateTaskRepository(cfg.MaxActiveTasks, repoOpts...)
+	}
+	defer func() {
+		if err := taskRepo.Close(); err != nil {
+			logger.Error("failed to close task repository", zap.Error(err))
+		}
+	}()
+
+	taskUsecase := usecase.CreateTaskUsecase(taskRepo, cfg.StorageDir,
+		usecase.WithArchiveStore(archiveStore),
+		usecase.WithAutoFinalize(cfg.AutoFinalizeObjects),
+		usecase.WithIdleTTL(cfg.IdleTaskTTL),
+		usecase.WithRetention(cfg.TaskRetention),
+		usecase.WithDownloadLimits(cfg.MaxDownloads, cfg.MaxDownloadsPerHost),
+		usecase.WithRetryPolicy(retryPolicy),
+		usecase.WithFetcher(outbound),
+		usecase.WithFilePolicy(cfg.FilePolicy),
+		usecase.WithSizeLimits(cfg.MaxObjectSize, cfg.MaxArchiveSize),
+		usecase.WithReport(cfg.ArchiveReport),
+		usecase.WithCompression(cfg.Compression, cfg.CompressionLevel),
+		usecase.WithJobTimeout(cfg.JobTimeout),
+	)
 	taskDelivery := delivery.CreateTaskDelivery(taskUsecase)
+	taskRepo.SetPromoteHandler(taskUsecase.HandlePromotedTask)
+
+	if err := taskUsecase.CleanupTempFiles(); err != nil {
+		logger.Error("failed to clean up temp files", zap.Error(err))
+	}
+
+	if err := taskUsecase.ResumeTasks(context.Background()); err != nil {
+		logger.Error("failed to resume tasks", zap.Error(err))
+	}
+
+	reaperCtx, stopReaper := context.WithCancel(context.Background())
+	defer stopReaper()
+	go taskUsecase.RunReaper(reaperCtx, cfg.ReaperInterval)
 
 	router := mux.NewRouter()
 
 	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		// take the instance out of rotation while it drains
+		if taskUsecase.Draining() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("DRAINING"))
+			return
+		}
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("OK"))
 	}).Methods("GET")
 
 	apiRouter := router.PathPrefix("/api/v1").Subrouter()
+	apiRouter.HandleFunc("/policy", taskDelivery.GetPolicy).Methods("GET")
+	apiRouter.HandleFunc("/archive:stream", taskDelivery.StreamArchive).Methods("POST")
 	taskRouter := apiRouter.PathPrefix("/tasks").Subrouter()
+
 	taskRouter.HandleFunc("", taskDelivery.CreateTask).Methods("POST")
 	taskRouter.HandleFunc("", taskDelivery.GetAllTasks).Methods("GET")
+	taskRouter.HandleFunc("", taskDelivery.PurgeTasks).Methods("DELETE")
 	taskRouter.HandleFunc("/{id:[0-9]+}", taskDelivery.GetTask).Methods("GET")
+	taskRouter.HandleFunc("/{id:[0-9]+}", taskDelivery.DeleteTask).Methods("DELETE")
 	taskRouter.HandleFunc("/{id:[0-9]+}/objects", taskDelivery.AddObjects).Methods("POST")
+	taskRouter.HandleFunc("/{id:[0-9]+}/finalize", taskDelivery.FinalizeTask).Methods("POST")
+	taskRouter.HandleFunc("/{id:[0-9]+}/cancel", taskDelivery.CancelTask).Methods("POST")
+	taskRouter.HandleFunc("/{id:[0-9]+}/retry", taskDelivery.RetryTask).Methods("POST")
 	taskRouter.HandleFunc("/{id:[0-9]+}/archive", taskDelivery.DownloadArchive).Methods("GET")
 	taskRouter.HandleFunc("/{id:[0-9]+}/status", taskDelivery.GetTaskStatus).Methods("GET")
 
+	router.Use(middleware.RequestIDMiddleware)
 	router.Use(middleware.LoggingMiddleware)
 	router.Use(middleware.PanicMiddleware)
+	router.Use(middleware.DrainMiddleware(taskUsecase.Draining, cfg.DrainTimeout))
 
 	addr := fmt.Sprintf(":%s", cfg.ServerPort)
 	server := &http.Server{
@@ -79,6 +191,7 @@ func main() {
 		logger.Info("starting HTTP server",
 			zap.String("address", server.Addr),
 			zap.Any("config", cfg),
+			zap.String("fetch_proxy", redactURL(cfg.FetchProxyURL)),
 		)
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			logger.Error("server error", zap.Error(err))
@@ -98,6 +211,15 @@ func main() {
 			zap.String("signal", sig.String()),
 		)
 
+		// the server keeps answering while archive jobs drain: new work is
+		// refused with 503, status and downloads are still served
+		drainCtx, cancelDrain := context.WithTimeout(context.Background(), cfg.DrainTimeout)
+		defer cancelDrain()
+		if err := taskUsecase.Shutdown(drainCtx); err != nil {
+			logger.Warn("archive jobs did not finish in time", zap.Error(err))
+		}
+		stopReaper()
+
 		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 		defer cancel()
 
@@ -109,3 +231,29 @@ func main() {
 		logger.Info("server stopped")
 	}
 }
+
+// newArchiveStore returns the configured backend for finished archives.
+func newArchiveStore(cfg *config.Config) (app.ArchiveStore, error) {
+	if cfg.StorageBackend == config.StorageS3 {
+		return storage.NewS3(storage.S3Config{
+			Endpoint:  cfg.S3Endpoint,
+			Region:    cfg.S3Region,
+			Bucket:    cfg.S3Bucket,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+		})
+	}
+	return storage.NewLocal(cfg.StorageDir), nil
+}
+
+// redactURL hides the password of a configured URL so it can be logged.
+func redactURL(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "<invalid>"
+	}
+	return u.Redacted()
+}
@@ -1,11 +1,12 @@
 module github.com/supchaser/test_task
 
-go 1.24.2
+go 1.25
 
 require (
 	github.com/golang/mock v1.6.0
 	github.com/gorilla/mux v1.8.1
 	github.com/joho/godotenv v1.5.1
+	github.com/klauspost/compress v1.20.1
 	github.com/stretchr/testify v1.10.0
 	go.uber.org/zap v1.27.0
 )
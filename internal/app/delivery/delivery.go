@@ -5,15 +5,18 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"math"
 	"net/http"
-	"os"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/supchaser/test_task/internal/app"
 	"github.com/supchaser/test_task/internal/app/models"
+	"github.com/supchaser/test_task/internal/archive"
 	"github.com/supchaser/test_task/internal/utils/errs"
 	"github.com/supchaser/test_task/internal/utils/logger"
 	"github.com/supchaser/test_task/internal/utils/responses"
@@ -35,14 +38,24 @@ func (d *TaskDelivery) CreateTask(w http.ResponseWriter, r *http.Request) {
 	const funcName = "TaskDelivery.CreateTask"
 	logger.Debug("creating new task", zap.String("function", funcName))
 
-	task, err := d.taskUsecase.CreateTask(r.Context())
+	opts := models.TaskOptions{}
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil && !errors.Is(err, io.EOF) {
+		responses.DoBadResponseAndLog(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	task, err := d.taskUsecase.CreateTask(r.Context(), opts)
 	if err != nil {
 		if errors.Is(err, errs.ErrMaxTasksReached) {
+			retryAfter := int(math.Ceil(d.taskUsecase.EstimateRetryAfter().Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
 			responses.DoJSONResponse(w, map[string]any{
-				"error":      err.Error(),
-				"max_tasks":  d.taskUsecase.GetMaxTasks(),
-				"active_now": d.taskUsecase.GetActiveTasksCount(),
-				"suggestion": "Try again later or wait for current tasks to complete",
+				"error":       err.Error(),
+				"max_tasks":   d.taskUsecase.GetMaxTasks(),
+				"active_now":  d.taskUsecase.GetActiveTasksCount(),
+				"queued_now":  d.taskUsecase.GetQueuedTasksCount(),
+				"retry_after": retryAfter,
+				"suggestion":  "Try again later or wait for current tasks to complete",
 			}, http.StatusTooManyRequests)
 			return
 		}
@@ -95,8 +108,9 @@ func (d *TaskDelivery) AddObjects(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if len(req.URLs) > 3 {
-		responses.DoBadResponseAndLog(w, http.StatusBadRequest, "maximum 3 urls per request")
+	maxObjects := d.taskUsecase.GetMaxObjectsPerTask()
+	if len(req.URLs) > maxObjects {
+		responses.DoBadResponseAndLog(w, http.StatusBadRequest, fmt.Sprintf("maximum %d urls per request", maxObjects))
 		return
 	}
 
@@ -119,7 +133,7 @@ func (d *TaskDelivery) AddObjects(w http.ResponseWriter, r *http.Request) {
 			default:
 			}
 
-			_, err := d.taskUsecase.AddObject(ctx, taskID, url)
+			_, err := d.taskUsecase.AddObject(ctx, taskID, url, req.Names[url])
 
 			mu.Lock()
 			defer mu.Unlock()
@@ -153,6 +167,169 @@ func (d *TaskDelivery) AddObjects(w http.ResponseWriter, r *http.Request) {
 	responses.DoJSONResponse(w, result, http.StatusOK)
 }
 
+func (d *TaskDelivery) FinalizeTask(w http.ResponseWriter, r *http.Request) {
+	const funcName = "TaskDelivery.FinalizeTask"
+	logger.Debug("finalizing task",
+		zap.String("function", funcName),
+	)
+
+	vars := mux.Vars(r)
+	taskID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		responses.DoBadResponseAndLog(w, http.StatusBadRequest, "invalid task id")
+		return
+	}
+
+	req := models.FinalizeRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		responses.DoBadResponseAndLog(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	task, err := d.taskUsecase.FinalizeTask(r.Context(), taskID, req.Password)
+	if err != nil {
+		responses.ResponseErrorAndLog(w, err, funcName)
+		return
+	}
+
+	responses.DoJSONResponse(w, task, http.StatusAccepted)
+}
+
+func (d *TaskDelivery) CancelTask(w http.ResponseWriter, r *http.Request) {
+	const funcName = "TaskDelivery.CancelTask"
+	logger.Debug("cancelling task",
+		zap.String("function", funcName),
+	)
+
+	vars := mux.Vars(r)
+	taskID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		responses.DoBadResponseAndLog(w, http.StatusBadRequest, "invalid task id")
+		return
+	}
+
+	task, err := d.taskUsecase.CancelTask(r.Context(), taskID)
+	if err != nil {
+		responses.ResponseErrorAndLog(w, err, funcName)
+		return
+	}
+
+	responses.DoJSONResponse(w, task, http.StatusOK)
+}
+
+// RetryTask builds a new archive version of a done or failed task. The body
+// is optional; {"all": true} downloads every object again.
+func (d *TaskDelivery) RetryTask(w http.ResponseWriter, r *http.Request) {
+	const funcName = "TaskDelivery.RetryTask"
+	logger.Debug("retrying task",
+		zap.String("function", funcName),
+	)
+
+	vars := mux.Vars(r)
+	taskID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		responses.DoBadResponseAndLog(w, http.StatusBadRequest, "invalid task id")
+		return
+	}
+
+	req := models.RetryRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		responses.DoBadResponseAndLog(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	task, err := d.taskUsecase.RetryTask(r.Context(), taskID, req.All)
+	if err != nil {
+		if errors.Is(err, errs.ErrMaxTasksReached) {
+			retryAfter := int(math.Ceil(d.taskUsecase.EstimateRetryAfter().Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		}
+		responses.ResponseErrorAndLog(w, err, funcName)
+		return
+	}
+
+	responses.DoJSONResponse(w, task, http.StatusAccepted)
+}
+
+// DeleteTask removes a finished task and its archive. A task that is still
+// active is cancelled instead, as CancelTask does; deleting it once more
+// removes it.
+func (d *TaskDelivery) DeleteTask(w http.ResponseWriter, r *http.Request) {
+	const funcName = "TaskDelivery.DeleteTask"
+	logger.Debug("deleting task",
+		zap.String("function", funcName),
+	)
+
+	vars := mux.Vars(r)
+	taskID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		responses.DoBadResponseAndLog(w, http.StatusBadRequest, "invalid task id")
+		return
+	}
+
+	task, err := d.taskUsecase.GetTask(r.Context(), taskID)
+	if err != nil {
+		responses.ResponseErrorAndLog(w, err, funcName)
+		return
+	}
+
+	if !task.Status.IsFinished() {
+		task, err = d.taskUsecase.CancelTask(r.Context(), taskID)
+		if err != nil {
+			responses.ResponseErrorAndLog(w, err, funcName)
+			return
+		}
+		responses.DoJSONResponse(w, task, http.StatusOK)
+		return
+	}
+
+	if err := d.taskUsecase.DeleteTask(r.Context(), taskID); err != nil {
+		responses.ResponseErrorAndLog(w, err, funcName)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PurgeTasks deletes finished tasks in bulk. The status query parameter,
+// repeated or comma-separated, limits the statuses; older_than takes a
+// duration such as 24h and keeps tasks that finished more recently.
+func (d *TaskDelivery) PurgeTasks(w http.ResponseWriter, r *http.Request) {
+	const funcName = "TaskDelivery.PurgeTasks"
+	logger.Debug("purging tasks",
+		zap.String("function", funcName),
+	)
+
+	query := r.URL.Query()
+	filter := models.PurgeFilter{}
+	for _, value := range query["status"] {
+		for _, status := range strings.Split(value, ",") {
+			if status = strings.TrimSpace(status); status != "" {
+				filter.Statuses = append(filter.Statuses, models.TaskStatus(status))
+			}
+		}
+	}
+	if value := query.Get("older_than"); value != "" {
+		olderThan, err := time.ParseDuration(value)
+		if err != nil || olderThan < 0 {
+			responses.DoBadResponseAndLog(w, http.StatusBadRequest, "invalid older_than")
+			return
+		}
+		filter.FinishedBefore = time.Now().Add(-olderThan)
+	}
+
+	ids, err := d.taskUsecase.PurgeTasks(r.Context(), filter)
+	if err != nil {
+		responses.ResponseErrorAndLog(w, err, funcName)
+		return
+	}
+
+	responses.DoJSONResponse(w, map[string]any{
+		"deleted":  len(ids),
+		"task_ids": ids,
+	}, http.StatusOK)
+}
+
 func (d *TaskDelivery) GetTaskStatus(w http.ResponseWriter, r *http.Request) {
 	const funcName = "TaskDelivery.GetTaskStatus"
 	logger.Debug("getting task status",
@@ -174,17 +351,29 @@ func (d *TaskDelivery) GetTaskStatus(w http.ResponseWriter, r *http.Request) {
 	}
 
 	response := struct {
-		Status models.TaskStatus `json:"status"`
-		ZipURL string            `json:"zip_url,omitempty"`
-		Errors []string          `json:"errors,omitempty"`
+		Status           models.TaskStatus `json:"status"`
+		ZipURL           string            `json:"zip_url,omitempty"`
+		Errors           []string          `json:"errors,omitempty"`
+		MissingURLs      []string          `json:"missing_urls,omitempty"`
+		QueuePosition    int               `json:"queue_position,omitempty"`
+		EstimatedStartAt *time.Time        `json:"estimated_start_at,omitempty"`
 	}{
-		Status: task.Status,
+		Status:           task.Status,
+		QueuePosition:    task.QueuePosition,
+		EstimatedStartAt: task.EstimatedStartAt,
 	}
 
-	if task.Status == models.StatusDone {
+	if task.Status == models.StatusDone && (task.Stats == nil || !task.Stats.Streamed) {
 		response.ZipURL = "/download/" + strconv.FormatInt(taskID, 10)
 	}
 
+	for _, obj := range task.Objects {
+		if obj.State == models.ObjectFailed {
+			response.Errors = append(response.Errors, fmt.Sprintf("%s: %s", obj.URL, obj.Error))
+			response.MissingURLs = append(response.MissingURLs, obj.URL)
+		}
+	}
+
 	responses.DoJSONResponse(w, response, http.StatusOK)
 }
 
@@ -206,48 +395,123 @@ func (d *TaskDelivery) DownloadArchive(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	task, err := d.taskUsecase.GetTask(r.Context(), taskID)
+	if stream, _ := strconv.ParseBool(r.URL.Query().Get("stream")); stream {
+		d.streamTask(w, r, taskID)
+		return
+	}
+
+	// an earlier version of a retried task is asked for by number
+	version := 0
+	if value := r.URL.Query().Get("version"); value != "" {
+		version, err = strconv.Atoi(value)
+		if err != nil || version < 1 {
+			responses.DoBadResponseAndLog(w, http.StatusBadRequest, "invalid version")
+			return
+		}
+	}
+
+	file, err := d.taskUsecase.OpenArchive(r.Context(), taskID, version)
 	if err != nil {
-		logger.Error("failed to get task",
-			zap.String("function", funcName),
-			zap.Int64("task_id", taskID),
-			zap.Error(err),
-		)
 		responses.ResponseErrorAndLog(w, err, funcName)
 		return
 	}
+	defer file.Body.Close()
+
+	w.Header().Set("Content-Type", file.ContentType)
+	w.Header().Set("Content-Disposition", "attachment; filename="+file.Name)
+
+	// seekable bodies get range requests and conditional GETs for free
+	if body, ok := file.Body.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, file.Name, file.ModTime, body)
+	} else {
+		w.Header().Set("Content-Length", strconv.FormatInt(file.Size, 10))
+		w.WriteHeader(http.StatusOK)
+		if _, err := io.Copy(w, file.Body); err != nil {
+			logger.Error("failed to send archive",
+				zap.String("function", funcName),
+				zap.Int64("task_id", taskID),
+				zap.Error(err),
+			)
+			return
+		}
+	}
 
-	if task.Status != models.StatusDone {
-		logger.Warn("archive not ready",
-			zap.String("function", funcName),
-			zap.Int64("task_id", taskID),
-			zap.String("status", string(task.Status)),
-		)
-		responses.DoBadResponseAndLog(w, http.StatusNotFound, "archive not ready")
+	logger.Info("archive downloaded successfully",
+		zap.String("function", funcName),
+		zap.Int64("task_id", taskID),
+	)
+}
+
+// streamTask builds the archive of a waiting task into the response
+// instead of storing it.
+func (d *TaskDelivery) streamTask(w http.ResponseWriter, r *http.Request, taskID int64) {
+	const funcName = "TaskDelivery.streamTask"
+
+	out := &streamResponse{w: w, fileName: fmt.Sprintf("task_%d.zip", taskID)}
+	if err := d.taskUsecase.StreamTask(r.Context(), taskID, out); err != nil {
+		out.fail(err, funcName)
 		return
 	}
 
-	zipPath := fmt.Sprintf("./storage/task_%d.zip", taskID)
+	logger.Info("archive streamed successfully",
+		zap.String("function", funcName),
+		zap.Int64("task_id", taskID),
+	)
+}
+
+// StreamArchive streams a one-off zip of the given URLs without creating a task.
+func (d *TaskDelivery) StreamArchive(w http.ResponseWriter, r *http.Request) {
+	const funcName = "TaskDelivery.StreamArchive"
+	logger.Debug("streaming one-off archive",
+		zap.String("function", funcName),
+	)
 
-	if _, err := os.Stat(zipPath); os.IsNotExist(err) {
-		logger.Error("archive file not found",
-			zap.String("function", funcName),
-			zap.Int64("task_id", taskID),
-			zap.String("path", zipPath),
-			zap.Error(err),
-		)
-		responses.DoBadResponseAndLog(w, http.StatusInternalServerError, "archive file missing")
+	req := models.StreamRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		responses.DoBadResponseAndLog(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/zip")
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=task_%d.zip", taskID))
+	out := &streamResponse{w: w, fileName: "archive.zip"}
+	if err := d.taskUsecase.StreamArchive(r.Context(), req, out); err != nil {
+		out.fail(err, funcName)
+		return
+	}
 
-	http.ServeFile(w, r, zipPath)
+	logger.Info("archive streamed successfully",
+		zap.String("function", funcName),
+		zap.Int("urls", len(req.URLs)),
+	)
+}
 
-	logger.Info("archive downloaded successfully",
+// streamResponse sends the archive headers together with the first bytes of
+// the archive, so errors found before that still get a regular response.
+type streamResponse struct {
+	w        http.ResponseWriter
+	fileName string
+	started  bool
+}
+
+func (s *streamResponse) Write(p []byte) (int, error) {
+	if !s.started {
+		s.started = true
+		s.w.Header().Set("Content-Type", archive.FormatZip.ContentType())
+		s.w.Header().Set("Content-Disposition", "attachment; filename="+s.fileName)
+		s.w.WriteHeader(http.StatusOK)
+	}
+	return s.w.Write(p)
+}
+
+// fail reports err to the client if nothing has been sent yet; otherwise
+// the archive is cut short and the error can only be logged.
+func (s *streamResponse) fail(err error, funcName string) {
+	if !s.started {
+		responses.ResponseErrorAndLog(s.w, err, funcName)
+		return
+	}
+	logger.Error("archive stream aborted",
 		zap.String("function", funcName),
-		zap.Int64("task_id", taskID),
+		zap.Error(err),
 	)
 }
 
@@ -276,10 +540,11 @@ func (d *TaskDelivery) GetAllTasks(w http.ResponseWriter, r *http.Request) {
 	response := make([]models.TaskResponse, 0, len(tasks))
 	for _, task := range tasks {
 		response = append(response, models.TaskResponse{
-			ID:           task.ID,
-			Status:       task.Status,
-			CreatedAt:    task.CreatedAt,
-			ObjectsCount: len(task.Objects),
+			ID:            task.ID,
+			Status:        task.Status,
+			CreatedAt:     task.CreatedAt,
+			ObjectsCount:  len(task.Objects),
+			QueuePosition: task.QueuePosition,
 		})
 	}
 
@@ -288,3 +553,17 @@ func (d *TaskDelivery) GetAllTasks(w http.ResponseWriter, r *http.Request) {
 		"tasks": response,
 	}, http.StatusOK)
 }
+
+func (d *TaskDelivery) GetPolicy(w http.ResponseWriter, r *http.Request) {
+	const funcName = "TaskDelivery.GetPolicy"
+	logger.Debug("getting file policy",
+		zap.String("function", funcName),
+	)
+
+	policy := d.taskUsecase.GetFilePolicy()
+
+	responses.DoJSONResponse(w, map[string]any{
+		"file_types":           policy.Types,
+		"max_objects_per_task": d.taskUsecase.GetMaxObjectsPerTask(),
+	}, http.StatusOK)
+}
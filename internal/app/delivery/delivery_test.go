@@ -2,7 +2,10 @@ package delivery
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -15,6 +18,7 @@ import (
 	"github.com/supchaser/test_task/internal/app/models"
 	"github.com/supchaser/test_task/internal/utils/errs"
 	"github.com/supchaser/test_task/internal/utils/logger"
+	"github.com/supchaser/test_task/internal/utils/validate"
 )
 
 func TestMain(m *testing.M) {
@@ -31,6 +35,7 @@ func TestTaskDelivery_CreateTask(t *testing.T) {
 
 	tests := []struct {
 		name             string
+		body             string
 		mockSetup        func()
 		expectedStatus   int
 		validateResponse func(t *testing.T, body []byte)
@@ -39,7 +44,7 @@ func TestTaskDelivery_CreateTask(t *testing.T) {
 			name: "Success",
 			mockSetup: func() {
 				mockUsecase.EXPECT().
-					CreateTask(gomock.Any()).
+					CreateTask(gomock.Any(), gomock.Any()).
 					Return(&models.Task{
 						ID:        1,
 						Status:    models.StatusWaiting,
@@ -62,7 +67,7 @@ func TestTaskDelivery_CreateTask(t *testing.T) {
 			name: "MaxTasksReached",
 			mockSetup: func() {
 				mockUsecase.EXPECT().
-					CreateTask(gomock.Any()).
+					CreateTask(gomock.Any(), gomock.Any()).
 					Return(nil, errs.ErrMaxTasksReached)
 				mockUsecase.EXPECT().
 					GetMaxTasks().
@@ -70,6 +75,12 @@ func TestTaskDelivery_CreateTask(t *testing.T) {
 				mockUsecase.EXPECT().
 					GetActiveTasksCount().
 					Return(5)
+				mockUsecase.EXPECT().
+					GetQueuedTasksCount().
+					Return(2)
+				mockUsecase.EXPECT().
+					EstimateRetryAfter().
+					Return(1500 * time.Millisecond)
 			},
 			expectedStatus: http.StatusTooManyRequests,
 			validateResponse: func(t *testing.T, body []byte) {
@@ -79,21 +90,120 @@ func TestTaskDelivery_CreateTask(t *testing.T) {
 				assert.Equal(t, errs.ErrMaxTasksReached.Error(), response["error"])
 				assert.Equal(t, float64(5), response["max_tasks"])
 				assert.Equal(t, float64(5), response["active_now"])
+				assert.Equal(t, float64(2), response["queued_now"])
+				assert.Equal(t, float64(2), response["retry_after"])
 				assert.Contains(t, response["suggestion"], "Try again later")
 			},
 		},
+		{
+			name: "Queued",
+			mockSetup: func() {
+				estimate := time.Now().Add(time.Minute)
+				mockUsecase.EXPECT().
+					CreateTask(gomock.Any(), gomock.Any()).
+					Return(&models.Task{
+						ID:               2,
+						Status:           models.StatusQueued,
+						CreatedAt:        time.Now(),
+						Objects:          []*models.Object{},
+						QueuePosition:    1,
+						EstimatedStartAt: &estimate,
+					}, nil)
+			},
+			expectedStatus: http.StatusCreated,
+			validateResponse: func(t *testing.T, body []byte) {
+				var task models.Task
+				err := json.Unmarshal(body, &task)
+				assert.NoError(t, err)
+				assert.Equal(t, models.StatusQueued, task.Status)
+				assert.Equal(t, 1, task.QueuePosition)
+				assert.NotNil(t, task.EstimatedStartAt)
+			},
+		},
+		{
+			name: "WithFormat",
+			body: `{"format":"tar.gz"}`,
+			mockSetup: func() {
+				mockUsecase.EXPECT().
+					CreateTask(gomock.Any(), models.TaskOptions{Format: "tar.gz"}).
+					Return(&models.Task{
+						ID:        3,
+						Status:    models.StatusWaiting,
+						Format:    "tar.gz",
+						CreatedAt: time.Now(),
+						Objects:   []*models.Object{},
+					}, nil)
+			},
+			expectedStatus: http.StatusCreated,
+			validateResponse: func(t *testing.T, body []byte) {
+				var task models.Task
+				err := json.Unmarshal(body, &task)
+				assert.NoError(t, err)
+				assert.Equal(t, "tar.gz", task.Format)
+			},
+		},
+		{
+			name: "InvalidFormat",
+			body: `{"format":"rar"}`,
+			mockSetup: func() {
+				mockUsecase.EXPECT().
+					CreateTask(gomock.Any(), models.TaskOptions{Format: "rar"}).
+					Return(nil, errs.ErrInvalidFormat)
+			},
+			expectedStatus: http.StatusBadRequest,
+			validateResponse: func(t *testing.T, body []byte) {
+				assert.Contains(t, string(body), "invalid archive format")
+			},
+		},
+		{
+			name: "PasswordNotEchoed",
+			body: `{"password":"top-secret"}`,
+			mockSetup: func() {
+				mockUsecase.EXPECT().
+					CreateTask(gomock.Any(), models.TaskOptions{Password: "top-secret"}).
+					Return(&models.Task{
+						ID:        4,
+						Status:    models.StatusWaiting,
+						Format:    "zip",
+						Encrypted: true,
+						Password:  "top-secret",
+						CreatedAt: time.Now(),
+						Objects:   []*models.Object{},
+					}, nil)
+			},
+			expectedStatus: http.StatusCreated,
+			validateResponse: func(t *testing.T, body []byte) {
+				assert.NotContains(t, string(body), "top-secret")
+				var task models.Task
+				err := json.Unmarshal(body, &task)
+				assert.NoError(t, err)
+				assert.True(t, task.Encrypted)
+			},
+		},
+		{
+			name:           "InvalidBody",
+			body:           `{`,
+			mockSetup:      func() {},
+			expectedStatus: http.StatusBadRequest,
+			validateResponse: func(t *testing.T, body []byte) {
+				assert.Contains(t, string(body), "invalid request body")
+			},
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			tt.mockSetup()
 
-			req := httptest.NewRequest("POST", "/tasks", nil)
+			req := httptest.NewRequest("POST", "/tasks", bytes.NewBufferString(tt.body))
 			w := httptest.NewRecorder()
 
 			taskDelivery.CreateTask(w, req)
 
 			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusTooManyRequests {
+				assert.Equal(t, "2", w.Header().Get("Retry-After"))
+			}
 			tt.validateResponse(t, w.Body.Bytes())
 		})
 	}
@@ -164,6 +274,7 @@ func TestTaskDelivery_AddObjects(t *testing.T) {
 	defer ctrl.Finish()
 
 	mockUsecase := mock_app.NewMockTaskUsecase(ctrl)
+	mockUsecase.EXPECT().GetMaxObjectsPerTask().Return(3).AnyTimes()
 	taskDelivery := CreateTaskDelivery(mockUsecase)
 
 	tests := []struct {
@@ -182,7 +293,7 @@ func TestTaskDelivery_AddObjects(t *testing.T) {
 			},
 			mockSetup: func(m *mock_app.MockTaskUsecase) {
 				m.EXPECT().
-					AddObject(gomock.Any(), int64(1), "http://example.com/image.jpg").
+					AddObject(gomock.Any(), int64(1), "http://example.com/image.jpg", "").
 					Return(&models.Task{ID: 1, Objects: []*models.Object{{URL: "http://example.com/image.jpg"}}}, nil)
 				m.EXPECT().
 					GetTask(gomock.Any(), int64(1)).
@@ -195,6 +306,28 @@ func TestTaskDelivery_AddObjects(t *testing.T) {
 				TotalObjects: 1,
 			},
 		},
+		{
+			name:   "SuccessWithNameOverride",
+			taskID: "1",
+			requestBody: models.Request{
+				URLs:  []string{"http://example.com/download?id=5"},
+				Names: map[string]string{"http://example.com/download?id=5": "invoice.pdf"},
+			},
+			mockSetup: func(m *mock_app.MockTaskUsecase) {
+				m.EXPECT().
+					AddObject(gomock.Any(), int64(1), "http://example.com/download?id=5", "invoice.pdf").
+					Return(&models.Task{ID: 1}, nil)
+				m.EXPECT().
+					GetTask(gomock.Any(), int64(1)).
+					Return(&models.Task{ID: 1, Objects: []*models.Object{{URL: "http://example.com/download?id=5"}}}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedResult: &models.MultiAddResult{
+				AddedCount:   1,
+				FailedURLs:   map[string]string{},
+				TotalObjects: 1,
+			},
+		},
 		{
 			name:   "SuccessMultipleURLs",
 			taskID: "1",
@@ -206,10 +339,10 @@ func TestTaskDelivery_AddObjects(t *testing.T) {
 			},
 			mockSetup: func(m *mock_app.MockTaskUsecase) {
 				m.EXPECT().
-					AddObject(gomock.Any(), int64(1), "http://example.com/image1.jpg").
+					AddObject(gomock.Any(), int64(1), "http://example.com/image1.jpg", "").
 					Return(&models.Task{ID: 1}, nil)
 				m.EXPECT().
-					AddObject(gomock.Any(), int64(1), "http://example.com/image2.jpg").
+					AddObject(gomock.Any(), int64(1), "http://example.com/image2.jpg", "").
 					Return(&models.Task{ID: 1}, nil)
 				m.EXPECT().
 					GetTask(gomock.Any(), int64(1)).
@@ -237,6 +370,20 @@ func TestTaskDelivery_AddObjects(t *testing.T) {
 			mockSetup:      func(m *mock_app.MockTaskUsecase) {},
 			expectedStatus: http.StatusBadRequest,
 		},
+		{
+			name:   "TooManyURLs",
+			taskID: "1",
+			requestBody: map[string][]string{
+				"urls": {
+					"http://example.com/1.jpg",
+					"http://example.com/2.jpg",
+					"http://example.com/3.jpg",
+					"http://example.com/4.jpg",
+				},
+			},
+			mockSetup:      func(m *mock_app.MockTaskUsecase) {},
+			expectedStatus: http.StatusBadRequest,
+		},
 		{
 			name:           "InvalidRequestBody_InvalidJSON",
 			taskID:         "1",
@@ -252,7 +399,7 @@ func TestTaskDelivery_AddObjects(t *testing.T) {
 			},
 			mockSetup: func(m *mock_app.MockTaskUsecase) {
 				m.EXPECT().
-					AddObject(gomock.Any(), int64(1), "http://example.com/image.jpg").
+					AddObject(gomock.Any(), int64(1), "http://example.com/image.jpg", "").
 					Return(nil, errs.ErrTaskNotFound)
 				m.EXPECT().
 					GetTask(gomock.Any(), int64(1)).
@@ -271,11 +418,11 @@ func TestTaskDelivery_AddObjects(t *testing.T) {
 			},
 			mockSetup: func(m *mock_app.MockTaskUsecase) {
 				m.EXPECT().
-					AddObject(gomock.Any(), int64(1), "http://example.com/good.jpg").
+					AddObject(gomock.Any(), int64(1), "http://example.com/good.jpg", "").
 					Return(&models.Task{ID: 1}, nil)
 				m.EXPECT().
-					AddObject(gomock.Any(), int64(1), "http://example.com/bad.jpg").
-					Return(nil, errs.ErrInvalidFileType)
+					AddObject(gomock.Any(), int64(1), "http://example.com/bad.jpg", "").
+					Return(nil, validate.DefaultPolicy().InvalidTypeError("declared text/html"))
 				m.EXPECT().
 					GetTask(gomock.Any(), int64(1)).
 					Return(&models.Task{
@@ -289,7 +436,7 @@ func TestTaskDelivery_AddObjects(t *testing.T) {
 			expectedResult: &models.MultiAddResult{
 				AddedCount: 1,
 				FailedURLs: map[string]string{
-					"http://example.com/bad.jpg": "invalid file type (allowed: .pdf, .jpeg)",
+					"http://example.com/bad.jpg": "invalid file type (allowed: .pdf, .jpeg, .jpg): declared text/html",
 				},
 				TotalObjects: 1,
 			},
@@ -339,7 +486,7 @@ func TestTaskDelivery_AddObjects(t *testing.T) {
 	}
 }
 
-func TestTaskDelivery_GetTaskStatus(t *testing.T) {
+func TestTaskDelivery_FinalizeTask(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
@@ -349,75 +496,106 @@ func TestTaskDelivery_GetTaskStatus(t *testing.T) {
 	tests := []struct {
 		name           string
 		taskID         string
+		body           string
 		mockSetup      func()
 		expectedStatus int
-		expectedZipURL bool
 	}{
 		{
-			name:   "Success_Waiting",
+			name:   "Success",
 			taskID: "1",
 			mockSetup: func() {
 				mockUsecase.EXPECT().
-					GetTaskStatus(gomock.Any(), int64(1)).
-					Return(&models.Task{ID: 1, Status: models.StatusWaiting}, nil)
+					FinalizeTask(gomock.Any(), int64(1), "").
+					Return(&models.Task{ID: 1, Status: models.StatusProcessing}, nil)
 			},
-			expectedStatus: http.StatusOK,
-			expectedZipURL: false,
+			expectedStatus: http.StatusAccepted,
 		},
 		{
-			name:   "Success_Done",
+			name:   "WithPassword",
 			taskID: "1",
+			body:   `{"password":"secret"}`,
 			mockSetup: func() {
 				mockUsecase.EXPECT().
-					GetTaskStatus(gomock.Any(), int64(1)).
-					Return(&models.Task{ID: 1, Status: models.StatusDone}, nil)
+					FinalizeTask(gomock.Any(), int64(1), "secret").
+					Return(&models.Task{ID: 1, Status: models.StatusProcessing, Encrypted: true, Password: "secret"}, nil)
 			},
-			expectedStatus: http.StatusOK,
-			expectedZipURL: true,
+			expectedStatus: http.StatusAccepted,
 		},
 		{
-			name:           "InvalidTaskID",
+			name:           "InvalidBody",
+			taskID:         "1",
+			body:           `{`,
+			mockSetup:      func() {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "InvalidID",
 			taskID:         "invalid",
 			mockSetup:      func() {},
 			expectedStatus: http.StatusBadRequest,
 		},
+		{
+			name:   "NoObjects",
+			taskID: "1",
+			mockSetup: func() {
+				mockUsecase.EXPECT().
+					FinalizeTask(gomock.Any(), int64(1), "").
+					Return(nil, errs.ErrNoObjects)
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "AlreadyProcessing",
+			taskID: "1",
+			mockSetup: func() {
+				mockUsecase.EXPECT().
+					FinalizeTask(gomock.Any(), int64(1), "").
+					Return(nil, errs.ErrInvalidTaskStatus)
+			},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:   "TaskNotFound",
+			taskID: "1",
+			mockSetup: func() {
+				mockUsecase.EXPECT().
+					FinalizeTask(gomock.Any(), int64(1), "").
+					Return(nil, errs.ErrTaskNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:   "ShuttingDown",
+			taskID: "1",
+			mockSetup: func() {
+				mockUsecase.EXPECT().
+					FinalizeTask(gomock.Any(), int64(1), "").
+					Return(nil, errs.ErrShuttingDown)
+			},
+			expectedStatus: http.StatusServiceUnavailable,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			tt.mockSetup()
 
-			req := httptest.NewRequest("GET", "/tasks/"+tt.taskID+"/status", nil)
+			req := httptest.NewRequest("POST", "/tasks/"+tt.taskID+"/finalize", bytes.NewBufferString(tt.body))
 			w := httptest.NewRecorder()
 
-			vars := map[string]string{
+			req = mux.SetURLVars(req, map[string]string{
 				"id": tt.taskID,
-			}
-			req = mux.SetURLVars(req, vars)
+			})
 
-			taskDelivery.GetTaskStatus(w, req)
+			taskDelivery.FinalizeTask(w, req)
 
 			assert.Equal(t, tt.expectedStatus, w.Code)
-
-			if tt.expectedStatus == http.StatusOK {
-				var response struct {
-					Status string `json:"status"`
-					ZipURL string `json:"zip_url,omitempty"`
-				}
-				err := json.Unmarshal(w.Body.Bytes(), &response)
-				assert.NoError(t, err)
-
-				if tt.expectedZipURL {
-					assert.NotEmpty(t, response.ZipURL)
-				} else {
-					assert.Empty(t, response.ZipURL)
-				}
-			}
+			assert.NotContains(t, w.Body.String(), "secret")
 		})
 	}
 }
 
-func TestTaskDelivery_DownloadArchive(t *testing.T) {
+func TestTaskDelivery_RetryTask(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
@@ -427,34 +605,64 @@ func TestTaskDelivery_DownloadArchive(t *testing.T) {
 	tests := []struct {
 		name           string
 		taskID         string
+		body           string
 		mockSetup      func()
 		expectedStatus int
 	}{
 		{
-			name:           "InvalidTaskID",
+			name:   "FailedObjects",
+			taskID: "1",
+			mockSetup: func() {
+				mockUsecase.EXPECT().
+					RetryTask(gomock.Any(), int64(1), false).
+					Return(&models.Task{ID: 1, Status: models.StatusProcessing, ArchiveVersion: 2}, nil)
+			},
+			expectedStatus: http.StatusAccepted,
+		},
+		{
+			name:   "All",
+			taskID: "1",
+			body:   `{"all":true}`,
+			mockSetup: func() {
+				mockUsecase.EXPECT().
+					RetryTask(gomock.Any(), int64(1), true).
+					Return(&models.Task{ID: 1, Status: models.StatusProcessing, ArchiveVersion: 2}, nil)
+			},
+			expectedStatus: http.StatusAccepted,
+		},
+		{
+			name:           "InvalidBody",
+			taskID:         "1",
+			body:           `{`,
+			mockSetup:      func() {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "InvalidID",
 			taskID:         "invalid",
 			mockSetup:      func() {},
 			expectedStatus: http.StatusBadRequest,
 		},
 		{
-			name:   "TaskNotFound",
+			name:   "NotFinished",
 			taskID: "1",
 			mockSetup: func() {
 				mockUsecase.EXPECT().
-					GetTask(gomock.Any(), int64(1)).
-					Return(nil, errs.ErrTaskNotFound)
+					RetryTask(gomock.Any(), int64(1), false).
+					Return(nil, errs.ErrInvalidTaskStatus)
 			},
-			expectedStatus: http.StatusNotFound,
+			expectedStatus: http.StatusConflict,
 		},
 		{
-			name:   "ArchiveNotReady",
+			name:   "NoFreeSlot",
 			taskID: "1",
 			mockSetup: func() {
 				mockUsecase.EXPECT().
-					GetTask(gomock.Any(), int64(1)).
-					Return(&models.Task{Status: models.StatusProcessing}, nil)
+					RetryTask(gomock.Any(), int64(1), false).
+					Return(nil, errs.ErrMaxTasksReached)
+				mockUsecase.EXPECT().EstimateRetryAfter().Return(time.Minute)
 			},
-			expectedStatus: http.StatusNotFound,
+			expectedStatus: http.StatusTooManyRequests,
 		},
 	}
 
@@ -462,22 +670,27 @@ func TestTaskDelivery_DownloadArchive(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			tt.mockSetup()
 
-			req := httptest.NewRequest("GET", "/download/"+tt.taskID, nil)
+			req := httptest.NewRequest("POST", "/tasks/"+tt.taskID+"/retry", bytes.NewBufferString(tt.body))
 			w := httptest.NewRecorder()
 
-			vars := map[string]string{
+			req = mux.SetURLVars(req, map[string]string{
 				"id": tt.taskID,
-			}
-			req = mux.SetURLVars(req, vars)
+			})
 
-			taskDelivery.DownloadArchive(w, req)
+			taskDelivery.RetryTask(w, req)
 
 			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusAccepted {
+				assert.Contains(t, w.Body.String(), `"ArchiveVersion":2`)
+			}
+			if tt.expectedStatus == http.StatusTooManyRequests {
+				assert.Equal(t, "60", w.Header().Get("Retry-After"))
+			}
 		})
 	}
 }
 
-func TestTaskDelivery_GetAllTasks(t *testing.T) {
+func TestTaskDelivery_CancelTask(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
@@ -486,32 +699,39 @@ func TestTaskDelivery_GetAllTasks(t *testing.T) {
 
 	tests := []struct {
 		name           string
+		method         string
+		taskID         string
 		mockSetup      func()
 		expectedStatus int
-		expectedCount  int
 	}{
 		{
-			name: "SuccessWithTasks",
+			name:   "Post",
+			method: "POST",
+			taskID: "1",
 			mockSetup: func() {
 				mockUsecase.EXPECT().
-					GetAllTasks(gomock.Any()).
-					Return([]*models.Task{
-						{ID: 1},
-						{ID: 2},
-					}, nil)
+					CancelTask(gomock.Any(), int64(1)).
+					Return(&models.Task{ID: 1, Status: models.StatusCancelled}, nil)
 			},
 			expectedStatus: http.StatusOK,
-			expectedCount:  2,
 		},
 		{
-			name: "SuccessNoTasks",
+			name:           "InvalidID",
+			method:         "POST",
+			taskID:         "invalid",
+			mockSetup:      func() {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "TaskNotFound",
+			method: "POST",
+			taskID: "1",
 			mockSetup: func() {
 				mockUsecase.EXPECT().
-					GetAllTasks(gomock.Any()).
-					Return([]*models.Task{}, nil)
+					CancelTask(gomock.Any(), int64(1)).
+					Return(nil, errs.ErrTaskNotFound)
 			},
-			expectedStatus: http.StatusOK,
-			expectedCount:  0,
+			expectedStatus: http.StatusNotFound,
 		},
 	}
 
@@ -519,23 +739,641 @@ func TestTaskDelivery_GetAllTasks(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			tt.mockSetup()
 
-			req := httptest.NewRequest("GET", "/tasks", nil)
+			req := httptest.NewRequest(tt.method, "/tasks/"+tt.taskID, nil)
 			w := httptest.NewRecorder()
 
-			taskDelivery.GetAllTasks(w, req)
-
-			assert.Equal(t, tt.expectedStatus, w.Code)
+			req = mux.SetURLVars(req, map[string]string{
+				"id": tt.taskID,
+			})
 
-			var response map[string]any
-			err := json.Unmarshal(w.Body.Bytes(), &response)
-			assert.NoError(t, err)
+			taskDelivery.CancelTask(w, req)
 
-			if tt.expectedCount == 0 {
-				assert.Equal(t, "No tasks found", response["message"])
-			} else {
-				tasks := response["tasks"].([]interface{})
-				assert.Equal(t, tt.expectedCount, len(tasks))
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusOK {
+				assert.Contains(t, w.Body.String(), `"cancelled"`)
 			}
 		})
 	}
 }
+
+func TestTaskDelivery_DeleteTask(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUsecase := mock_app.NewMockTaskUsecase(ctrl)
+	taskDelivery := CreateTaskDelivery(mockUsecase)
+
+	tests := []struct {
+		name           string
+		taskID         string
+		mockSetup      func()
+		expectedStatus int
+	}{
+		{
+			name:   "Finished",
+			taskID: "1",
+			mockSetup: func() {
+				mockUsecase.EXPECT().GetTask(gomock.Any(), int64(1)).Return(&models.Task{ID: 1, Status: models.StatusDone}, nil)
+				mockUsecase.EXPECT().DeleteTask(gomock.Any(), int64(1)).Return(nil)
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:   "ActiveIsCancelled",
+			taskID: "1",
+			mockSetup: func() {
+				mockUsecase.EXPECT().GetTask(gomock.Any(), int64(1)).Return(&models.Task{ID: 1, Status: models.StatusWaiting}, nil)
+				mockUsecase.EXPECT().
+					CancelTask(gomock.Any(), int64(1)).
+					Return(&models.Task{ID: 1, Status: models.StatusCancelled}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "InvalidID",
+			taskID:         "invalid",
+			mockSetup:      func() {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "TaskNotFound",
+			taskID: "1",
+			mockSetup: func() {
+				mockUsecase.EXPECT().GetTask(gomock.Any(), int64(1)).Return(nil, errs.ErrTaskNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockSetup()
+
+			req := httptest.NewRequest("DELETE", "/tasks/"+tt.taskID, nil)
+			w := httptest.NewRecorder()
+
+			req = mux.SetURLVars(req, map[string]string{
+				"id": tt.taskID,
+			})
+
+			taskDelivery.DeleteTask(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
+
+func TestTaskDelivery_PurgeTasks(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUsecase := mock_app.NewMockTaskUsecase(ctrl)
+	taskDelivery := CreateTaskDelivery(mockUsecase)
+
+	tests := []struct {
+		name           string
+		query          string
+		mockSetup      func()
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:  "Filters",
+			query: "?status=failed,expired&status=done&older_than=24h",
+			mockSetup: func() {
+				mockUsecase.EXPECT().
+					PurgeTasks(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ context.Context, filter models.PurgeFilter) ([]int64, error) {
+						assert.Equal(t, []models.TaskStatus{models.StatusFailed, models.StatusExpired, models.StatusDone}, filter.Statuses)
+						assert.WithinDuration(t, time.Now().Add(-24*time.Hour), filter.FinishedBefore, time.Minute)
+						return []int64{1, 2}, nil
+					})
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"deleted":2`,
+		},
+		{
+			name:  "NoFilters",
+			query: "",
+			mockSetup: func() {
+				mockUsecase.EXPECT().PurgeTasks(gomock.Any(), models.PurgeFilter{}).Return([]int64{}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"deleted":0`,
+		},
+		{
+			name:           "InvalidOlderThan",
+			query:          "?older_than=yesterday",
+			mockSetup:      func() {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:  "ActiveStatus",
+			query: "?status=waiting",
+			mockSetup: func() {
+				mockUsecase.EXPECT().PurgeTasks(gomock.Any(), gomock.Any()).Return(nil, errs.ErrInvalidFilter)
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockSetup()
+
+			req := httptest.NewRequest("DELETE", "/tasks"+tt.query, nil)
+			w := httptest.NewRecorder()
+
+			taskDelivery.PurgeTasks(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Contains(t, w.Body.String(), tt.expectedBody)
+		})
+	}
+}
+
+func TestTaskDelivery_GetTaskStatus(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUsecase := mock_app.NewMockTaskUsecase(ctrl)
+	taskDelivery := CreateTaskDelivery(mockUsecase)
+
+	tests := []struct {
+		name           string
+		taskID         string
+		mockSetup      func()
+		expectedStatus int
+		expectedZipURL bool
+		expectedErrors []string
+		expectedMissed []string
+	}{
+		{
+			name:   "Success_Waiting",
+			taskID: "1",
+			mockSetup: func() {
+				mockUsecase.EXPECT().
+					GetTaskStatus(gomock.Any(), int64(1)).
+					Return(&models.Task{ID: 1, Status: models.StatusWaiting}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedZipURL: false,
+		},
+		{
+			name:   "Success_Done",
+			taskID: "1",
+			mockSetup: func() {
+				mockUsecase.EXPECT().
+					GetTaskStatus(gomock.Any(), int64(1)).
+					Return(&models.Task{ID: 1, Status: models.StatusDone}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedZipURL: true,
+		},
+		{
+			name:   "Done_WithFailedObjects",
+			taskID: "1",
+			mockSetup: func() {
+				mockUsecase.EXPECT().
+					GetTaskStatus(gomock.Any(), int64(1)).
+					Return(&models.Task{
+						ID:     1,
+						Status: models.StatusDone,
+						Objects: []*models.Object{
+							{URL: "http://example.com/a.pdf", State: models.ObjectArchived},
+							{URL: "http://example.com/b.pdf", State: models.ObjectFailed, Error: "invalid response status: 404"},
+						},
+					}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedZipURL: true,
+			expectedErrors: []string{"http://example.com/b.pdf: invalid response status: 404"},
+			expectedMissed: []string{"http://example.com/b.pdf"},
+		},
+		{
+			name:           "InvalidTaskID",
+			taskID:         "invalid",
+			mockSetup:      func() {},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockSetup()
+
+			req := httptest.NewRequest("GET", "/tasks/"+tt.taskID+"/status", nil)
+			w := httptest.NewRecorder()
+
+			vars := map[string]string{
+				"id": tt.taskID,
+			}
+			req = mux.SetURLVars(req, vars)
+
+			taskDelivery.GetTaskStatus(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			if tt.expectedStatus == http.StatusOK {
+				var response struct {
+					Status      string   `json:"status"`
+					ZipURL      string   `json:"zip_url,omitempty"`
+					Errors      []string `json:"errors,omitempty"`
+					MissingURLs []string `json:"missing_urls,omitempty"`
+				}
+				err := json.Unmarshal(w.Body.Bytes(), &response)
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedErrors, response.Errors)
+				assert.Equal(t, tt.expectedMissed, response.MissingURLs)
+
+				if tt.expectedZipURL {
+					assert.NotEmpty(t, response.ZipURL)
+				} else {
+					assert.Empty(t, response.ZipURL)
+				}
+			}
+		})
+	}
+}
+
+func TestTaskDelivery_DownloadArchive(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUsecase := mock_app.NewMockTaskUsecase(ctrl)
+	taskDelivery := CreateTaskDelivery(mockUsecase)
+
+	archiveFile := func(body io.ReadCloser) *models.ArchiveFile {
+		return &models.ArchiveFile{
+			Name:        "task_1.tar.gz",
+			ContentType: "application/gzip",
+			Size:        7,
+			ModTime:     time.Now(),
+			Body:        body,
+		}
+	}
+
+	tests := []struct {
+		name            string
+		taskID          string
+		query           string
+		mockSetup       func()
+		expectedStatus  int
+		expectedContent string
+	}{
+		{
+			name:           "InvalidTaskID",
+			taskID:         "invalid",
+			mockSetup:      func() {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "TaskNotFound",
+			taskID: "1",
+			mockSetup: func() {
+				mockUsecase.EXPECT().
+					OpenArchive(gomock.Any(), int64(1), 0).
+					Return(nil, errs.ErrTaskNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:   "ArchiveNotReady",
+			taskID: "1",
+			mockSetup: func() {
+				mockUsecase.EXPECT().
+					OpenArchive(gomock.Any(), int64(1), 0).
+					Return(nil, errs.ErrArchiveNotReady)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:   "ArchiveStreamed",
+			taskID: "1",
+			mockSetup: func() {
+				mockUsecase.EXPECT().
+					OpenArchive(gomock.Any(), int64(1), 0).
+					Return(nil, errs.ErrArchiveNotStored)
+			},
+			expectedStatus: http.StatusGone,
+		},
+		{
+			name:   "ArchiveMissing",
+			taskID: "1",
+			mockSetup: func() {
+				mockUsecase.EXPECT().
+					OpenArchive(gomock.Any(), int64(1), 0).
+					Return(nil, errs.ErrArchiveMissing)
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:           "InvalidVersion",
+			taskID:         "1",
+			query:          "?version=0",
+			mockSetup:      func() {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "VersionNotFound",
+			taskID: "1",
+			query:  "?version=5",
+			mockSetup: func() {
+				mockUsecase.EXPECT().
+					OpenArchive(gomock.Any(), int64(1), 5).
+					Return(nil, errs.ErrVersionNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:   "EarlierVersion",
+			taskID: "1",
+			query:  "?version=1",
+			mockSetup: func() {
+				mockUsecase.EXPECT().
+					OpenArchive(gomock.Any(), int64(1), 1).
+					Return(archiveFile(io.NopCloser(bytes.NewBufferString("archive"))), nil)
+			},
+			expectedStatus:  http.StatusOK,
+			expectedContent: "archive",
+		},
+		{
+			name:   "SeekableBody",
+			taskID: "1",
+			mockSetup: func() {
+				mockUsecase.EXPECT().
+					OpenArchive(gomock.Any(), int64(1), 0).
+					Return(archiveFile(readSeekCloser{bytes.NewReader([]byte("archive"))}), nil)
+			},
+			expectedStatus:  http.StatusOK,
+			expectedContent: "archive",
+		},
+		{
+			name:   "PlainBody",
+			taskID: "1",
+			mockSetup: func() {
+				mockUsecase.EXPECT().
+					OpenArchive(gomock.Any(), int64(1), 0).
+					Return(archiveFile(io.NopCloser(bytes.NewBufferString("archive"))), nil)
+			},
+			expectedStatus:  http.StatusOK,
+			expectedContent: "archive",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockSetup()
+
+			req := httptest.NewRequest("GET", "/download/"+tt.taskID+tt.query, nil)
+			w := httptest.NewRecorder()
+
+			vars := map[string]string{
+				"id": tt.taskID,
+			}
+			req = mux.SetURLVars(req, vars)
+
+			taskDelivery.DownloadArchive(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedContent != "" {
+				assert.Equal(t, tt.expectedContent, w.Body.String())
+				assert.Equal(t, "application/gzip", w.Header().Get("Content-Type"))
+				assert.Equal(t, "attachment; filename=task_1.tar.gz", w.Header().Get("Content-Disposition"))
+				assert.Equal(t, "7", w.Header().Get("Content-Length"))
+			}
+		})
+	}
+}
+
+type readSeekCloser struct {
+	io.ReadSeeker
+}
+
+func (readSeekCloser) Close() error {
+	return nil
+}
+
+func TestTaskDelivery_DownloadArchive_Stream(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUsecase := mock_app.NewMockTaskUsecase(ctrl)
+	taskDelivery := CreateTaskDelivery(mockUsecase)
+
+	tests := []struct {
+		name            string
+		mockSetup       func()
+		expectedStatus  int
+		expectedType    string
+		expectedContent string
+	}{
+		{
+			name: "Success",
+			mockSetup: func() {
+				mockUsecase.EXPECT().
+					StreamTask(gomock.Any(), int64(1), gomock.Any()).
+					DoAndReturn(func(_ context.Context, _ int64, w io.Writer) error {
+						_, err := w.Write([]byte("PK"))
+						return err
+					})
+			},
+			expectedStatus:  http.StatusOK,
+			expectedType:    "application/zip",
+			expectedContent: "PK",
+		},
+		{
+			name: "RejectedBeforeStart",
+			mockSetup: func() {
+				mockUsecase.EXPECT().
+					StreamTask(gomock.Any(), int64(1), gomock.Any()).
+					Return(errs.ErrInvalidTaskStatus)
+			},
+			expectedStatus: http.StatusConflict,
+			expectedType:   "application/json",
+		},
+		{
+			name: "FailedAfterStart",
+			mockSetup: func() {
+				mockUsecase.EXPECT().
+					StreamTask(gomock.Any(), int64(1), gomock.Any()).
+					DoAndReturn(func(_ context.Context, _ int64, w io.Writer) error {
+						w.Write([]byte("PK"))
+						return errors.New("connection reset")
+					})
+			},
+			expectedStatus:  http.StatusOK,
+			expectedType:    "application/zip",
+			expectedContent: "PK",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockSetup()
+
+			req := httptest.NewRequest("GET", "/api/v1/tasks/1/archive?stream=1", nil)
+			req = mux.SetURLVars(req, map[string]string{"id": "1"})
+			w := httptest.NewRecorder()
+
+			taskDelivery.DownloadArchive(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Equal(t, tt.expectedType, w.Header().Get("Content-Type"))
+			if tt.expectedContent != "" {
+				assert.Equal(t, tt.expectedContent, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestTaskDelivery_StreamArchive(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUsecase := mock_app.NewMockTaskUsecase(ctrl)
+	taskDelivery := CreateTaskDelivery(mockUsecase)
+
+	tests := []struct {
+		name           string
+		body           string
+		mockSetup      func()
+		expectedStatus int
+	}{
+		{
+			name: "Success",
+			body: `{"urls": ["https://example.com/a.pdf"], "compression": "store"}`,
+			mockSetup: func() {
+				mockUsecase.EXPECT().
+					StreamArchive(gomock.Any(), models.StreamRequest{
+						Request:     models.Request{URLs: []string{"https://example.com/a.pdf"}},
+						TaskOptions: models.TaskOptions{Compression: "store"},
+					}, gomock.Any()).
+					DoAndReturn(func(_ context.Context, _ models.StreamRequest, w io.Writer) error {
+						_, err := w.Write([]byte("PK"))
+						return err
+					})
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "InvalidBody",
+			body:           `{"urls": `,
+			mockSetup:      func() {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "TooManyURLs",
+			body: `{"urls": ["a", "b", "c", "d"]}`,
+			mockSetup: func() {
+				mockUsecase.EXPECT().
+					StreamArchive(gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(errs.ErrMaxObjectsReached)
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockSetup()
+
+			req := httptest.NewRequest("POST", "/api/v1/archive:stream", bytes.NewBufferString(tt.body))
+			w := httptest.NewRecorder()
+
+			taskDelivery.StreamArchive(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
+
+func TestTaskDelivery_GetAllTasks(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUsecase := mock_app.NewMockTaskUsecase(ctrl)
+	taskDelivery := CreateTaskDelivery(mockUsecase)
+
+	tests := []struct {
+		name           string
+		mockSetup      func()
+		expectedStatus int
+		expectedCount  int
+	}{
+		{
+			name: "SuccessWithTasks",
+			mockSetup: func() {
+				mockUsecase.EXPECT().
+					GetAllTasks(gomock.Any()).
+					Return([]*models.Task{
+						{ID: 1},
+						{ID: 2},
+					}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedCount:  2,
+		},
+		{
+			name: "SuccessNoTasks",
+			mockSetup: func() {
+				mockUsecase.EXPECT().
+					GetAllTasks(gomock.Any()).
+					Return([]*models.Task{}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedCount:  0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockSetup()
+
+			req := httptest.NewRequest("GET", "/tasks", nil)
+			w := httptest.NewRecorder()
+
+			taskDelivery.GetAllTasks(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			var response map[string]any
+			err := json.Unmarshal(w.Body.Bytes(), &response)
+			assert.NoError(t, err)
+
+			if tt.expectedCount == 0 {
+				assert.Equal(t, "No tasks found", response["message"])
+			} else {
+				tasks := response["tasks"].([]interface{})
+				assert.Equal(t, tt.expectedCount, len(tasks))
+			}
+		})
+	}
+}
+
+func TestTaskDelivery_GetPolicy(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUsecase := mock_app.NewMockTaskUsecase(ctrl)
+	policy, err := validate.ParsePolicy("application/pdf:.pdf:10MB;text/csv:.csv")
+	assert.NoError(t, err)
+	mockUsecase.EXPECT().GetFilePolicy().Return(policy)
+	mockUsecase.EXPECT().GetMaxObjectsPerTask().Return(5)
+
+	delivery := CreateTaskDelivery(mockUsecase)
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/policy", nil)
+	w := httptest.NewRecorder()
+
+	delivery.GetPolicy(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		FileTypes         []validate.FileType `json:"file_types"`
+		MaxObjectsPerTask int                 `json:"max_objects_per_task"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, policy.Types, response.FileTypes)
+	assert.Equal(t, 5, response.MaxObjectsPerTask)
+}
@@ -2,28 +2,71 @@ package app
 
 import (
 	"context"
+	"io"
+	"net/http"
+	"time"
 
 	"github.com/supchaser/test_task/internal/app/models"
+	"github.com/supchaser/test_task/internal/storage"
+	"github.com/supchaser/test_task/internal/utils/validate"
 )
 
 //go:generate mockgen -source=interfaces.go -destination=mocks/mock.go
 
+// Fetcher performs outbound requests for user-supplied URLs.
+type Fetcher interface {
+	Head(ctx context.Context, url string) (*http.Response, error)
+	Get(ctx context.Context, url string) (*http.Response, error)
+}
+
+// ArchiveStore keeps finished archives under keys like task_1.zip.
+type ArchiveStore interface {
+	// Put stores size bytes from r; the archive only becomes visible once
+	// all of them were written.
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Stat(ctx context.Context, key string) (storage.Info, error)
+	Delete(ctx context.Context, key string) error
+}
+
 type TaskRepository interface {
-	CreateTask(ctx context.Context) (*models.Task, error)
+	CreateTask(ctx context.Context, opts models.TaskOptions) (*models.Task, error)
 	GetTask(ctx context.Context, id int64) (*models.Task, error)
-	AddObject(ctx context.Context, taskID int64, url string) (*models.Task, error)
+	AddObject(ctx context.Context, taskID int64, url, name string) (*models.Task, error)
+	SetTaskPassword(ctx context.Context, id int64, password string) error
+	SetArchiveStats(ctx context.Context, id int64, stats models.ArchiveStats) error
 	UpdateTaskStatus(ctx context.Context, id int64, status models.TaskStatus) error
+	UpdateObject(ctx context.Context, taskID int64, object *models.Object) error
 	GetAllTasks(ctx context.Context) ([]*models.Task, error)
+	ExpireIdleTasks(ctx context.Context, idleTTL time.Duration) ([]int64, error)
+	DeleteTask(ctx context.Context, id int64) error
+	PurgeTasks(ctx context.Context, filter models.PurgeFilter) ([]*models.Task, error)
+	RetryTask(ctx context.Context, id int64, all bool) (*models.Task, error)
 	GetMaxTasks() int
+	GetMaxObjects() int
 	GetActiveTasksCount() int
+	GetQueuedTasksCount() int
+	EstimateRetryAfter() time.Duration
 }
 
 type TaskUsecase interface {
-	CreateTask(ctx context.Context) (*models.Task, error)
+	CreateTask(ctx context.Context, opts models.TaskOptions) (*models.Task, error)
 	GetTask(ctx context.Context, id int64) (*models.Task, error)
-	AddObject(ctx context.Context, taskID int64, url string) (*models.Task, error)
+	AddObject(ctx context.Context, taskID int64, url, name string) (*models.Task, error)
+	FinalizeTask(ctx context.Context, taskID int64, password string) (*models.Task, error)
+	CancelTask(ctx context.Context, taskID int64) (*models.Task, error)
+	DeleteTask(ctx context.Context, taskID int64) error
+	PurgeTasks(ctx context.Context, filter models.PurgeFilter) ([]int64, error)
+	RetryTask(ctx context.Context, taskID int64, all bool) (*models.Task, error)
+	StreamTask(ctx context.Context, taskID int64, w io.Writer) error
+	StreamArchive(ctx context.Context, req models.StreamRequest, w io.Writer) error
+	OpenArchive(ctx context.Context, taskID int64, version int) (*models.ArchiveFile, error)
 	GetTaskStatus(ctx context.Context, id int64) (*models.Task, error)
 	GetAllTasks(ctx context.Context) ([]*models.Task, error)
 	GetMaxTasks() int
+	GetMaxObjectsPerTask() int
+	GetFilePolicy() validate.Policy
 	GetActiveTasksCount() int
+	GetQueuedTasksCount() int
+	EstimateRetryAfter() time.Duration
 }
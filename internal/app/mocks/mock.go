@@ -6,12 +6,151 @@ package mock_app
 
 import (
 	context "context"
+	io "io"
+	http "net/http"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 	models "github.com/supchaser/test_task/internal/app/models"
+	storage "github.com/supchaser/test_task/internal/storage"
+	validate "github.com/supchaser/test_task/internal/utils/validate"
 )
 
+// MockFetcher is a mock of Fetcher interface.
+type MockFetcher struct {
+	ctrl     *gomock.Controller
+	recorder *MockFetcherMockRecorder
+}
+
+// MockFetcherMockRecorder is the mock recorder for MockFetcher.
+type MockFetcherMockRecorder struct {
+	mock *MockFetcher
+}
+
+// NewMockFetcher creates a new mock instance.
+func NewMockFetcher(ctrl *gomock.Controller) *MockFetcher {
+	mock := &MockFetcher{ctrl: ctrl}
+	mock.recorder = &MockFetcherMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockFetcher) EXPECT() *MockFetcherMockRecorder {
+	return m.recorder
+}
+
+// Get mocks base method.
+func (m *MockFetcher) Get(ctx context.Context, url string) (*http.Response, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", ctx, url)
+	ret0, _ := ret[0].(*http.Response)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockFetcherMockRecorder) Get(ctx, url interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockFetcher)(nil).Get), ctx, url)
+}
+
+// Head mocks base method.
+func (m *MockFetcher) Head(ctx context.Context, url string) (*http.Response, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Head", ctx, url)
+	ret0, _ := ret[0].(*http.Response)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Head indicates an expected call of Head.
+func (mr *MockFetcherMockRecorder) Head(ctx, url interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Head", reflect.TypeOf((*MockFetcher)(nil).Head), ctx, url)
+}
+
+// MockArchiveStore is a mock of ArchiveStore interface.
+type MockArchiveStore struct {
+	ctrl     *gomock.Controller
+	recorder *MockArchiveStoreMockRecorder
+}
+
+// MockArchiveStoreMockRecorder is the mock recorder for MockArchiveStore.
+type MockArchiveStoreMockRecorder struct {
+	mock *MockArchiveStore
+}
+
+// NewMockArchiveStore creates a new mock instance.
+func NewMockArchiveStore(ctrl *gomock.Controller) *MockArchiveStore {
+	mock := &MockArchiveStore{ctrl: ctrl}
+	mock.recorder = &MockArchiveStoreMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockArchiveStore) EXPECT() *MockArchiveStoreMockRecorder {
+	return m.recorder
+}
+
+// Delete mocks base method.
+func (m *MockArchiveStore) Delete(ctx context.Context, key string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", ctx, key)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockArchiveStoreMockRecorder) Delete(ctx, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockArchiveStore)(nil).Delete), ctx, key)
+}
+
+// Open mocks base method.
+func (m *MockArchiveStore) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Open", ctx, key)
+	ret0, _ := ret[0].(io.ReadCloser)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Open indicates an expected call of Open.
+func (mr *MockArchiveStoreMockRecorder) Open(ctx, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Open", reflect.TypeOf((*MockArchiveStore)(nil).Open), ctx, key)
+}
+
+// Put mocks base method.
+func (m *MockArchiveStore) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Put", ctx, key, r, size)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Put indicates an expected call of Put.
+func (mr *MockArchiveStoreMockRecorder) Put(ctx, key, r, size interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Put", reflect.TypeOf((*MockArchiveStore)(nil).Put), ctx, key, r, size)
+}
+
+// Stat mocks base method.
+func (m *MockArchiveStore) Stat(ctx context.Context, key string) (storage.Info, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Stat", ctx, key)
+	ret0, _ := ret[0].(storage.Info)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Stat indicates an expected call of Stat.
+func (mr *MockArchiveStoreMockRecorder) Stat(ctx, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stat", reflect.TypeOf((*MockArchiveStore)(nil).Stat), ctx, key)
+}
+
 // MockTaskRepository is a mock of TaskRepository interface.
 type MockTaskRepository struct {
 	ctrl     *gomock.Controller
@@ -36,33 +175,76 @@ func (m *MockTaskRepository) EXPECT() *MockTaskRepositoryMockRecorder {
 }
 
 // AddObject mocks base method.
-func (m *MockTaskRepository) AddObject(ctx context.Context, taskID int64, url string) (*models.Task, error) {
+func (m *MockTaskRepository) AddObject(ctx context.Context, taskID int64, url, name string) (*models.Task, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "AddObject", ctx, taskID, url)
+	ret := m.ctrl.Call(m, "AddObject", ctx, taskID, url, name)
 	ret0, _ := ret[0].(*models.Task)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // AddObject indicates an expected call of AddObject.
-func (mr *MockTaskRepositoryMockRecorder) AddObject(ctx, taskID, url interface{}) *gomock.Call {
+func (mr *MockTaskRepositoryMockRecorder) AddObject(ctx, taskID, url, name interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddObject", reflect.TypeOf((*MockTaskRepository)(nil).AddObject), ctx, taskID, url)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddObject", reflect.TypeOf((*MockTaskRepository)(nil).AddObject), ctx, taskID, url, name)
 }
 
 // CreateTask mocks base method.
-func (m *MockTaskRepository) CreateTask(ctx context.Context) (*models.Task, error) {
+func (m *MockTaskRepository) CreateTask(ctx context.Context, opts models.TaskOptions) (*models.Task, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CreateTask", ctx)
+	ret := m.ctrl.Call(m, "CreateTask", ctx, opts)
 	ret0, _ := ret[0].(*models.Task)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // CreateTask indicates an expected call of CreateTask.
-func (mr *MockTaskRepositoryMockRecorder) CreateTask(ctx interface{}) *gomock.Call {
+func (mr *MockTaskRepositoryMockRecorder) CreateTask(ctx, opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateTask", reflect.TypeOf((*MockTaskRepository)(nil).CreateTask), ctx, opts)
+}
+
+// DeleteTask mocks base method.
+func (m *MockTaskRepository) DeleteTask(ctx context.Context, id int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteTask", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteTask indicates an expected call of DeleteTask.
+func (mr *MockTaskRepositoryMockRecorder) DeleteTask(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteTask", reflect.TypeOf((*MockTaskRepository)(nil).DeleteTask), ctx, id)
+}
+
+// EstimateRetryAfter mocks base method.
+func (m *MockTaskRepository) EstimateRetryAfter() time.Duration {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EstimateRetryAfter")
+	ret0, _ := ret[0].(time.Duration)
+	return ret0
+}
+
+// EstimateRetryAfter indicates an expected call of EstimateRetryAfter.
+func (mr *MockTaskRepositoryMockRecorder) EstimateRetryAfter() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EstimateRetryAfter", reflect.TypeOf((*MockTaskRepository)(nil).EstimateRetryAfter))
+}
+
+// ExpireIdleTasks mocks base method.
+func (m *MockTaskRepository) ExpireIdleTasks(ctx context.Context, idleTTL time.Duration) ([]int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExpireIdleTasks", ctx, idleTTL)
+	ret0, _ := ret[0].([]int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExpireIdleTasks indicates an expected call of ExpireIdleTasks.
+func (mr *MockTaskRepositoryMockRecorder) ExpireIdleTasks(ctx, idleTTL interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateTask", reflect.TypeOf((*MockTaskRepository)(nil).CreateTask), ctx)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExpireIdleTasks", reflect.TypeOf((*MockTaskRepository)(nil).ExpireIdleTasks), ctx, idleTTL)
 }
 
 // GetActiveTasksCount mocks base method.
@@ -94,6 +276,20 @@ func (mr *MockTaskRepositoryMockRecorder) GetAllTasks(ctx interface{}) *gomock.C
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllTasks", reflect.TypeOf((*MockTaskRepository)(nil).GetAllTasks), ctx)
 }
 
+// GetMaxObjects mocks base method.
+func (m *MockTaskRepository) GetMaxObjects() int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMaxObjects")
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// GetMaxObjects indicates an expected call of GetMaxObjects.
+func (mr *MockTaskRepositoryMockRecorder) GetMaxObjects() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMaxObjects", reflect.TypeOf((*MockTaskRepository)(nil).GetMaxObjects))
+}
+
 // GetMaxTasks mocks base method.
 func (m *MockTaskRepository) GetMaxTasks() int {
 	m.ctrl.T.Helper()
@@ -108,6 +304,20 @@ func (mr *MockTaskRepositoryMockRecorder) GetMaxTasks() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMaxTasks", reflect.TypeOf((*MockTaskRepository)(nil).GetMaxTasks))
 }
 
+// GetQueuedTasksCount mocks base method.
+func (m *MockTaskRepository) GetQueuedTasksCount() int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetQueuedTasksCount")
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// GetQueuedTasksCount indicates an expected call of GetQueuedTasksCount.
+func (mr *MockTaskRepositoryMockRecorder) GetQueuedTasksCount() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetQueuedTasksCount", reflect.TypeOf((*MockTaskRepository)(nil).GetQueuedTasksCount))
+}
+
 // GetTask mocks base method.
 func (m *MockTaskRepository) GetTask(ctx context.Context, id int64) (*models.Task, error) {
 	m.ctrl.T.Helper()
@@ -123,6 +333,78 @@ func (mr *MockTaskRepositoryMockRecorder) GetTask(ctx, id interface{}) *gomock.C
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTask", reflect.TypeOf((*MockTaskRepository)(nil).GetTask), ctx, id)
 }
 
+// PurgeTasks mocks base method.
+func (m *MockTaskRepository) PurgeTasks(ctx context.Context, filter models.PurgeFilter) ([]*models.Task, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgeTasks", ctx, filter)
+	ret0, _ := ret[0].([]*models.Task)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PurgeTasks indicates an expected call of PurgeTasks.
+func (mr *MockTaskRepositoryMockRecorder) PurgeTasks(ctx, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeTasks", reflect.TypeOf((*MockTaskRepository)(nil).PurgeTasks), ctx, filter)
+}
+
+// RetryTask mocks base method.
+func (m *MockTaskRepository) RetryTask(ctx context.Context, id int64, all bool) (*models.Task, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RetryTask", ctx, id, all)
+	ret0, _ := ret[0].(*models.Task)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RetryTask indicates an expected call of RetryTask.
+func (mr *MockTaskRepositoryMockRecorder) RetryTask(ctx, id, all interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RetryTask", reflect.TypeOf((*MockTaskRepository)(nil).RetryTask), ctx, id, all)
+}
+
+// SetArchiveStats mocks base method.
+func (m *MockTaskRepository) SetArchiveStats(ctx context.Context, id int64, stats models.ArchiveStats) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetArchiveStats", ctx, id, stats)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetArchiveStats indicates an expected call of SetArchiveStats.
+func (mr *MockTaskRepositoryMockRecorder) SetArchiveStats(ctx, id, stats interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetArchiveStats", reflect.TypeOf((*MockTaskRepository)(nil).SetArchiveStats), ctx, id, stats)
+}
+
+// SetTaskPassword mocks base method.
+func (m *MockTaskRepository) SetTaskPassword(ctx context.Context, id int64, password string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetTaskPassword", ctx, id, password)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetTaskPassword indicates an expected call of SetTaskPassword.
+func (mr *MockTaskRepositoryMockRecorder) SetTaskPassword(ctx, id, password interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetTaskPassword", reflect.TypeOf((*MockTaskRepository)(nil).SetTaskPassword), ctx, id, password)
+}
+
+// UpdateObject mocks base method.
+func (m *MockTaskRepository) UpdateObject(ctx context.Context, taskID int64, object *models.Object) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateObject", ctx, taskID, object)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateObject indicates an expected call of UpdateObject.
+func (mr *MockTaskRepositoryMockRecorder) UpdateObject(ctx, taskID, object interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateObject", reflect.TypeOf((*MockTaskRepository)(nil).UpdateObject), ctx, taskID, object)
+}
+
 // UpdateTaskStatus mocks base method.
 func (m *MockTaskRepository) UpdateTaskStatus(ctx context.Context, id int64, status models.TaskStatus) error {
 	m.ctrl.T.Helper()
@@ -161,33 +443,91 @@ func (m *MockTaskUsecase) EXPECT() *MockTaskUsecaseMockRecorder {
 }
 
 // AddObject mocks base method.
-func (m *MockTaskUsecase) AddObject(ctx context.Context, taskID int64, url string) (*models.Task, error) {
+func (m *MockTaskUsecase) AddObject(ctx context.Context, taskID int64, url, name string) (*models.Task, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "AddObject", ctx, taskID, url)
+	ret := m.ctrl.Call(m, "AddObject", ctx, taskID, url, name)
 	ret0, _ := ret[0].(*models.Task)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // AddObject indicates an expected call of AddObject.
-func (mr *MockTaskUsecaseMockRecorder) AddObject(ctx, taskID, url interface{}) *gomock.Call {
+func (mr *MockTaskUsecaseMockRecorder) AddObject(ctx, taskID, url, name interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddObject", reflect.TypeOf((*MockTaskUsecase)(nil).AddObject), ctx, taskID, url)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddObject", reflect.TypeOf((*MockTaskUsecase)(nil).AddObject), ctx, taskID, url, name)
+}
+
+// CancelTask mocks base method.
+func (m *MockTaskUsecase) CancelTask(ctx context.Context, taskID int64) (*models.Task, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CancelTask", ctx, taskID)
+	ret0, _ := ret[0].(*models.Task)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CancelTask indicates an expected call of CancelTask.
+func (mr *MockTaskUsecaseMockRecorder) CancelTask(ctx, taskID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CancelTask", reflect.TypeOf((*MockTaskUsecase)(nil).CancelTask), ctx, taskID)
 }
 
 // CreateTask mocks base method.
-func (m *MockTaskUsecase) CreateTask(ctx context.Context) (*models.Task, error) {
+func (m *MockTaskUsecase) CreateTask(ctx context.Context, opts models.TaskOptions) (*models.Task, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CreateTask", ctx)
+	ret := m.ctrl.Call(m, "CreateTask", ctx, opts)
 	ret0, _ := ret[0].(*models.Task)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // CreateTask indicates an expected call of CreateTask.
-func (mr *MockTaskUsecaseMockRecorder) CreateTask(ctx interface{}) *gomock.Call {
+func (mr *MockTaskUsecaseMockRecorder) CreateTask(ctx, opts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateTask", reflect.TypeOf((*MockTaskUsecase)(nil).CreateTask), ctx, opts)
+}
+
+// DeleteTask mocks base method.
+func (m *MockTaskUsecase) DeleteTask(ctx context.Context, taskID int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteTask", ctx, taskID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteTask indicates an expected call of DeleteTask.
+func (mr *MockTaskUsecaseMockRecorder) DeleteTask(ctx, taskID interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateTask", reflect.TypeOf((*MockTaskUsecase)(nil).CreateTask), ctx)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteTask", reflect.TypeOf((*MockTaskUsecase)(nil).DeleteTask), ctx, taskID)
+}
+
+// EstimateRetryAfter mocks base method.
+func (m *MockTaskUsecase) EstimateRetryAfter() time.Duration {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EstimateRetryAfter")
+	ret0, _ := ret[0].(time.Duration)
+	return ret0
+}
+
+// EstimateRetryAfter indicates an expected call of EstimateRetryAfter.
+func (mr *MockTaskUsecaseMockRecorder) EstimateRetryAfter() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EstimateRetryAfter", reflect.TypeOf((*MockTaskUsecase)(nil).EstimateRetryAfter))
+}
+
+// FinalizeTask mocks base method.
+func (m *MockTaskUsecase) FinalizeTask(ctx context.Context, taskID int64, password string) (*models.Task, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FinalizeTask", ctx, taskID, password)
+	ret0, _ := ret[0].(*models.Task)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FinalizeTask indicates an expected call of FinalizeTask.
+func (mr *MockTaskUsecaseMockRecorder) FinalizeTask(ctx, taskID, password interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FinalizeTask", reflect.TypeOf((*MockTaskUsecase)(nil).FinalizeTask), ctx, taskID, password)
 }
 
 // GetActiveTasksCount mocks base method.
@@ -219,6 +559,34 @@ func (mr *MockTaskUsecaseMockRecorder) GetAllTasks(ctx interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllTasks", reflect.TypeOf((*MockTaskUsecase)(nil).GetAllTasks), ctx)
 }
 
+// GetFilePolicy mocks base method.
+func (m *MockTaskUsecase) GetFilePolicy() validate.Policy {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetFilePolicy")
+	ret0, _ := ret[0].(validate.Policy)
+	return ret0
+}
+
+// GetFilePolicy indicates an expected call of GetFilePolicy.
+func (mr *MockTaskUsecaseMockRecorder) GetFilePolicy() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetFilePolicy", reflect.TypeOf((*MockTaskUsecase)(nil).GetFilePolicy))
+}
+
+// GetMaxObjectsPerTask mocks base method.
+func (m *MockTaskUsecase) GetMaxObjectsPerTask() int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMaxObjectsPerTask")
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// GetMaxObjectsPerTask indicates an expected call of GetMaxObjectsPerTask.
+func (mr *MockTaskUsecaseMockRecorder) GetMaxObjectsPerTask() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMaxObjectsPerTask", reflect.TypeOf((*MockTaskUsecase)(nil).GetMaxObjectsPerTask))
+}
+
 // GetMaxTasks mocks base method.
 func (m *MockTaskUsecase) GetMaxTasks() int {
 	m.ctrl.T.Helper()
@@ -233,6 +601,20 @@ func (mr *MockTaskUsecaseMockRecorder) GetMaxTasks() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMaxTasks", reflect.TypeOf((*MockTaskUsecase)(nil).GetMaxTasks))
 }
 
+// GetQueuedTasksCount mocks base method.
+func (m *MockTaskUsecase) GetQueuedTasksCount() int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetQueuedTasksCount")
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// GetQueuedTasksCount indicates an expected call of GetQueuedTasksCount.
+func (mr *MockTaskUsecaseMockRecorder) GetQueuedTasksCount() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetQueuedTasksCount", reflect.TypeOf((*MockTaskUsecase)(nil).GetQueuedTasksCount))
+}
+
 // GetTask mocks base method.
 func (m *MockTaskUsecase) GetTask(ctx context.Context, id int64) (*models.Task, error) {
 	m.ctrl.T.Helper()
@@ -262,3 +644,76 @@ func (mr *MockTaskUsecaseMockRecorder) GetTaskStatus(ctx, id interface{}) *gomoc
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTaskStatus", reflect.TypeOf((*MockTaskUsecase)(nil).GetTaskStatus), ctx, id)
 }
+
+// OpenArchive mocks base method.
+func (m *MockTaskUsecase) OpenArchive(ctx context.Context, taskID int64, version int) (*models.ArchiveFile, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "OpenArchive", ctx, taskID, version)
+	ret0, _ := ret[0].(*models.ArchiveFile)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// OpenArchive indicates an expected call of OpenArchive.
+func (mr *MockTaskUsecaseMockRecorder) OpenArchive(ctx, taskID, version interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OpenArchive", reflect.TypeOf((*MockTaskUsecase)(nil).OpenArchive), ctx, taskID, version)
+}
+
+// PurgeTasks mocks base method.
+func (m *MockTaskUsecase) PurgeTasks(ctx context.Context, filter models.PurgeFilter) ([]int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgeTasks", ctx, filter)
+	ret0, _ := ret[0].([]int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PurgeTasks indicates an expected call of PurgeTasks.
+func (mr *MockTaskUsecaseMockRecorder) PurgeTasks(ctx, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeTasks", reflect.TypeOf((*MockTaskUsecase)(nil).PurgeTasks), ctx, filter)
+}
+
+// RetryTask mocks base method.
+func (m *MockTaskUsecase) RetryTask(ctx context.Context, taskID int64, all bool) (*models.Task, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RetryTask", ctx, taskID, all)
+	ret0, _ := ret[0].(*models.Task)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RetryTask indicates an expected call of RetryTask.
+func (mr *MockTaskUsecaseMockRecorder) RetryTask(ctx, taskID, all interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RetryTask", reflect.TypeOf((*MockTaskUsecase)(nil).RetryTask), ctx, taskID, all)
+}
+
+// StreamArchive mocks base method.
+func (m *MockTaskUsecase) StreamArchive(ctx context.Context, req models.StreamRequest, w io.Writer) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StreamArchive", ctx, req, w)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// StreamArchive indicates an expected call of StreamArchive.
+func (mr *MockTaskUsecaseMockRecorder) StreamArchive(ctx, req, w interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StreamArchive", reflect.TypeOf((*MockTaskUsecase)(nil).StreamArchive), ctx, req, w)
+}
+
+// StreamTask mocks base method.
+func (m *MockTaskUsecase) StreamTask(ctx context.Context, taskID int64, w io.Writer) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StreamTask", ctx, taskID, w)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// StreamTask indicates an expected call of StreamTask.
+func (mr *MockTaskUsecaseMockRecorder) StreamTask(ctx, taskID, w interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StreamTask", reflect.TypeOf((*MockTaskUsecase)(nil).StreamTask), ctx, taskID, w)
+}
@@ -1,38 +1,223 @@
 package models
 
-import "time"
+import (
+	"io"
+	"slices"
+	"time"
+)
 
 type TaskStatus string
 
 const (
+	StatusQueued     TaskStatus = "queued"
 	StatusWaiting    TaskStatus = "waiting"
 	StatusProcessing TaskStatus = "processing"
 	StatusDone       TaskStatus = "done"
 	StatusFailed     TaskStatus = "failed"
+	StatusExpired    TaskStatus = "expired"
+	// StatusInterrupted marks a task whose archive job was stopped by a
+	// shutdown. It keeps its slot and is resumed on the next start.
+	StatusInterrupted TaskStatus = "interrupted"
+	// StatusCancelled is final: nothing may change the status of a
+	// cancelled task.
+	StatusCancelled TaskStatus = "cancelled"
 )
 
+// IsActive reports whether a task in this status holds an active slot.
+func (s TaskStatus) IsActive() bool {
+	return s == StatusWaiting || s == StatusProcessing || s == StatusInterrupted
+}
+
+// IsFinished reports whether the task has reached a terminal status.
+func (s TaskStatus) IsFinished() bool {
+	return s == StatusDone || s == StatusFailed || s == StatusExpired || s == StatusCancelled
+}
+
 type Task struct {
-	ID        int64
-	Status    TaskStatus
-	Objects   []*Object
-	CreatedAt time.Time
+	ID               int64
+	Status           TaskStatus
+	Format           string `json:",omitempty"`
+	Encrypted        bool   `json:",omitempty"`
+	Compression      string `json:",omitempty"`
+	CompressionLevel *int   `json:",omitempty"`
+	Objects          []*Object
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	FinishedAt       *time.Time `json:",omitempty"`
+	QueuePosition    int        `json:",omitempty"`
+	EstimatedStartAt *time.Time `json:",omitempty"`
+	// Stats describes the finished archive.
+	Stats *ArchiveStats `json:",omitempty"`
+	// ArchiveVersion is bumped by every retry; zero means the first archive.
+	ArchiveVersion int `json:",omitempty"`
+	// Password encrypts the archive. It is never sent to clients, the
+	// repository journal keeps it next to the task.
+	Password string `json:"-"`
 }
 
+// Clone returns a deep copy of the task that can be read without holding the repository lock.
+func (t *Task) Clone() *Task {
+	clone := *t
+	clone.Objects = make([]*Object, len(t.Objects))
+	for i, obj := range t.Objects {
+		o := *obj
+		o.Attempts = slices.Clone(obj.Attempts)
+		clone.Objects[i] = &o
+	}
+	if t.FinishedAt != nil {
+		at := *t.FinishedAt
+		clone.FinishedAt = &at
+	}
+	if t.EstimatedStartAt != nil {
+		at := *t.EstimatedStartAt
+		clone.EstimatedStartAt = &at
+	}
+	if t.CompressionLevel != nil {
+		level := *t.CompressionLevel
+		clone.CompressionLevel = &level
+	}
+	if t.Stats != nil {
+		stats := *t.Stats
+		clone.Stats = &stats
+	}
+	return &clone
+}
+
+type ObjectState string
+
+const (
+	ObjectPending     ObjectState = "pending"
+	ObjectDownloading ObjectState = "downloading"
+	ObjectArchived    ObjectState = "archived"
+	ObjectFailed      ObjectState = "failed"
+)
+
 type Object struct {
-	ID    int64
-	URL   string
-	Error string
+	ID  int64
+	URL string
+	// Name is the file name requested by the client, ArchiveName the name
+	// the object actually got inside the archive.
+	Name        string `json:",omitempty"`
+	ArchiveName string `json:",omitempty"`
+	Error       string
+	State       ObjectState `json:",omitempty"`
+	HTTPStatus  int         `json:",omitempty"`
+	// Size is the Content-Length seen by the probe until the object is
+	// downloaded, then the number of bytes actually received.
+	Size        int64     `json:",omitempty"`
+	ContentType string    `json:",omitempty"`
+	SHA256      string    `json:",omitempty"`
+	DurationMs  int64     `json:",omitempty"`
+	Attempts    []Attempt `json:",omitempty"`
+}
+
+type AttemptPhase string
+
+const (
+	PhaseProbe    AttemptPhase = "probe"
+	PhaseDownload AttemptPhase = "download"
+)
+
+// Attempt is one network request made for an object.
+type Attempt struct {
+	Phase      AttemptPhase
+	Number     int
+	StartedAt  time.Time
+	HTTPStatus int    `json:",omitempty"`
+	Error      string `json:",omitempty"`
+}
+
+// TaskOptions are the archive settings a client may choose when creating a task.
+type TaskOptions struct {
+	// Format is the archive format: zip (default), tar, tar.gz or tar.zst.
+	Format string `json:"format,omitempty"`
+	// Password encrypts every zip entry with AES-256.
+	Password string `json:"password,omitempty"`
+	// Compression is store, deflate or auto; empty means the server default.
+	Compression string `json:"compression,omitempty"`
+	// CompressionLevel is -1 (default) or 0..9; nil means the server default.
+	CompressionLevel *int `json:"compression_level,omitempty"`
+}
+
+// ArchiveStats compares the size of the archived files with the archive.
+type ArchiveStats struct {
+	ContentSize int64
+	ArchiveSize int64
+	// SavedRatio is the share of ContentSize saved by compression; it is
+	// negative when the archive overhead outweighs the savings.
+	SavedRatio float64
+	// Streamed archives were sent to the client while being built and are
+	// not stored.
+	Streamed bool `json:",omitempty"`
+}
+
+// StreamRequest describes a one-off archive that is streamed to the client
+// without creating a task.
+type StreamRequest struct {
+	Request
+	TaskOptions
+}
+
+// ArchiveFile is a stored archive opened for download. The caller closes Body.
+type ArchiveFile struct {
+	Name        string
+	ContentType string
+	Size        int64
+	ModTime     time.Time
+	Body        io.ReadCloser
+}
+
+// PurgeFilter selects finished tasks to delete. A zero field matches every
+// finished task.
+type PurgeFilter struct {
+	// Statuses limits the purge to tasks in one of these finished statuses.
+	Statuses []TaskStatus
+	// FinishedBefore matches tasks that finished before this moment.
+	FinishedBefore time.Time
+}
+
+// Matches reports whether the finished task falls under the filter.
+func (f PurgeFilter) Matches(task *Task) bool {
+	if !task.Status.IsFinished() {
+		return false
+	}
+	if len(f.Statuses) > 0 && !slices.Contains(f.Statuses, task.Status) {
+		return false
+	}
+	if !f.FinishedBefore.IsZero() {
+		finishedAt := task.UpdatedAt
+		if task.FinishedAt != nil {
+			finishedAt = *task.FinishedAt
+		}
+		if !finishedAt.Before(f.FinishedBefore) {
+			return false
+		}
+	}
+	return true
+}
+
+type FinalizeRequest struct {
+	Password string `json:"password,omitempty"`
+}
+
+// RetryRequest asks to download every object again rather than only the
+// failed ones.
+type RetryRequest struct {
+	All bool `json:"all,omitempty"`
 }
 
 type Request struct {
 	URLs []string `json:"urls"`
+	// Names optionally maps a URL to the file name it gets in the archive.
+	Names map[string]string `json:"names,omitempty"`
 }
 
 type TaskResponse struct {
-	ID           int64      `json:"id"`
-	Status       TaskStatus `json:"status"`
-	CreatedAt    time.Time  `json:"created_at"`
-	ObjectsCount int        `json:"objects_count"`
+	ID            int64      `json:"id"`
+	Status        TaskStatus `json:"status"`
+	CreatedAt     time.Time  `json:"created_at"`
+	ObjectsCount  int        `json:"objects_count"`
+	QueuePosition int        `json:"queue_position,omitempty"`
 }
 
 type MultiAddResult struct {
@@ -40,3 +225,25 @@ type MultiAddResult struct {
 	FailedURLs   map[string]string `json:"failed_urls"`
 	TotalObjects int               `json:"total_objects"`
 }
+
+// Manifest describes the contents of an archive; it is stored inside the
+// archive as manifest.json. One-off streamed archives have no task ID.
+type Manifest struct {
+	TaskID    int64           `json:"task_id,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+	Archived  int             `json:"archived"`
+	Failed    int             `json:"failed"`
+	Objects   []ManifestEntry `json:"objects"`
+}
+
+type ManifestEntry struct {
+	URL         string      `json:"url"`
+	Name        string      `json:"name,omitempty"`
+	State       ObjectState `json:"state"`
+	Size        int64       `json:"size,omitempty"`
+	SHA256      string      `json:"sha256,omitempty"`
+	ContentType string      `json:"content_type,omitempty"`
+	DurationMs  int64       `json:"duration_ms,omitempty"`
+	Attempts    int         `json:"attempts,omitempty"`
+	Error       string      `json:"error,omitempty"`
+}
@@ -0,0 +1,250 @@
+package repository
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/supchaser/test_task/internal/app/models"
+	"github.com/supchaser/test_task/internal/utils/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	snapshotFileName = "snapshot.json"
+	journalFileName  = "journal.log"
+
+	// compactThreshold is the number of journal records after which the
+	// journal is folded into a fresh snapshot.
+	compactThreshold = 1000
+)
+
+const (
+	opPut    = "put"
+	opDelete = "delete"
+)
+
+type journalRecord struct {
+	Op   string      `json:"op"`
+	ID   int64       `json:"id"`
+	Task *storedTask `json:"task,omitempty"`
+}
+
+// storedTask is a task as it is written to disk. models.Task hides the
+// archive password from JSON so it never reaches clients, but a task
+// resumed after a restart still has to be encrypted with it.
+type storedTask struct {
+	*models.Task
+	Password string `json:"password,omitempty"`
+}
+
+func newStoredTask(task *models.Task) *storedTask {
+	return &storedTask{Task: task, Password: task.Password}
+}
+
+func (s *storedTask) restore() *models.Task {
+	s.Task.Password = s.Password
+	return s.Task
+}
+
+// journal is an append-only log of task changes on top of a periodic snapshot.
+// Every record carries the full task state, so replay is just "last write wins".
+type journal struct {
+	dir     string
+	file    *os.File
+	records int
+}
+
+func openJournal(dir string) (*journal, map[int64]*models.Task, error) {
+	// the journal keeps archive passwords, so only the owner may read it
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, nil, fmt.Errorf("create data directory: %w", err)
+	}
+
+	tasks, err := readSnapshot(filepath.Join(dir, snapshotFileName))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	records, err := replayJournal(filepath.Join(dir, journalFileName), tasks)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	file, err := os.OpenFile(filepath.Join(dir, journalFileName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, nil, fmt.Errorf("open journal: %w", err)
+	}
+	// a journal written by an older version may still be world-readable
+	if err := file.Chmod(0o600); err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("restrict journal permissions: %w", err)
+	}
+
+	return &journal{
+		dir:     dir,
+		file:    file,
+		records: records,
+	}, tasks, nil
+}
+
+func readSnapshot(path string) (map[int64]*models.Task, error) {
+	tasks := make(map[int64]*models.Task)
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return tasks, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read snapshot: %w", err)
+	}
+
+	var list []*storedTask
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("decode snapshot: %w", err)
+	}
+
+	for _, stored := range list {
+		task := stored.restore()
+		tasks[task.ID] = task
+	}
+
+	return tasks, nil
+}
+
+func replayJournal(path string, tasks map[int64]*models.Task) (int, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("open journal for replay: %w", err)
+	}
+	defer file.Close()
+
+	records := 0
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) > 0 {
+				// a torn write from a crash: everything before it is intact
+				logger.Warn("ignoring incomplete journal record",
+					zap.String("path", path),
+					zap.Int("bytes", len(line)),
+				)
+			}
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("read journal: %w", err)
+		}
+
+		var rec journalRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return 0, fmt.Errorf("decode journal record %d: %w", records+1, err)
+		}
+
+		switch rec.Op {
+		case opPut:
+			tasks[rec.ID] = rec.Task.restore()
+		case opDelete:
+			delete(tasks, rec.ID)
+		default:
+			return 0, fmt.Errorf("unknown journal op %q", rec.Op)
+		}
+		records++
+	}
+
+	return records, nil
+}
+
+func (j *journal) put(task *models.Task) error {
+	return j.append(journalRecord{Op: opPut, ID: task.ID, Task: newStoredTask(task)})
+}
+
+func (j *journal) delete(id int64) error {
+	return j.append(journalRecord{Op: opDelete, ID: id})
+}
+
+func (j *journal) append(rec journalRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("encode journal record: %w", err)
+	}
+	data = append(data, '\n')
+
+	if _, err := j.file.Write(data); err != nil {
+		return fmt.Errorf("write journal record: %w", err)
+	}
+	if err := j.file.Sync(); err != nil {
+		return fmt.Errorf("sync journal: %w", err)
+	}
+
+	j.records++
+	return nil
+}
+
+func (j *journal) needsCompaction() bool {
+	return j.records >= compactThreshold
+}
+
+// compact writes all tasks into a new snapshot and truncates the journal.
+// The snapshot is replaced atomically, so a crash at any point leaves either
+// the old snapshot plus the full journal or the new snapshot.
+func (j *journal) compact(tasks map[int64]*models.Task) error {
+	list := make([]*storedTask, 0, len(tasks))
+	for _, task := range tasks {
+		list = append(list, newStoredTask(task))
+	}
+
+	data, err := json.Marshal(list)
+	if err != nil {
+		return fmt.Errorf("encode snapshot: %w", err)
+	}
+
+	snapshotPath := filepath.Join(j.dir, snapshotFileName)
+	tmpPath := snapshotPath + ".tmp"
+	if err := writeFileSync(tmpPath, data); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, snapshotPath); err != nil {
+		return fmt.Errorf("replace snapshot: %w", err)
+	}
+
+	if err := j.file.Truncate(0); err != nil {
+		return fmt.Errorf("truncate journal: %w", err)
+	}
+	if err := j.file.Sync(); err != nil {
+		return fmt.Errorf("sync journal: %w", err)
+	}
+
+	j.records = 0
+	return nil
+}
+
+func (j *journal) close() error {
+	return j.file.Close()
+}
+
+func writeFileSync(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("create %s: %w", path, err)
+	}
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("sync %s: %w", path, err)
+	}
+
+	return file.Close()
+}
@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/supchaser/test_task/internal/app/models"
+	"github.com/supchaser/test_task/internal/utils/errs"
+	"github.com/supchaser/test_task/internal/utils/logger"
+	"github.com/supchaser/test_task/internal/utils/retry"
+	"github.com/supchaser/test_task/internal/utils/validate"
+	"go.uber.org/zap"
+)
+
+// probe checks with HEAD requests that the file is reachable, retrying
+// transient failures. It returns every attempt made and the size declared
+// by Content-Length, 0 if unknown.
+func (r *TaskRepository) probe(ctx context.Context, taskID int64, url string) ([]models.Attempt, int64, error) {
+	const funcName = "TaskRepository.probe"
+
+	attempts := make([]models.Attempt, 0, 1)
+	var size int64
+	err := r.retryPolicy.Do(ctx, func(number int) error {
+		attempt := models.Attempt{
+			Phase:     models.PhaseProbe,
+			Number:    number,
+			StartedAt: time.Now(),
+		}
+		var err error
+		size, err = r.probeOnce(ctx, url, &attempt)
+		if err != nil {
+			attempt.Error = err.Error()
+			logger.Warn("file unavailable",
+				zap.String("function", funcName),
+				zap.Int64("task_id", taskID),
+				zap.String("url", url),
+				zap.Int("attempt", number),
+				zap.Int("status_code", attempt.HTTPStatus),
+				zap.Error(err),
+			)
+		}
+		attempts = append(attempts, attempt)
+		return err
+	})
+	if errors.Is(err, errs.ErrForbiddenURL) ||
+		errors.Is(err, errs.ErrInvalidFileType) ||
+		errors.Is(err, errs.ErrFileTooLarge) {
+		return attempts, 0, err
+	}
+	if err != nil {
+		return attempts, 0, fmt.Errorf("%w: %w", errs.ErrFileUnavailable, err)
+	}
+
+	return attempts, size, nil
+}
+
+func (r *TaskRepository) probeOnce(ctx context.Context, url string, attempt *models.Attempt) (int64, error) {
+	resp, err := r.fetcher.Head(ctx, url)
+	if err != nil {
+		if retry.IsRetryableError(ctx, err) {
+			return 0, retry.Retryable(err, 0)
+		}
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	attempt.HTTPStatus = resp.StatusCode
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("invalid status code: %d", resp.StatusCode)
+		if retry.IsRetryableStatus(resp.StatusCode) {
+			return 0, retry.Retryable(err, retry.ParseRetryAfter(resp.Header.Get("Retry-After")))
+		}
+		return 0, err
+	}
+
+	// the body is not fetched here, so only what the headers declare is
+	// checked; magic bytes are verified while downloading
+	declared := r.filePolicy.DeclaredType(resp.Header, url)
+	if err := r.filePolicy.ValidateDeclaredType(declared); err != nil {
+		return 0, err
+	}
+
+	size := max(resp.ContentLength, 0)
+	if err := r.filePolicy.ValidateSize(declared, size); err != nil {
+		return 0, err
+	}
+	if err := validate.ValidateObjectSize(size, r.maxObjectSize); err != nil {
+		return 0, err
+	}
+
+	return size, nil
+}
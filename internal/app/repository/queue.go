@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"slices"
+	"time"
+)
+
+const (
+	// defaultSlotEstimate is used for wait estimates until the first task has released its slot.
+	defaultSlotEstimate = time.Minute
+	// slotTimeWeight is the weight of the newest sample in the moving average of slot hold time.
+	slotTimeWeight = 0.2
+)
+
+// admissionQueue keeps tasks that were accepted while every active slot was
+// busy, and tracks how long slots are usually held to estimate wait times.
+// It is not safe for concurrent use; TaskRepository guards it with its mutex.
+type admissionQueue struct {
+	ids        []int64
+	maxSize    int
+	acquiredAt map[int64]time.Time
+	avgHold    time.Duration
+}
+
+func newAdmissionQueue() *admissionQueue {
+	return &admissionQueue{
+		ids:        make([]int64, 0),
+		acquiredAt: make(map[int64]time.Time),
+	}
+}
+
+func (q *admissionQueue) len() int {
+	return len(q.ids)
+}
+
+func (q *admissionQueue) full() bool {
+	return len(q.ids) >= q.maxSize
+}
+
+func (q *admissionQueue) push(id int64) {
+	q.ids = append(q.ids, id)
+}
+
+func (q *admissionQueue) pushFront(id int64) {
+	q.ids = append([]int64{id}, q.ids...)
+}
+
+func (q *admissionQueue) pop() (int64, bool) {
+	if len(q.ids) == 0 {
+		return 0, false
+	}
+
+	id := q.ids[0]
+	q.ids = q.ids[1:]
+	return id, true
+}
+
+// remove drops the task from the queue, for example when it is cancelled
+// before it got a slot.
+func (q *admissionQueue) remove(id int64) {
+	q.ids = slices.DeleteFunc(q.ids, func(queued int64) bool { return queued == id })
+}
+
+// position returns the 1-based position of the task in the queue, or 0 if it is not queued.
+func (q *admissionQueue) position(id int64) int {
+	return slices.Index(q.ids, id) + 1
+}
+
+// acquire remembers when the task took an active slot.
+func (q *admissionQueue) acquire(id int64) {
+	q.acquiredAt[id] = time.Now()
+}
+
+// release feeds the time the task held its slot into the moving average.
+func (q *admissionQueue) release(id int64) {
+	at, ok := q.acquiredAt[id]
+	if !ok {
+		return
+	}
+	delete(q.acquiredAt, id)
+
+	held := time.Since(at)
+	if q.avgHold == 0 {
+		q.avgHold = held
+		return
+	}
+	q.avgHold = time.Duration(slotTimeWeight*float64(held) + (1-slotTimeWeight)*float64(q.avgHold))
+}
+
+func (q *admissionQueue) slotEstimate() time.Duration {
+	if q.avgHold == 0 {
+		return defaultSlotEstimate
+	}
+	return q.avgHold
+}
+
+// estimateWait assumes slots are released in waves of maxTasks, one wave per
+// average hold time.
+func (q *admissionQueue) estimateWait(position, maxTasks int) time.Duration {
+	if maxTasks <= 0 {
+		maxTasks = 1
+	}
+	waves := (position + maxTasks - 1) / maxTasks
+	return time.Duration(waves) * q.slotEstimate()
+}
+
+// retryAfter is the expected time until any slot frees up, never less than a second.
+func (q *admissionQueue) retryAfter(maxTasks int) time.Duration {
+	if maxTasks <= 0 {
+		maxTasks = 1
+	}
+	wait := q.slotEstimate() / time.Duration(maxTasks)
+	if wait < time.Second {
+		wait = time.Second
+	}
+	return wait
+}
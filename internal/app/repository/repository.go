@@ -3,15 +3,17 @@ package repository
 import (
 	"context"
 	"fmt"
-	"net/http"
-	"path/filepath"
-	"strings"
+	"slices"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/supchaser/test_task/internal/app"
 	"github.com/supchaser/test_task/internal/app/models"
+	"github.com/supchaser/test_task/internal/fetcher"
 	"github.com/supchaser/test_task/internal/utils/errs"
 	"github.com/supchaser/test_task/internal/utils/logger"
+	"github.com/supchaser/test_task/internal/utils/retry"
 	"github.com/supchaser/test_task/internal/utils/validate"
 	"go.uber.org/zap"
 )
@@ -20,52 +22,273 @@ type TaskRepository struct {
 	tasks       map[int64]*models.Task
 	activeTasks int
 	maxTasks    int
-	mu          sync.Mutex
+	maxObjects  int
+	journal     *journal
+	queue       *admissionQueue
+	onPromote   func(taskID int64)
+	lastID      int64
+	retryPolicy retry.Policy
+	fetcher     app.Fetcher
+	// filePolicy lists the accepted file types checked against the probe response.
+	filePolicy validate.Policy
+	// maxObjectSize and maxArchiveSize are checked against Content-Length
+	// at probe time; 0 disables them.
+	maxObjectSize  int64
+	maxArchiveSize int64
+	mu             sync.Mutex
 }
 
-func CreateTaskRepository(maxTasks int) *TaskRepository {
-	return &TaskRepository{
-		tasks:    make(map[int64]*models.Task),
-		maxTasks: maxTasks,
+type Option func(*TaskRepository)
+
+// WithQueueSize enables the admission queue: when all slots are busy, up to
+// size new tasks are accepted as queued instead of being rejected.
+func WithQueueSize(size int) Option {
+	return func(r *TaskRepository) {
+		r.queue.maxSize = size
+	}
+}
+
+// WithMaxObjects sets how many objects a single task may hold.
+func WithMaxObjects(maxObjects int) Option {
+	return func(r *TaskRepository) {
+		r.maxObjects = maxObjects
+	}
+}
+
+// WithFilePolicy sets the file types objects may have.
+func WithFilePolicy(policy validate.Policy) Option {
+	return func(r *TaskRepository) {
+		r.filePolicy = policy
+	}
+}
+
+// WithSizeLimits sets the largest accepted object and the largest total
+// size of all objects of a task, in bytes. Zero disables a limit.
+func WithSizeLimits(maxObject, maxArchive int64) Option {
+	return func(r *TaskRepository) {
+		r.maxObjectSize = maxObject
+		r.maxArchiveSize = maxArchive
+	}
+}
+
+// WithRetryPolicy sets how the availability probe retries transient failures.
+func WithRetryPolicy(policy retry.Policy) Option {
+	return func(r *TaskRepository) {
+		r.retryPolicy = policy
 	}
 }
 
-func (r *TaskRepository) CreateTask(ctx context.Context) (*models.Task, error) {
+// WithFetcher sets the HTTP client used for the availability probe.
+func WithFetcher(f app.Fetcher) Option {
+	return func(r *TaskRepository) {
+		r.fetcher = f
+	}
+}
+
+func CreateTaskRepository(maxTasks int, opts ...Option) *TaskRepository {
+	r := &TaskRepository{
+		tasks:       make(map[int64]*models.Task),
+		maxTasks:    maxTasks,
+		maxObjects:  validate.DefaultMaxObjectsPerTask,
+		queue:       newAdmissionQueue(),
+		retryPolicy: retry.DefaultPolicy(),
+		fetcher:     fetcher.Default(),
+		filePolicy:  validate.DefaultPolicy(),
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+// SetPromoteHandler registers a callback that is invoked (in its own goroutine)
+// every time a queued task gets an active slot.
+func (r *TaskRepository) SetPromoteHandler(handler func(taskID int64)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.onPromote = handler
+}
+
+// CreatePersistentTaskRepository restores tasks from dataDir and keeps every
+// further change in an on-disk journal. Tasks that were being processed when
+// the previous run stopped are marked interrupted: they keep their active
+// slot and are picked up again by the usecase's ResumeTasks.
+func CreatePersistentTaskRepository(maxTasks int, dataDir string, opts ...Option) (*TaskRepository, error) {
+	const funcName = "CreatePersistentTaskRepository"
+
+	j, tasks, err := openJournal(dataDir)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", funcName, err)
+	}
+
+	r := CreateTaskRepository(maxTasks, opts...)
+	r.tasks = tasks
+	r.journal = j
+
+	queued := make([]*models.Task, 0)
+	for _, task := range r.tasks {
+		if task.Status == models.StatusQueued {
+			queued = append(queued, task)
+			continue
+		}
+
+		// the archive job died with the process; the task keeps its slot
+		// and is resumed like one stopped by a graceful shutdown
+		if task.Status == models.StatusProcessing {
+			logger.Warn("task was interrupted, marking it for resume",
+				zap.String("function", funcName),
+				zap.Int64("task_id", task.ID),
+			)
+			task.Status = models.StatusInterrupted
+		}
+
+		if task.Status.IsActive() {
+			r.activeTasks++
+			r.queue.acquire(task.ID)
+		}
+	}
+
+	sort.Slice(queued, func(i, j int) bool {
+		return queued[i].CreatedAt.Before(queued[j].CreatedAt)
+	})
+	for _, task := range queued {
+		r.queue.push(task.ID)
+	}
+	r.promoteQueued(funcName)
+
+	// fold the replayed journal and the recovered statuses into a fresh snapshot
+	if err := r.journal.compact(r.tasks); err != nil {
+		r.journal.close()
+		return nil, fmt.Errorf("%s: %w", funcName, err)
+	}
+
+	logger.Info("tasks restored from disk",
+		zap.String("function", funcName),
+		zap.String("data_dir", dataDir),
+		zap.Int("tasks", len(r.tasks)),
+		zap.Int("active_tasks", r.activeTasks),
+	)
+
+	return r, nil
+}
+
+// Close flushes the journal into a snapshot. It is a no-op for the in-memory repository.
+func (r *TaskRepository) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.journal == nil {
+		return nil
+	}
+
+	if err := r.journal.compact(r.tasks); err != nil {
+		r.journal.close()
+		return err
+	}
+
+	return r.journal.close()
+}
+
+// persist records the current state of the task. Must be called with r.mu held.
+func (r *TaskRepository) persist(task *models.Task) error {
+	if r.journal == nil {
+		return nil
+	}
+
+	if err := r.journal.put(task); err != nil {
+		return err
+	}
+
+	if r.journal.needsCompaction() {
+		if err := r.journal.compact(r.tasks); err != nil {
+			// the record itself is already durable, compaction will be retried later
+			logger.Error("failed to compact journal",
+				zap.Int64("task_id", task.ID),
+				zap.Error(err),
+			)
+		}
+	}
+
+	return nil
+}
+
+func (r *TaskRepository) CreateTask(ctx context.Context, opts models.TaskOptions) (*models.Task, error) {
 	const funcName = "TaskRepository.CreateTask"
 	logger.Debug("attempting to create task",
 		zap.String("function", funcName),
+		zap.String("format", opts.Format),
+		zap.Bool("encrypted", opts.Password != ""),
 	)
 
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	status := models.StatusWaiting
 	if r.activeTasks >= r.maxTasks {
-		logger.Warn("maximum tasks limit reached",
-			zap.String("function", funcName),
-			zap.Int("active_tasks", r.activeTasks),
-			zap.Int("max_tasks", r.maxTasks),
-		)
-		return nil, fmt.Errorf("%w: current %d, max %d", errs.ErrMaxTasksReached, r.activeTasks, r.maxTasks)
+		if r.queue.full() {
+			logger.Warn("maximum tasks limit reached",
+				zap.String("function", funcName),
+				zap.Int("active_tasks", r.activeTasks),
+				zap.Int("max_tasks", r.maxTasks),
+				zap.Int("queued_tasks", r.queue.len()),
+				zap.Int("max_queued_tasks", r.queue.maxSize),
+			)
+			if r.queue.maxSize > 0 {
+				return nil, fmt.Errorf("%w: current %d, max %d, queue is full (%d)",
+					errs.ErrMaxTasksReached, r.activeTasks, r.maxTasks, r.queue.maxSize)
+			}
+			return nil, fmt.Errorf("%w: current %d, max %d", errs.ErrMaxTasksReached, r.activeTasks, r.maxTasks)
+		}
+		status = models.StatusQueued
 	}
 
+	now := time.Now()
 	task := &models.Task{
-		ID:        time.Now().UnixNano(),
-		Status:    models.StatusWaiting,
-		Objects:   make([]*models.Object, 0),
-		CreatedAt: time.Now(),
+		ID:               r.nextID(),
+		Status:           status,
+		Format:           opts.Format,
+		Encrypted:        opts.Password != "",
+		Password:         opts.Password,
+		Compression:      opts.Compression,
+		CompressionLevel: opts.CompressionLevel,
+		Objects:          make([]*models.Object, 0),
+		CreatedAt:        now,
+		UpdatedAt:        now,
 	}
 
+	// the task has to be in the map before it is persisted: the write may
+	// trigger a compaction, and the snapshot is taken from r.tasks
 	r.tasks[task.ID] = task
-	r.activeTasks++
+	if err := r.persist(task); err != nil {
+		delete(r.tasks, task.ID)
+		logger.Error("failed to persist task",
+			zap.String("function", funcName),
+			zap.Int64("task_id", task.ID),
+			zap.Error(err),
+		)
+		return nil, err
+	}
+
+	if status == models.StatusQueued {
+		r.queue.push(task.ID)
+	} else {
+		r.activeTasks++
+		r.queue.acquire(task.ID)
+	}
 
 	logger.Info("task created successfully",
 		zap.String("function", funcName),
 		zap.Int64("task_id", task.ID),
+		zap.String("status", string(task.Status)),
 		zap.Int("active_tasks", r.activeTasks),
+		zap.Int("queued_tasks", r.queue.len()),
 		zap.Time("created_at", task.CreatedAt),
 	)
 
-	return task, nil
+	return r.view(task), nil
 }
 
 func (r *TaskRepository) GetTask(ctx context.Context, id int64) (*models.Task, error) {
@@ -94,10 +317,12 @@ func (r *TaskRepository) GetTask(ctx context.Context, id int64) (*models.Task, e
 		zap.Int("objects_count", len(task.Objects)),
 	)
 
-	return task, nil
+	return r.view(task), nil
 }
 
-func (r *TaskRepository) AddObject(ctx context.Context, taskID int64, url string) (*models.Task, error) {
+// AddObject probes the URL and appends it to the task. A non-empty name
+// overrides the file name the object gets inside the archive.
+func (r *TaskRepository) AddObject(ctx context.Context, taskID int64, url, name string) (*models.Task, error) {
 	const funcName = "TaskRepository.AddObject"
 	logger.Debug("attempting to add object to task",
 		zap.String("function", funcName),
@@ -105,9 +330,83 @@ func (r *TaskRepository) AddObject(ctx context.Context, taskID int64, url string
 		zap.String("url", url),
 	)
 
+	r.mu.Lock()
+	_, err := r.acceptingTask(funcName, taskID)
+	r.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	// the probe may take several attempts, so it runs without the lock
+	attempts, size, err := r.probe(ctx, taskID, url)
+	if err != nil {
+		return nil, err
+	}
+
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	// the task could have changed while the probe was running
+	task, err := r.acceptingTask(funcName, taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validate.ValidateArchiveSize(taskSize(task)+size, r.maxArchiveSize); err != nil {
+		logger.Warn("archive size limit reached",
+			zap.String("function", funcName),
+			zap.Int64("task_id", taskID),
+			zap.String("url", url),
+			zap.Int64("size", size),
+		)
+		return nil, err
+	}
+
+	object := &models.Object{
+		ID:       r.nextID(),
+		URL:      url,
+		Name:     name,
+		State:    models.ObjectPending,
+		Size:     size,
+		Attempts: attempts,
+	}
+	prevUpdatedAt := task.UpdatedAt
+	task.Objects = append(task.Objects, object)
+	task.UpdatedAt = time.Now()
+
+	if err := r.persist(task); err != nil {
+		task.Objects = task.Objects[:len(task.Objects)-1]
+		task.UpdatedAt = prevUpdatedAt
+		logger.Error("failed to persist task",
+			zap.String("function", funcName),
+			zap.Int64("task_id", taskID),
+			zap.Error(err),
+		)
+		return nil, err
+	}
+
+	logger.Info("object added successfully",
+		zap.String("function", funcName),
+		zap.Int64("task_id", taskID),
+		zap.String("url", url),
+		zap.Int("new_objects_count", len(task.Objects)),
+	)
+
+	return r.view(task), nil
+}
+
+// taskSize sums the sizes known for the objects of the task.
+func taskSize(task *models.Task) int64 {
+	var total int64
+	for _, obj := range task.Objects {
+		total += obj.Size
+	}
+	return total
+}
+
+// acceptingTask returns the task if one more object can be added to it.
+// Must be called with r.mu held.
+func (r *TaskRepository) acceptingTask(funcName string, taskID int64) (*models.Task, error) {
 	task, exists := r.tasks[taskID]
 	if !exists {
 		logger.Warn("task not found when adding object",
@@ -117,64 +416,115 @@ func (r *TaskRepository) AddObject(ctx context.Context, taskID int64, url string
 		return nil, errs.ErrTaskNotFound
 	}
 
-	if err := validate.ValidateObjectLimit(len(task.Objects)); err != nil {
-		logger.Warn("maximum objects limit reached",
+	if task.Status != models.StatusWaiting && task.Status != models.StatusQueued {
+		logger.Warn("task does not accept objects anymore",
 			zap.String("function", funcName),
 			zap.Int64("task_id", taskID),
-			zap.Int("current_objects", len(task.Objects)),
-			zap.Error(err),
+			zap.String("status", string(task.Status)),
 		)
-		return nil, err
+		return nil, fmt.Errorf("%w: task is %s", errs.ErrInvalidTaskStatus, task.Status)
 	}
 
-	if err := validate.ValidateFileExtension(url); err != nil {
-		ext := strings.ToLower(filepath.Ext(url))
-		logger.Warn("invalid file type",
+	if err := validate.ValidateObjectLimit(len(task.Objects), r.maxObjects); err != nil {
+		logger.Warn("maximum objects limit reached",
 			zap.String("function", funcName),
 			zap.Int64("task_id", taskID),
-			zap.String("url", url),
-			zap.String("extension", ext),
+			zap.Int("current_objects", len(task.Objects)),
 			zap.Error(err),
 		)
 		return nil, err
 	}
 
-	resp, err := http.Head(url)
-	if err != nil {
-		logger.Warn("file unavailable",
+	return task, nil
+}
+
+// SetTaskPassword sets the password the archive will be encrypted with. It
+// can only change before archiving starts.
+func (r *TaskRepository) SetTaskPassword(ctx context.Context, id int64, password string) error {
+	const funcName = "TaskRepository.SetTaskPassword"
+	logger.Debug("attempting to set task password",
+		zap.String("function", funcName),
+		zap.Int64("task_id", id),
+	)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	task, exists := r.tasks[id]
+	if !exists {
+		logger.Warn("task not found when setting password",
 			zap.String("function", funcName),
-			zap.Int64("task_id", taskID),
-			zap.String("url", url),
-			zap.Error(err),
+			zap.Int64("task_id", id),
 		)
-		return nil, errs.ErrFileUnavailable
+		return errs.ErrTaskNotFound
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		logger.Warn("file unavailable - invalid status code",
+	if task.Status != models.StatusWaiting && task.Status != models.StatusQueued {
+		logger.Warn("task password cannot be changed",
 			zap.String("function", funcName),
-			zap.Int64("task_id", taskID),
-			zap.String("url", url),
-			zap.Int("status_code", resp.StatusCode),
+			zap.Int64("task_id", id),
+			zap.String("status", string(task.Status)),
 		)
-		return nil, errs.ErrFileUnavailable
+		return fmt.Errorf("%w: task is %s", errs.ErrInvalidTaskStatus, task.Status)
 	}
 
-	object := &models.Object{
-		ID:  time.Now().UnixNano(),
-		URL: url,
+	oldPassword := task.Password
+	task.Password = password
+	task.Encrypted = password != ""
+	task.UpdatedAt = time.Now()
+	if err := r.persist(task); err != nil {
+		task.Password = oldPassword
+		task.Encrypted = oldPassword != ""
+		logger.Error("failed to persist task",
+			zap.String("function", funcName),
+			zap.Int64("task_id", id),
+			zap.Error(err),
+		)
+		return err
 	}
-	task.Objects = append(task.Objects, object)
 
-	logger.Info("object added successfully",
+	logger.Info("task password set",
 		zap.String("function", funcName),
-		zap.Int64("task_id", taskID),
-		zap.String("url", url),
-		zap.Int("new_objects_count", len(task.Objects)),
+		zap.Int64("task_id", id),
+		zap.Bool("encrypted", task.Encrypted),
 	)
 
-	return task, nil
+	return nil
+}
+
+// SetArchiveStats records the size of the archive built for the task.
+func (r *TaskRepository) SetArchiveStats(ctx context.Context, id int64, stats models.ArchiveStats) error {
+	const funcName = "TaskRepository.SetArchiveStats"
+	logger.Debug("attempting to set archive stats",
+		zap.String("function", funcName),
+		zap.Int64("task_id", id),
+	)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	task, exists := r.tasks[id]
+	if !exists {
+		logger.Warn("task not found when setting archive stats",
+			zap.String("function", funcName),
+			zap.Int64("task_id", id),
+		)
+		return errs.ErrTaskNotFound
+	}
+
+	prev := task.Stats
+	task.Stats = &stats
+	if err := r.persist(task); err != nil {
+		task.Stats = prev
+		logger.Error("failed to persist task",
+			zap.String("function", funcName),
+			zap.Int64("task_id", id),
+			zap.Error(err),
+		)
+		return err
+	}
+
+	return nil
 }
 
 func (r *TaskRepository) UpdateTaskStatus(ctx context.Context, id int64, status models.TaskStatus) error {
@@ -198,16 +548,44 @@ func (r *TaskRepository) UpdateTaskStatus(ctx context.Context, id int64, status
 	}
 
 	oldStatus := task.Status
-	task.Status = status
 
-	if (status == models.StatusDone || status == models.StatusFailed) &&
-		(oldStatus == models.StatusWaiting || oldStatus == models.StatusProcessing) {
-		r.activeTasks--
-		logger.Info("active task slot released",
+	// only one archiving job may ever run for a task; an interrupted one is
+	// started again
+	if status == models.StatusProcessing && oldStatus != models.StatusWaiting && oldStatus != models.StatusInterrupted {
+		logger.Warn("task cannot be moved to processing",
+			zap.String("function", funcName),
+			zap.Int64("task_id", id),
+			zap.String("status", string(oldStatus)),
+		)
+		return fmt.Errorf("%w: task is %s", errs.ErrInvalidTaskStatus, oldStatus)
+	}
+
+	// a job finishing after its task was cancelled must not overwrite the
+	// status, and a finished task has nothing left to cancel
+	if oldStatus == models.StatusCancelled || (status == models.StatusCancelled && oldStatus.IsFinished()) {
+		logger.Warn("task status cannot be changed",
+			zap.String("function", funcName),
+			zap.Int64("task_id", id),
+			zap.String("status", string(oldStatus)),
+			zap.String("new_status", string(status)),
+		)
+		return fmt.Errorf("%w: task is %s", errs.ErrInvalidTaskStatus, oldStatus)
+	}
+
+	if err := r.setStatus(task, status); err != nil {
+		logger.Error("failed to persist task",
 			zap.String("function", funcName),
 			zap.Int64("task_id", id),
-			zap.Int("remaining_active_tasks", r.activeTasks),
+			zap.Error(err),
 		)
+		return err
+	}
+
+	if oldStatus == models.StatusQueued && status.IsFinished() {
+		r.queue.remove(id)
+	}
+	if oldStatus.IsActive() && status.IsFinished() {
+		r.releaseSlot(funcName, id)
 	}
 
 	logger.Info("task status updated successfully",
@@ -231,7 +609,7 @@ func (r *TaskRepository) GetAllTasks(ctx context.Context) ([]*models.Task, error
 
 	tasks := make([]*models.Task, 0, len(r.tasks))
 	for _, task := range r.tasks {
-		tasks = append(tasks, task)
+		tasks = append(tasks, r.view(task))
 	}
 
 	logger.Info("retrieved all tasks",
@@ -246,6 +624,407 @@ func (r *TaskRepository) GetMaxTasks() int {
 	return r.maxTasks
 }
 
+func (r *TaskRepository) GetMaxObjects() int {
+	return r.maxObjects
+}
+
 func (r *TaskRepository) GetActiveTasksCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	return r.activeTasks
 }
+
+func (r *TaskRepository) GetQueuedTasksCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.queue.len()
+}
+
+// EstimateRetryAfter returns how long a rejected client should wait before
+// trying again: roughly the time until the next active slot is expected to free up.
+func (r *TaskRepository) EstimateRetryAfter() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.queue.retryAfter(r.maxTasks)
+}
+
+// UpdateObject stores the download outcome of an object. The object is matched by ID.
+func (r *TaskRepository) UpdateObject(ctx context.Context, taskID int64, object *models.Object) error {
+	const funcName = "TaskRepository.UpdateObject"
+	logger.Debug("attempting to update object",
+		zap.String("function", funcName),
+		zap.Int64("task_id", taskID),
+		zap.Int64("object_id", object.ID),
+		zap.String("state", string(object.State)),
+	)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	task, exists := r.tasks[taskID]
+	if !exists {
+		logger.Warn("task not found when updating object",
+			zap.String("function", funcName),
+			zap.Int64("task_id", taskID),
+		)
+		return errs.ErrTaskNotFound
+	}
+
+	index := slices.IndexFunc(task.Objects, func(o *models.Object) bool {
+		return o.ID == object.ID
+	})
+	if index < 0 {
+		logger.Warn("object not found",
+			zap.String("function", funcName),
+			zap.Int64("task_id", taskID),
+			zap.Int64("object_id", object.ID),
+		)
+		return errs.ErrObjectNotFound
+	}
+
+	prev := task.Objects[index]
+	updated := *object
+	task.Objects[index] = &updated
+
+	if err := r.persist(task); err != nil {
+		task.Objects[index] = prev
+		logger.Error("failed to persist task",
+			zap.String("function", funcName),
+			zap.Int64("task_id", taskID),
+			zap.Error(err),
+		)
+		return err
+	}
+
+	return nil
+}
+
+// ExpireIdleTasks moves waiting tasks that got no new objects for longer than
+// idleTTL to expired and gives their slots to queued tasks.
+func (r *TaskRepository) ExpireIdleTasks(ctx context.Context, idleTTL time.Duration) ([]int64, error) {
+	const funcName = "TaskRepository.ExpireIdleTasks"
+	logger.Debug("expiring idle tasks",
+		zap.String("function", funcName),
+		zap.Duration("idle_ttl", idleTTL),
+	)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	deadline := time.Now().Add(-idleTTL)
+	expired := make([]int64, 0)
+	for id, task := range r.tasks {
+		if task.Status != models.StatusWaiting || task.UpdatedAt.After(deadline) {
+			continue
+		}
+
+		if err := r.setStatus(task, models.StatusExpired); err != nil {
+			logger.Error("failed to persist task",
+				zap.String("function", funcName),
+				zap.Int64("task_id", id),
+				zap.Error(err),
+			)
+			return expired, err
+		}
+
+		expired = append(expired, id)
+		logger.Info("idle task expired",
+			zap.String("function", funcName),
+			zap.Int64("task_id", id),
+			zap.Time("last_activity", task.UpdatedAt),
+		)
+		r.releaseSlot(funcName, id)
+	}
+
+	return expired, nil
+}
+
+// DeleteTask removes a finished task from the repository.
+func (r *TaskRepository) DeleteTask(ctx context.Context, id int64) error {
+	const funcName = "TaskRepository.DeleteTask"
+	logger.Debug("attempting to delete task",
+		zap.String("function", funcName),
+		zap.Int64("task_id", id),
+	)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	task, exists := r.tasks[id]
+	if !exists {
+		logger.Warn("task not found when deleting",
+			zap.String("function", funcName),
+			zap.Int64("task_id", id),
+		)
+		return errs.ErrTaskNotFound
+	}
+
+	if !task.Status.IsFinished() {
+		logger.Warn("only finished tasks can be deleted",
+			zap.String("function", funcName),
+			zap.Int64("task_id", id),
+			zap.String("status", string(task.Status)),
+		)
+		return fmt.Errorf("%w: task is %s", errs.ErrInvalidTaskStatus, task.Status)
+	}
+
+	if r.journal != nil {
+		if err := r.journal.delete(id); err != nil {
+			logger.Error("failed to persist task deletion",
+				zap.String("function", funcName),
+				zap.Int64("task_id", id),
+				zap.Error(err),
+			)
+			return err
+		}
+	}
+
+	delete(r.tasks, id)
+
+	logger.Info("task deleted successfully",
+		zap.String("function", funcName),
+		zap.Int64("task_id", id),
+	)
+
+	return nil
+}
+
+// PurgeTasks deletes every finished task that matches the filter and returns
+// the deleted tasks. Tasks that are still active are never touched, so the
+// slot count stays as it is.
+func (r *TaskRepository) PurgeTasks(ctx context.Context, filter models.PurgeFilter) ([]*models.Task, error) {
+	const funcName = "TaskRepository.PurgeTasks"
+	logger.Debug("purging tasks",
+		zap.String("function", funcName),
+	)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	purged := make([]*models.Task, 0)
+	for id, task := range r.tasks {
+		if !filter.Matches(task) {
+			continue
+		}
+
+		if r.journal != nil {
+			if err := r.journal.delete(id); err != nil {
+				logger.Error("failed to persist task deletion",
+					zap.String("function", funcName),
+					zap.Int64("task_id", id),
+					zap.Error(err),
+				)
+				return purged, err
+			}
+		}
+
+		purged = append(purged, task.Clone())
+		delete(r.tasks, id)
+	}
+
+	logger.Info("tasks purged",
+		zap.String("function", funcName),
+		zap.Int("count", len(purged)),
+	)
+
+	return purged, nil
+}
+
+// RetryTask puts a done or failed task back into processing for a new
+// archive version. Objects that did not make it into the archive are reset
+// to pending, or every object when all is set. The task takes an active
+// slot again, so it is rejected when none is free.
+func (r *TaskRepository) RetryTask(ctx context.Context, id int64, all bool) (*models.Task, error) {
+	const funcName = "TaskRepository.RetryTask"
+	logger.Debug("attempting to retry task",
+		zap.String("function", funcName),
+		zap.Int64("task_id", id),
+		zap.Bool("all", all),
+	)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	task, exists := r.tasks[id]
+	if !exists {
+		logger.Warn("task not found when retrying",
+			zap.String("function", funcName),
+			zap.Int64("task_id", id),
+		)
+		return nil, errs.ErrTaskNotFound
+	}
+
+	if task.Status != models.StatusDone && task.Status != models.StatusFailed {
+		logger.Warn("task cannot be retried",
+			zap.String("function", funcName),
+			zap.Int64("task_id", id),
+			zap.String("status", string(task.Status)),
+		)
+		return nil, fmt.Errorf("%w: task is %s", errs.ErrInvalidTaskStatus, task.Status)
+	}
+
+	if r.activeTasks >= r.maxTasks {
+		logger.Warn("no free slot to retry task",
+			zap.String("function", funcName),
+			zap.Int64("task_id", id),
+			zap.Int("active_tasks", r.activeTasks),
+		)
+		return nil, errs.ErrMaxTasksReached
+	}
+
+	prev := task.Clone()
+	retried := 0
+	for _, obj := range task.Objects {
+		if obj.State == models.ObjectArchived && !all {
+			continue
+		}
+		obj.State = models.ObjectPending
+		obj.Error = ""
+		obj.HTTPStatus = 0
+		obj.SHA256 = ""
+		obj.ArchiveName = ""
+		obj.DurationMs = 0
+		retried++
+	}
+
+	task.ArchiveVersion = max(task.ArchiveVersion, 1) + 1
+	task.Stats = nil
+	task.FinishedAt = nil
+	task.Status = models.StatusProcessing
+	task.UpdatedAt = time.Now()
+
+	if err := r.persist(task); err != nil {
+		r.tasks[id] = prev
+		logger.Error("failed to persist task",
+			zap.String("function", funcName),
+			zap.Int64("task_id", id),
+			zap.Error(err),
+		)
+		return nil, err
+	}
+
+	r.activeTasks++
+	r.queue.acquire(id)
+
+	logger.Info("task retried",
+		zap.String("function", funcName),
+		zap.Int64("task_id", id),
+		zap.Int("archive_version", task.ArchiveVersion),
+		zap.Int("objects", retried),
+		zap.Int("active_tasks", r.activeTasks),
+	)
+
+	return r.view(task), nil
+}
+
+// setStatus changes the status, keeps the timestamps in sync and persists the
+// task, rolling back on failure. Must be called with r.mu held.
+func (r *TaskRepository) setStatus(task *models.Task, status models.TaskStatus) error {
+	prev := *task
+
+	now := time.Now()
+	task.Status = status
+	task.UpdatedAt = now
+	if status.IsFinished() {
+		task.FinishedAt = &now
+	}
+	// no archive is built for these any more, so the password is not kept
+	// at rest; done and failed tasks keep it for a retry
+	if status == models.StatusCancelled || status == models.StatusExpired {
+		task.Password = ""
+	}
+
+	if err := r.persist(task); err != nil {
+		task.Status = prev.Status
+		task.UpdatedAt = prev.UpdatedAt
+		task.FinishedAt = prev.FinishedAt
+		task.Password = prev.Password
+		return err
+	}
+
+	return nil
+}
+
+// releaseSlot frees the active slot held by the task. Must be called with r.mu held.
+func (r *TaskRepository) releaseSlot(funcName string, id int64) {
+	r.activeTasks--
+	r.queue.release(id)
+	logger.Info("active task slot released",
+		zap.String("function", funcName),
+		zap.Int64("task_id", id),
+		zap.Int("remaining_active_tasks", r.activeTasks),
+	)
+	r.promoteQueued(funcName)
+}
+
+// nextID returns a time-based ID that is unique even when called several
+// times within one clock tick. Must be called with r.mu held.
+func (r *TaskRepository) nextID() int64 {
+	id := time.Now().UnixNano()
+	if id <= r.lastID {
+		id = r.lastID + 1
+	}
+	r.lastID = id
+	return id
+}
+
+// view returns a copy of the task with queue information filled in. Must be called with r.mu held.
+func (r *TaskRepository) view(task *models.Task) *models.Task {
+	clone := task.Clone()
+	clone.QueuePosition = 0
+	clone.EstimatedStartAt = nil
+
+	if task.Status == models.StatusQueued {
+		position := r.queue.position(task.ID)
+		if position > 0 {
+			estimate := time.Now().Add(r.queue.estimateWait(position, r.maxTasks))
+			clone.QueuePosition = position
+			clone.EstimatedStartAt = &estimate
+		}
+	}
+
+	return clone
+}
+
+// promoteQueued hands free slots to queued tasks in FIFO order. Must be called with r.mu held.
+func (r *TaskRepository) promoteQueued(funcName string) {
+	for r.activeTasks < r.maxTasks {
+		id, ok := r.queue.pop()
+		if !ok {
+			return
+		}
+
+		task, exists := r.tasks[id]
+		if !exists || task.Status != models.StatusQueued {
+			continue
+		}
+
+		if err := r.setStatus(task, models.StatusWaiting); err != nil {
+			logger.Error("failed to persist promoted task",
+				zap.String("function", funcName),
+				zap.Int64("task_id", id),
+				zap.Error(err),
+			)
+			// keep its place, the next released slot will try again
+			r.queue.pushFront(id)
+			return
+		}
+
+		r.activeTasks++
+		r.queue.acquire(id)
+
+		logger.Info("queued task promoted",
+			zap.String("function", funcName),
+			zap.Int64("task_id", id),
+			zap.Int("active_tasks", r.activeTasks),
+			zap.Int("queued_tasks", r.queue.len()),
+		)
+
+		if r.onPromote != nil {
+			go r.onPromote(id)
+		}
+	}
+}
@@ -2,15 +2,23 @@ package repository
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/supchaser/test_task/internal/app/models"
+	"github.com/supchaser/test_task/internal/fetcher"
 	"github.com/supchaser/test_task/internal/utils/errs"
 	"github.com/supchaser/test_task/internal/utils/logger"
+	"github.com/supchaser/test_task/internal/utils/retry"
 )
 
 func TestMain(m *testing.M) {
@@ -21,7 +29,7 @@ func TestMain(m *testing.M) {
 func TestCreateTask_Success(t *testing.T) {
 	repo := CreateTaskRepository(3)
 
-	task, err := repo.CreateTask(context.Background())
+	task, err := repo.CreateTask(context.Background(), models.TaskOptions{})
 
 	assert.NoError(t, err)
 	assert.NotNil(t, task)
@@ -36,20 +44,126 @@ func TestCreateTask_MaxTasksReached(t *testing.T) {
 	repo := CreateTaskRepository(maxTasks)
 
 	for range maxTasks {
-		_, err := repo.CreateTask(context.Background())
+		_, err := repo.CreateTask(context.Background(), models.TaskOptions{})
 		assert.NoError(t, err)
 	}
 
-	task, err := repo.CreateTask(context.Background())
+	task, err := repo.CreateTask(context.Background(), models.TaskOptions{})
 
 	assert.Nil(t, task)
 	assert.Error(t, err)
 	assert.ErrorIs(t, err, errs.ErrMaxTasksReached)
 }
 
+func TestCreateTask_Queued(t *testing.T) {
+	repo := CreateTaskRepository(1, WithQueueSize(2))
+
+	active, err := repo.CreateTask(context.Background(), models.TaskOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, models.StatusWaiting, active.Status)
+
+	first, err := repo.CreateTask(context.Background(), models.TaskOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, models.StatusQueued, first.Status)
+	assert.Equal(t, 1, first.QueuePosition)
+	assert.NotNil(t, first.EstimatedStartAt)
+
+	second, err := repo.CreateTask(context.Background(), models.TaskOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, models.StatusQueued, second.Status)
+	assert.Equal(t, 2, second.QueuePosition)
+
+	_, err = repo.CreateTask(context.Background(), models.TaskOptions{})
+	assert.ErrorIs(t, err, errs.ErrMaxTasksReached)
+	assert.Equal(t, 1, repo.GetActiveTasksCount())
+	assert.Equal(t, 2, repo.GetQueuedTasksCount())
+	assert.GreaterOrEqual(t, repo.EstimateRetryAfter(), time.Second)
+}
+
+func TestUpdateTaskStatus_PromotesQueuedTask(t *testing.T) {
+	repo := CreateTaskRepository(1, WithQueueSize(2))
+	promoted := make(chan int64, 2)
+	repo.SetPromoteHandler(func(taskID int64) {
+		promoted <- taskID
+	})
+
+	active, err := repo.CreateTask(context.Background(), models.TaskOptions{})
+	assert.NoError(t, err)
+	first, err := repo.CreateTask(context.Background(), models.TaskOptions{})
+	assert.NoError(t, err)
+	second, err := repo.CreateTask(context.Background(), models.TaskOptions{})
+	assert.NoError(t, err)
+
+	err = repo.UpdateTaskStatus(context.Background(), active.ID, models.StatusDone)
+	assert.NoError(t, err)
+
+	select {
+	case id := <-promoted:
+		assert.Equal(t, first.ID, id)
+	case <-time.After(time.Second):
+		t.Fatal("promote handler was not called")
+	}
+
+	task, err := repo.GetTask(context.Background(), first.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.StatusWaiting, task.Status)
+	assert.Zero(t, task.QueuePosition)
+	assert.Nil(t, task.EstimatedStartAt)
+
+	task, err = repo.GetTask(context.Background(), second.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.StatusQueued, task.Status)
+	assert.Equal(t, 1, task.QueuePosition)
+
+	assert.Equal(t, 1, repo.GetActiveTasksCount())
+	assert.Equal(t, 1, repo.GetQueuedTasksCount())
+}
+
+func TestUpdateTaskStatus_Cancelled(t *testing.T) {
+	repo := CreateTaskRepository(1, WithQueueSize(2))
+
+	active, err := repo.CreateTask(context.Background(), models.TaskOptions{})
+	assert.NoError(t, err)
+	first, err := repo.CreateTask(context.Background(), models.TaskOptions{})
+	assert.NoError(t, err)
+	second, err := repo.CreateTask(context.Background(), models.TaskOptions{})
+	assert.NoError(t, err)
+
+	// a cancelled queued task leaves the queue without touching the slots
+	assert.NoError(t, repo.UpdateTaskStatus(context.Background(), first.ID, models.StatusCancelled))
+	assert.Equal(t, 1, repo.GetActiveTasksCount())
+	assert.Equal(t, 1, repo.GetQueuedTasksCount())
+	task, err := repo.GetTask(context.Background(), second.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, task.QueuePosition)
+
+	// a cancelled processing task frees its slot for the next in line
+	assert.NoError(t, repo.UpdateTaskStatus(context.Background(), active.ID, models.StatusProcessing))
+	assert.NoError(t, repo.UpdateTaskStatus(context.Background(), active.ID, models.StatusCancelled))
+	assert.Equal(t, 1, repo.GetActiveTasksCount())
+	assert.Zero(t, repo.GetQueuedTasksCount())
+	task, err = repo.GetTask(context.Background(), second.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.StatusWaiting, task.Status)
+
+	// the cancelled status is final and does not release the slot twice
+	err = repo.UpdateTaskStatus(context.Background(), active.ID, models.StatusDone)
+	assert.ErrorIs(t, err, errs.ErrInvalidTaskStatus)
+	assert.Equal(t, 1, repo.GetActiveTasksCount())
+	task, err = repo.GetTask(context.Background(), active.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.StatusCancelled, task.Status)
+
+	// a finished task cannot be cancelled
+	assert.NoError(t, repo.UpdateTaskStatus(context.Background(), second.ID, models.StatusDone))
+	err = repo.UpdateTaskStatus(context.Background(), second.ID, models.StatusCancelled)
+	assert.ErrorIs(t, err, errs.ErrInvalidTaskStatus)
+	assert.Zero(t, repo.GetActiveTasksCount())
+}
+
 func TestGetTask_Success(t *testing.T) {
 	repo := CreateTaskRepository(5)
-	createdTask, err := repo.CreateTask(context.Background())
+	createdTask, err := repo.CreateTask(context.Background(), models.TaskOptions{})
 	assert.NoError(t, err)
 
 	task, err := repo.GetTask(context.Background(), createdTask.ID)
@@ -77,12 +191,12 @@ func TestAddObject_Success(t *testing.T) {
 	defer testServer.Close()
 
 	repo := CreateTaskRepository(5)
-	createdTask, err := repo.CreateTask(context.Background())
+	createdTask, err := repo.CreateTask(context.Background(), models.TaskOptions{})
 	assert.NoError(t, err)
 
 	validURL := testServer.URL + "/image.jpg"
 
-	task, err := repo.AddObject(context.Background(), createdTask.ID, validURL)
+	task, err := repo.AddObject(context.Background(), createdTask.ID, validURL, "")
 
 	assert.NoError(t, err)
 	assert.NotNil(t, task)
@@ -91,17 +205,71 @@ func TestAddObject_Success(t *testing.T) {
 	assert.True(t, task.Objects[0].ID > 0)
 }
 
-func TestAddObject_InvalidExtension(t *testing.T) {
+func TestAddObject_InvalidFileType(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer testServer.Close()
+
 	repo := CreateTaskRepository(5)
-	createdTask, err := repo.CreateTask(context.Background())
+	createdTask, err := repo.CreateTask(context.Background(), models.TaskOptions{})
 	assert.NoError(t, err)
-	invalidURL := "http://example.com/document.docx"
 
-	task, err := repo.AddObject(context.Background(), createdTask.ID, invalidURL)
+	task, err := repo.AddObject(context.Background(), createdTask.ID, testServer.URL+"/document.pdf", "")
 
 	assert.Nil(t, task)
-	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "invalid file type (allowed: .pdf, .jpeg)")
+	assert.ErrorIs(t, err, errs.ErrInvalidFileType)
+	assert.NotErrorIs(t, err, errs.ErrFileUnavailable)
+}
+
+func TestAddObject_URLWithoutExtension(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", `attachment; filename="scan.jpeg"`)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer testServer.Close()
+
+	repo := CreateTaskRepository(5)
+	createdTask, err := repo.CreateTask(context.Background(), models.TaskOptions{})
+	assert.NoError(t, err)
+
+	task, err := repo.AddObject(context.Background(), createdTask.ID, testServer.URL+"/download?id=5", "")
+
+	assert.NoError(t, err)
+	assert.Len(t, task.Objects, 1)
+}
+
+func TestAddObject_CustomLimit(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer testServer.Close()
+
+	repo := CreateTaskRepository(5, WithMaxObjects(1))
+	createdTask, err := repo.CreateTask(context.Background(), models.TaskOptions{})
+	assert.NoError(t, err)
+
+	_, err = repo.AddObject(context.Background(), createdTask.ID, testServer.URL+"/a.pdf", "")
+	assert.NoError(t, err)
+
+	task, err := repo.AddObject(context.Background(), createdTask.ID, testServer.URL+"/b.pdf", "")
+	assert.Nil(t, task)
+	assert.ErrorIs(t, err, errs.ErrMaxObjectsReached)
+	assert.Equal(t, 1, repo.GetMaxObjects())
+}
+
+func TestAddObject_TaskNotWaiting(t *testing.T) {
+	repo := CreateTaskRepository(5)
+	createdTask, err := repo.CreateTask(context.Background(), models.TaskOptions{})
+	assert.NoError(t, err)
+	assert.NoError(t, repo.UpdateTaskStatus(context.Background(), createdTask.ID, models.StatusProcessing))
+
+	task, err := repo.AddObject(context.Background(), createdTask.ID, "http://example.com/image.jpg", "")
+
+	assert.Nil(t, task)
+	assert.ErrorIs(t, err, errs.ErrInvalidTaskStatus)
 }
 
 func TestAddObject_TaskNotFound(t *testing.T) {
@@ -109,7 +277,7 @@ func TestAddObject_TaskNotFound(t *testing.T) {
 	nonExistentID := int64(999999)
 	validURL := "http://example.com/image.jpg"
 
-	task, err := repo.AddObject(context.Background(), nonExistentID, validURL)
+	task, err := repo.AddObject(context.Background(), nonExistentID, validURL, "")
 
 	assert.Nil(t, task)
 	assert.Error(t, err)
@@ -118,7 +286,7 @@ func TestAddObject_TaskNotFound(t *testing.T) {
 
 func TestUpdateTaskStatus_Success(t *testing.T) {
 	repo := CreateTaskRepository(5)
-	createdTask, err := repo.CreateTask(context.Background())
+	createdTask, err := repo.CreateTask(context.Background(), models.TaskOptions{})
 	assert.NoError(t, err)
 
 	err = repo.UpdateTaskStatus(context.Background(), createdTask.ID, models.StatusProcessing)
@@ -128,9 +296,20 @@ func TestUpdateTaskStatus_Success(t *testing.T) {
 	assert.Equal(t, models.StatusProcessing, task.Status)
 }
 
+func TestUpdateTaskStatus_ProcessingOnlyOnce(t *testing.T) {
+	repo := CreateTaskRepository(5)
+	createdTask, err := repo.CreateTask(context.Background(), models.TaskOptions{})
+	assert.NoError(t, err)
+
+	assert.NoError(t, repo.UpdateTaskStatus(context.Background(), createdTask.ID, models.StatusProcessing))
+	err = repo.UpdateTaskStatus(context.Background(), createdTask.ID, models.StatusProcessing)
+
+	assert.ErrorIs(t, err, errs.ErrInvalidTaskStatus)
+}
+
 func TestUpdateTaskStatus_DecreasesActiveCount(t *testing.T) {
 	repo := CreateTaskRepository(5)
-	createdTask, err := repo.CreateTask(context.Background())
+	createdTask, err := repo.CreateTask(context.Background(), models.TaskOptions{})
 	assert.NoError(t, err)
 	assert.Equal(t, 1, repo.GetActiveTasksCount())
 
@@ -140,11 +319,57 @@ func TestUpdateTaskStatus_DecreasesActiveCount(t *testing.T) {
 	assert.Equal(t, 0, repo.GetActiveTasksCount())
 }
 
+func TestUpdateTaskStatus_Interrupted(t *testing.T) {
+	dataDir := t.TempDir()
+	repo, err := CreatePersistentTaskRepository(5, dataDir)
+	assert.NoError(t, err)
+
+	createdTask, err := repo.CreateTask(context.Background(), models.TaskOptions{})
+	assert.NoError(t, err)
+	assert.NoError(t, repo.UpdateTaskStatus(context.Background(), createdTask.ID, models.StatusProcessing))
+	assert.NoError(t, repo.UpdateTaskStatus(context.Background(), createdTask.ID, models.StatusInterrupted))
+	assert.Equal(t, 1, repo.GetActiveTasksCount(), "an interrupted task keeps its slot")
+	assert.NoError(t, repo.Close())
+
+	restored, err := CreatePersistentTaskRepository(5, dataDir)
+	assert.NoError(t, err)
+	defer restored.Close()
+	assert.Equal(t, 1, restored.GetActiveTasksCount())
+
+	task, err := restored.GetTask(context.Background(), createdTask.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.StatusInterrupted, task.Status)
+
+	// an interrupted task may be processed again
+	assert.NoError(t, restored.UpdateTaskStatus(context.Background(), createdTask.ID, models.StatusProcessing))
+}
+
+func TestGetActiveTasksCount_Concurrent(t *testing.T) {
+	repo := CreateTaskRepository(50)
+
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, err := repo.CreateTask(context.Background(), models.TaskOptions{})
+			assert.NoError(t, err)
+		}()
+		go func() {
+			defer wg.Done()
+			assert.LessOrEqual(t, repo.GetActiveTasksCount(), 50)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 50, repo.GetActiveTasksCount())
+}
+
 func TestGetAllTasks(t *testing.T) {
 	repo := CreateTaskRepository(5)
 	count := 3
 	for range count {
-		_, err := repo.CreateTask(context.Background())
+		_, err := repo.CreateTask(context.Background(), models.TaskOptions{})
 		assert.NoError(t, err)
 	}
 
@@ -162,3 +387,593 @@ func TestGetAllTasks_Empty(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Empty(t, tasks)
 }
+
+func TestPersistentRepository_RestoresTasks(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer testServer.Close()
+
+	dataDir := t.TempDir()
+
+	repo, err := CreatePersistentTaskRepository(5, dataDir)
+	assert.NoError(t, err)
+
+	waitingTask, err := repo.CreateTask(context.Background(), models.TaskOptions{})
+	assert.NoError(t, err)
+	_, err = repo.AddObject(context.Background(), waitingTask.ID, testServer.URL+"/image.jpg", "")
+	assert.NoError(t, err)
+
+	processingTask, err := repo.CreateTask(context.Background(), models.TaskOptions{})
+	assert.NoError(t, err)
+	assert.NoError(t, repo.UpdateTaskStatus(context.Background(), processingTask.ID, models.StatusProcessing))
+
+	doneTask, err := repo.CreateTask(context.Background(), models.TaskOptions{})
+	assert.NoError(t, err)
+	assert.NoError(t, repo.UpdateTaskStatus(context.Background(), doneTask.ID, models.StatusDone))
+
+	// simulate a crash: the journal is not compacted on the way out
+	assert.NoError(t, repo.journal.close())
+
+	restored, err := CreatePersistentTaskRepository(5, dataDir)
+	assert.NoError(t, err)
+	defer restored.Close()
+
+	tasks, err := restored.GetAllTasks(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 3)
+	assert.Equal(t, 2, restored.GetActiveTasksCount())
+
+	task, err := restored.GetTask(context.Background(), waitingTask.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.StatusWaiting, task.Status)
+	assert.Len(t, task.Objects, 1)
+	assert.Equal(t, testServer.URL+"/image.jpg", task.Objects[0].URL)
+
+	task, err = restored.GetTask(context.Background(), processingTask.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.StatusInterrupted, task.Status)
+
+	task, err = restored.GetTask(context.Background(), doneTask.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.StatusDone, task.Status)
+}
+
+func TestPersistentRepository_RestoresFinalizedTaskAsInterrupted(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer testServer.Close()
+
+	dataDir := t.TempDir()
+	repo, err := CreatePersistentTaskRepository(5, dataDir)
+	require.NoError(t, err)
+
+	// finalized explicitly with fewer objects than auto-finalize needs
+	task, err := repo.CreateTask(context.Background(), models.TaskOptions{})
+	require.NoError(t, err)
+	_, err = repo.AddObject(context.Background(), task.ID, testServer.URL+"/a.pdf", "")
+	require.NoError(t, err)
+	require.NoError(t, repo.UpdateTaskStatus(context.Background(), task.ID, models.StatusProcessing))
+
+	// simulate a crash in the middle of archiving
+	require.NoError(t, repo.journal.close())
+
+	restored, err := CreatePersistentTaskRepository(5, dataDir)
+	require.NoError(t, err)
+	defer restored.Close()
+
+	got, err := restored.GetTask(context.Background(), task.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusInterrupted, got.Status)
+	assert.Equal(t, 1, restored.GetActiveTasksCount())
+
+	// it does not take objects again and is not expired as idle
+	_, err = restored.AddObject(context.Background(), task.ID, testServer.URL+"/b.pdf", "")
+	assert.ErrorIs(t, err, errs.ErrInvalidTaskStatus)
+	expired, err := restored.ExpireIdleTasks(context.Background(), time.Nanosecond)
+	require.NoError(t, err)
+	assert.Empty(t, expired)
+
+	require.NoError(t, restored.UpdateTaskStatus(context.Background(), task.ID, models.StatusProcessing))
+}
+
+func TestPersistentRepository_IgnoresTornRecord(t *testing.T) {
+	dataDir := t.TempDir()
+
+	repo, err := CreatePersistentTaskRepository(5, dataDir)
+	assert.NoError(t, err)
+	task, err := repo.CreateTask(context.Background(), models.TaskOptions{})
+	assert.NoError(t, err)
+	assert.NoError(t, repo.journal.close())
+
+	f, err := os.OpenFile(filepath.Join(dataDir, journalFileName), os.O_APPEND|os.O_WRONLY, 0644)
+	assert.NoError(t, err)
+	_, err = f.WriteString(`{"op":"put","id":42,"task":{"ID":4`)
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	restored, err := CreatePersistentTaskRepository(5, dataDir)
+	assert.NoError(t, err)
+	defer restored.Close()
+
+	tasks, err := restored.GetAllTasks(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 1)
+	assert.Equal(t, task.ID, tasks[0].ID)
+}
+
+func TestPersistentRepository_Compaction(t *testing.T) {
+	dataDir := t.TempDir()
+
+	repo, err := CreatePersistentTaskRepository(compactThreshold+10, dataDir)
+	assert.NoError(t, err)
+
+	for range compactThreshold + 1 {
+		_, err := repo.CreateTask(context.Background(), models.TaskOptions{})
+		assert.NoError(t, err)
+	}
+	assert.Less(t, repo.journal.records, compactThreshold)
+	assert.NoError(t, repo.Close())
+
+	restored, err := CreatePersistentTaskRepository(compactThreshold+10, dataDir)
+	assert.NoError(t, err)
+	defer restored.Close()
+
+	assert.Equal(t, compactThreshold+1, restored.GetActiveTasksCount())
+}
+
+func TestPersistentRepository_CompactionInsideCreateTask(t *testing.T) {
+	dataDir := t.TempDir()
+
+	repo, err := CreatePersistentTaskRepository(3, dataDir)
+	require.NoError(t, err)
+
+	// the put record of the new task is the one that crosses the threshold
+	repo.journal.records = compactThreshold - 1
+	task, err := repo.CreateTask(context.Background(), models.TaskOptions{})
+	require.NoError(t, err)
+	assert.Zero(t, repo.journal.records)
+
+	// simulate a crash: no final compaction on Close
+	require.NoError(t, repo.journal.close())
+
+	restored, err := CreatePersistentTaskRepository(3, dataDir)
+	require.NoError(t, err)
+	defer restored.Close()
+
+	got, err := restored.GetTask(context.Background(), task.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusWaiting, got.Status)
+}
+
+func TestPersistentRepository_KeepsPassword(t *testing.T) {
+	dataDir := t.TempDir()
+
+	repo, err := CreatePersistentTaskRepository(5, dataDir)
+	assert.NoError(t, err)
+
+	created, err := repo.CreateTask(context.Background(), models.TaskOptions{Format: "zip", Password: "first"})
+	assert.NoError(t, err)
+	assert.True(t, created.Encrypted)
+
+	later, err := repo.CreateTask(context.Background(), models.TaskOptions{})
+	assert.NoError(t, err)
+	assert.NoError(t, repo.SetTaskPassword(context.Background(), later.ID, "second"))
+
+	// the password must survive both journal replay and the snapshot
+	assert.NoError(t, repo.journal.close())
+	restored, err := CreatePersistentTaskRepository(5, dataDir)
+	assert.NoError(t, err)
+	assert.NoError(t, restored.Close())
+	restored, err = CreatePersistentTaskRepository(5, dataDir)
+	assert.NoError(t, err)
+	defer restored.Close()
+
+	task, err := restored.GetTask(context.Background(), created.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "first", task.Password)
+	assert.True(t, task.Encrypted)
+
+	task, err = restored.GetTask(context.Background(), later.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "second", task.Password)
+	assert.True(t, task.Encrypted)
+
+	data, err := json.Marshal(task)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "second")
+}
+
+func TestPersistentRepository_ProtectsPassword(t *testing.T) {
+	dataDir := filepath.Join(t.TempDir(), "data")
+
+	repo, err := CreatePersistentTaskRepository(5, dataDir)
+	require.NoError(t, err)
+
+	task, err := repo.CreateTask(context.Background(), models.TaskOptions{Format: "zip", Password: "confidential"})
+	require.NoError(t, err)
+	require.NoError(t, repo.UpdateTaskStatus(context.Background(), task.ID, models.StatusCancelled))
+	require.NoError(t, repo.Close())
+
+	info, err := os.Stat(dataDir)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o700), info.Mode().Perm())
+	for _, name := range []string{journalFileName, snapshotFileName} {
+		info, err := os.Stat(filepath.Join(dataDir, name))
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o600), info.Mode().Perm(), name)
+	}
+
+	// a cancelled task will never be archived, so its password is dropped
+	data, err := os.ReadFile(filepath.Join(dataDir, snapshotFileName))
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "confidential")
+}
+
+func TestSetTaskPassword_TaskNotWaiting(t *testing.T) {
+	repo := CreateTaskRepository(5)
+	task, err := repo.CreateTask(context.Background(), models.TaskOptions{})
+	assert.NoError(t, err)
+	assert.NoError(t, repo.UpdateTaskStatus(context.Background(), task.ID, models.StatusProcessing))
+
+	err = repo.SetTaskPassword(context.Background(), task.ID, "secret")
+	assert.ErrorIs(t, err, errs.ErrInvalidTaskStatus)
+
+	err = repo.SetTaskPassword(context.Background(), 12345, "secret")
+	assert.ErrorIs(t, err, errs.ErrTaskNotFound)
+}
+
+func TestPersistentRepository_RestoresQueue(t *testing.T) {
+	dataDir := t.TempDir()
+
+	repo, err := CreatePersistentTaskRepository(1, dataDir, WithQueueSize(5))
+	assert.NoError(t, err)
+	active, err := repo.CreateTask(context.Background(), models.TaskOptions{})
+	assert.NoError(t, err)
+	queued, err := repo.CreateTask(context.Background(), models.TaskOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, models.StatusQueued, queued.Status)
+	assert.NoError(t, repo.UpdateTaskStatus(context.Background(), active.ID, models.StatusDone))
+	assert.NoError(t, repo.Close())
+
+	restored, err := CreatePersistentTaskRepository(1, dataDir, WithQueueSize(5))
+	assert.NoError(t, err)
+	defer restored.Close()
+
+	task, err := restored.GetTask(context.Background(), queued.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.StatusWaiting, task.Status)
+	assert.Equal(t, 1, restored.GetActiveTasksCount())
+	assert.Equal(t, 0, restored.GetQueuedTasksCount())
+}
+
+func TestExpireIdleTasks(t *testing.T) {
+	repo := CreateTaskRepository(1, WithQueueSize(1))
+
+	idle, err := repo.CreateTask(context.Background(), models.TaskOptions{})
+	assert.NoError(t, err)
+	queued, err := repo.CreateTask(context.Background(), models.TaskOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, models.StatusQueued, queued.Status)
+
+	expired, err := repo.ExpireIdleTasks(context.Background(), time.Hour)
+	assert.NoError(t, err)
+	assert.Empty(t, expired)
+
+	expired, err = repo.ExpireIdleTasks(context.Background(), 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{idle.ID}, expired)
+
+	task, err := repo.GetTask(context.Background(), idle.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.StatusExpired, task.Status)
+	assert.NotNil(t, task.FinishedAt)
+
+	task, err = repo.GetTask(context.Background(), queued.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.StatusWaiting, task.Status)
+	assert.Equal(t, 1, repo.GetActiveTasksCount())
+}
+
+func TestDeleteTask(t *testing.T) {
+	repo := CreateTaskRepository(5)
+
+	finished, err := repo.CreateTask(context.Background(), models.TaskOptions{})
+	assert.NoError(t, err)
+	assert.NoError(t, repo.UpdateTaskStatus(context.Background(), finished.ID, models.StatusDone))
+
+	waiting, err := repo.CreateTask(context.Background(), models.TaskOptions{})
+	assert.NoError(t, err)
+
+	assert.ErrorIs(t, repo.DeleteTask(context.Background(), waiting.ID), errs.ErrInvalidTaskStatus)
+	assert.ErrorIs(t, repo.DeleteTask(context.Background(), 999999), errs.ErrTaskNotFound)
+
+	assert.NoError(t, repo.DeleteTask(context.Background(), finished.ID))
+	_, err = repo.GetTask(context.Background(), finished.ID)
+	assert.ErrorIs(t, err, errs.ErrTaskNotFound)
+	assert.Equal(t, 1, repo.GetActiveTasksCount())
+}
+
+func TestPurgeTasks(t *testing.T) {
+	dataDir := t.TempDir()
+	repo, err := CreatePersistentTaskRepository(2, dataDir, WithQueueSize(1))
+	assert.NoError(t, err)
+
+	done, err := repo.CreateTask(context.Background(), models.TaskOptions{})
+	assert.NoError(t, err)
+	failed, err := repo.CreateTask(context.Background(), models.TaskOptions{})
+	assert.NoError(t, err)
+	queued, err := repo.CreateTask(context.Background(), models.TaskOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, models.StatusQueued, queued.Status)
+
+	assert.NoError(t, repo.UpdateTaskStatus(context.Background(), done.ID, models.StatusDone))
+	assert.NoError(t, repo.UpdateTaskStatus(context.Background(), failed.ID, models.StatusProcessing))
+	assert.NoError(t, repo.UpdateTaskStatus(context.Background(), failed.ID, models.StatusFailed))
+	active, err := repo.CreateTask(context.Background(), models.TaskOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, repo.GetActiveTasksCount())
+
+	// nothing finished before an hour ago
+	purged, err := repo.PurgeTasks(context.Background(), models.PurgeFilter{FinishedBefore: time.Now().Add(-time.Hour)})
+	assert.NoError(t, err)
+	assert.Empty(t, purged)
+
+	purged, err = repo.PurgeTasks(context.Background(), models.PurgeFilter{Statuses: []models.TaskStatus{models.StatusFailed}})
+	assert.NoError(t, err)
+	require.Len(t, purged, 1)
+	assert.Equal(t, failed.ID, purged[0].ID)
+	assert.Equal(t, 2, repo.GetActiveTasksCount())
+
+	// an empty filter takes every finished task but never an active one
+	purged, err = repo.PurgeTasks(context.Background(), models.PurgeFilter{})
+	assert.NoError(t, err)
+	require.Len(t, purged, 1)
+	assert.Equal(t, done.ID, purged[0].ID)
+	assert.Equal(t, 2, repo.GetActiveTasksCount())
+
+	tasks, err := repo.GetAllTasks(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 2)
+
+	// slots are still handed out correctly afterwards
+	next, err := repo.CreateTask(context.Background(), models.TaskOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, models.StatusQueued, next.Status)
+	_, err = repo.CreateTask(context.Background(), models.TaskOptions{})
+	assert.ErrorIs(t, err, errs.ErrMaxTasksReached)
+	assert.NoError(t, repo.UpdateTaskStatus(context.Background(), active.ID, models.StatusDone))
+	assert.Equal(t, 2, repo.GetActiveTasksCount())
+	assert.Zero(t, repo.GetQueuedTasksCount())
+	assert.NoError(t, repo.Close())
+
+	// the deletions survive a restart
+	restored, err := CreatePersistentTaskRepository(2, dataDir, WithQueueSize(1))
+	assert.NoError(t, err)
+	defer restored.Close()
+	tasks, err = restored.GetAllTasks(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 3)
+	assert.Equal(t, 2, restored.GetActiveTasksCount())
+}
+
+func TestRetryTask(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer testServer.Close()
+
+	dataDir := t.TempDir()
+	repo, err := CreatePersistentTaskRepository(1, dataDir)
+	require.NoError(t, err)
+
+	created, err := repo.CreateTask(context.Background(), models.TaskOptions{})
+	require.NoError(t, err)
+	_, err = repo.AddObject(context.Background(), created.ID, testServer.URL+"/a.pdf", "")
+	require.NoError(t, err)
+	task, err := repo.AddObject(context.Background(), created.ID, testServer.URL+"/b.pdf", "")
+	require.NoError(t, err)
+
+	archived, failed := task.Objects[0], task.Objects[1]
+	archived.State, archived.ArchiveName = models.ObjectArchived, "a.pdf"
+	failed.State, failed.Error = models.ObjectFailed, "invalid response status: 404"
+	require.NoError(t, repo.UpdateObject(context.Background(), created.ID, archived))
+	require.NoError(t, repo.UpdateObject(context.Background(), created.ID, failed))
+	require.NoError(t, repo.UpdateTaskStatus(context.Background(), created.ID, models.StatusProcessing))
+	require.NoError(t, repo.SetArchiveStats(context.Background(), created.ID, models.ArchiveStats{ArchiveSize: 10}))
+	require.NoError(t, repo.UpdateTaskStatus(context.Background(), created.ID, models.StatusDone))
+	assert.Zero(t, repo.GetActiveTasksCount())
+
+	_, err = repo.RetryTask(context.Background(), 999999, false)
+	assert.ErrorIs(t, err, errs.ErrTaskNotFound)
+
+	// only the failed object is downloaded again
+	task, err = repo.RetryTask(context.Background(), created.ID, false)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusProcessing, task.Status)
+	assert.Equal(t, 2, task.ArchiveVersion)
+	assert.Nil(t, task.Stats)
+	assert.Nil(t, task.FinishedAt)
+	assert.Equal(t, models.ObjectArchived, task.Objects[0].State)
+	assert.Equal(t, "a.pdf", task.Objects[0].ArchiveName)
+	assert.Equal(t, models.ObjectPending, task.Objects[1].State)
+	assert.Empty(t, task.Objects[1].Error)
+	assert.Equal(t, 1, repo.GetActiveTasksCount())
+
+	_, err = repo.RetryTask(context.Background(), created.ID, false)
+	assert.ErrorIs(t, err, errs.ErrInvalidTaskStatus)
+	require.NoError(t, repo.UpdateTaskStatus(context.Background(), created.ID, models.StatusFailed))
+
+	// a retry needs a free slot like a new task does
+	other, err := repo.CreateTask(context.Background(), models.TaskOptions{})
+	require.NoError(t, err)
+	_, err = repo.RetryTask(context.Background(), created.ID, true)
+	assert.ErrorIs(t, err, errs.ErrMaxTasksReached)
+	require.NoError(t, repo.UpdateTaskStatus(context.Background(), other.ID, models.StatusCancelled))
+
+	task, err = repo.RetryTask(context.Background(), created.ID, true)
+	require.NoError(t, err)
+	assert.Equal(t, 3, task.ArchiveVersion)
+	for _, obj := range task.Objects {
+		assert.Equal(t, models.ObjectPending, obj.State)
+		assert.Empty(t, obj.ArchiveName)
+	}
+	require.NoError(t, repo.Close())
+
+	restored, err := CreatePersistentTaskRepository(1, dataDir)
+	require.NoError(t, err)
+	defer restored.Close()
+	task, err = restored.GetTask(context.Background(), created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 3, task.ArchiveVersion)
+	assert.Equal(t, 1, restored.GetActiveTasksCount())
+}
+
+func TestUpdateObject(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer testServer.Close()
+
+	repo := CreateTaskRepository(5)
+	createdTask, err := repo.CreateTask(context.Background(), models.TaskOptions{})
+	assert.NoError(t, err)
+	task, err := repo.AddObject(context.Background(), createdTask.ID, testServer.URL+"/a.pdf", "")
+	assert.NoError(t, err)
+	assert.Equal(t, models.ObjectPending, task.Objects[0].State)
+
+	obj := task.Objects[0]
+	obj.State = models.ObjectFailed
+	obj.Error = "invalid response status: 404"
+	obj.HTTPStatus = http.StatusNotFound
+
+	assert.NoError(t, repo.UpdateObject(context.Background(), createdTask.ID, obj))
+
+	task, err = repo.GetTask(context.Background(), createdTask.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.ObjectFailed, task.Objects[0].State)
+	assert.Equal(t, http.StatusNotFound, task.Objects[0].HTTPStatus)
+	assert.Equal(t, "invalid response status: 404", task.Objects[0].Error)
+
+	err = repo.UpdateObject(context.Background(), createdTask.ID, &models.Object{ID: 1})
+	assert.ErrorIs(t, err, errs.ErrObjectNotFound)
+
+	err = repo.UpdateObject(context.Background(), 999999, obj)
+	assert.ErrorIs(t, err, errs.ErrTaskNotFound)
+}
+
+func TestNextID_Unique(t *testing.T) {
+	repo := CreateTaskRepository(5)
+	seen := make(map[int64]bool)
+
+	for range 1000 {
+		id := repo.nextID()
+		assert.False(t, seen[id])
+		seen[id] = true
+	}
+}
+
+func TestAddObject_RetriesTransientProbeFailure(t *testing.T) {
+	requests := 0
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer testServer.Close()
+
+	repo := CreateTaskRepository(5, WithRetryPolicy(retry.Policy{
+		MaxAttempts: 3,
+		BaseBackoff: time.Millisecond,
+		MaxBackoff:  10 * time.Millisecond,
+	}))
+	createdTask, err := repo.CreateTask(context.Background(), models.TaskOptions{})
+	assert.NoError(t, err)
+
+	task, err := repo.AddObject(context.Background(), createdTask.ID, testServer.URL+"/a.pdf", "")
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, requests)
+	attempts := task.Objects[0].Attempts
+	assert.Len(t, attempts, 2)
+	assert.Equal(t, models.PhaseProbe, attempts[0].Phase)
+	assert.Equal(t, http.StatusServiceUnavailable, attempts[0].HTTPStatus)
+	assert.NotEmpty(t, attempts[0].Error)
+	assert.Equal(t, http.StatusOK, attempts[1].HTTPStatus)
+	assert.Empty(t, attempts[1].Error)
+}
+
+func TestAddObject_ProbeDoesNotRetryNotFound(t *testing.T) {
+	requests := 0
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer testServer.Close()
+
+	repo := CreateTaskRepository(5)
+	createdTask, err := repo.CreateTask(context.Background(), models.TaskOptions{})
+	assert.NoError(t, err)
+
+	task, err := repo.AddObject(context.Background(), createdTask.ID, testServer.URL+"/a.pdf", "")
+
+	assert.Nil(t, task)
+	assert.ErrorIs(t, err, errs.ErrFileUnavailable)
+	assert.Equal(t, 1, requests)
+}
+
+func TestAddObject_ForbiddenURL(t *testing.T) {
+	requests := 0
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer testServer.Close()
+
+	guarded, err := fetcher.New(fetcher.Config{Guard: &fetcher.Guard{}})
+	assert.NoError(t, err)
+
+	repo := CreateTaskRepository(5, WithFetcher(guarded))
+	createdTask, err := repo.CreateTask(context.Background(), models.TaskOptions{})
+	assert.NoError(t, err)
+
+	task, err := repo.AddObject(context.Background(), createdTask.ID, testServer.URL+"/a.pdf", "")
+
+	assert.Nil(t, task)
+	assert.ErrorIs(t, err, errs.ErrForbiddenURL)
+	assert.NotErrorIs(t, err, errs.ErrFileUnavailable)
+	assert.Equal(t, 0, requests)
+}
+
+func TestAddObject_SizeLimits(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		size := "40"
+		if strings.HasSuffix(r.URL.Path, "big.pdf") {
+			size = "1000"
+		}
+		w.Header().Set("Content-Length", size)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer testServer.Close()
+
+	repo := CreateTaskRepository(5, WithSizeLimits(100, 100))
+	createdTask, err := repo.CreateTask(context.Background(), models.TaskOptions{})
+	assert.NoError(t, err)
+
+	_, err = repo.AddObject(context.Background(), createdTask.ID, testServer.URL+"/big.pdf", "")
+	assert.ErrorIs(t, err, errs.ErrFileTooLarge)
+
+	task, err := repo.AddObject(context.Background(), createdTask.ID, testServer.URL+"/a.pdf", "")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(40), task.Objects[0].Size)
+
+	_, err = repo.AddObject(context.Background(), createdTask.ID, testServer.URL+"/b.pdf", "")
+	assert.NoError(t, err)
+
+	_, err = repo.AddObject(context.Background(), createdTask.ID, testServer.URL+"/c.pdf", "")
+	assert.ErrorIs(t, err, errs.ErrArchiveTooLarge)
+}
@@ -0,0 +1,97 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/supchaser/test_task/internal/app/models"
+	"github.com/supchaser/test_task/internal/utils/errs"
+	"github.com/supchaser/test_task/internal/utils/logger"
+	"go.uber.org/zap"
+)
+
+// errTaskCancelled is the cancellation cause of work stopped by CancelTask.
+var errTaskCancelled = errors.New("task cancelled")
+
+// CancelTask aborts the task in whatever state it is. A queued or waiting
+// task gives up its place or slot; a running archive job is stopped and
+// its output removed. Cancelling a finished task changes nothing.
+func (u *TaskUsecase) CancelTask(ctx context.Context, taskID int64) (*models.Task, error) {
+	const funcName = "TaskUsecase.CancelTask"
+	logger.Debug("cancelling task",
+		zap.String("function", funcName),
+		zap.Int64("task_id", taskID),
+	)
+
+	task, err := u.taskRepository.GetTask(ctx, taskID)
+	if err != nil {
+		logger.Error("failed to get task",
+			zap.String("function", funcName),
+			zap.Int64("task_id", taskID),
+			zap.Error(err),
+		)
+		return nil, err
+	}
+	if task.Status.IsFinished() {
+		return task, nil
+	}
+
+	// the status goes first: once the task is cancelled a job that is just
+	// finishing can no longer mark it done
+	if err := u.taskRepository.UpdateTaskStatus(ctx, taskID, models.StatusCancelled); err != nil {
+		if errors.Is(err, errs.ErrInvalidTaskStatus) {
+			// it finished in the meantime
+			return u.taskRepository.GetTask(ctx, taskID)
+		}
+		logger.Error("failed to update task status",
+			zap.String("function", funcName),
+			zap.Int64("task_id", taskID),
+			zap.Error(err),
+		)
+		return nil, err
+	}
+
+	if done := u.jobs.stop(taskID, errTaskCancelled); done != nil {
+		<-done
+		logger.Info("archive job stopped",
+			zap.String("function", funcName),
+			zap.Int64("task_id", taskID),
+		)
+	}
+
+	// the job may have stored the archive before it noticed; earlier versions
+	// of a retried task stay until the task is removed
+	key := archiveKey(task.ID, task.Format, archiveVersion(task))
+	if err := u.store.Delete(context.WithoutCancel(ctx), key); err != nil {
+		logger.Warn("failed to remove archive of cancelled task",
+			zap.String("function", funcName),
+			zap.Int64("task_id", taskID),
+			zap.String("archive_key", key),
+			zap.Error(err),
+		)
+	}
+
+	logger.Info("task cancelled",
+		zap.String("function", funcName),
+		zap.Int64("task_id", taskID),
+		zap.String("previous_status", string(task.Status)),
+	)
+
+	task, err = u.taskRepository.GetTask(ctx, taskID)
+	if err != nil {
+		return nil, fmt.Errorf("get cancelled task: %w", err)
+	}
+	return task, nil
+}
+
+// taskCancelled reports whether the task has been cancelled in the meantime.
+// A job checks it before it stores anything, so a cancellation that did not
+// reach the job in time still leaves no archive behind.
+func (u *TaskUsecase) taskCancelled(ctx context.Context, taskID int64) bool {
+	task, err := u.taskRepository.GetTask(context.WithoutCancel(ctx), taskID)
+	if err != nil {
+		return false
+	}
+	return task.Status == models.StatusCancelled
+}
@@ -0,0 +1,170 @@
+package usecase
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	mock_app "github.com/supchaser/test_task/internal/app/mocks"
+	"github.com/supchaser/test_task/internal/app/models"
+	"github.com/supchaser/test_task/internal/storage"
+	"github.com/supchaser/test_task/internal/utils/errs"
+)
+
+func TestTaskUsecase_CancelTask_Waiting(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mock_app.NewMockTaskRepository(ctrl)
+	gomock.InOrder(
+		mockRepo.EXPECT().GetTask(gomock.Any(), int64(1)).Return(&models.Task{ID: 1, Status: models.StatusWaiting}, nil),
+		mockRepo.EXPECT().UpdateTaskStatus(gomock.Any(), int64(1), models.StatusCancelled).Return(nil),
+		mockRepo.EXPECT().GetTask(gomock.Any(), int64(1)).Return(&models.Task{ID: 1, Status: models.StatusCancelled}, nil),
+	)
+
+	uc := CreateTaskUsecase(mockRepo, t.TempDir(), WithArchiveStore(storage.NewMemory()))
+	task, err := uc.CancelTask(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusCancelled, task.Status)
+}
+
+func TestTaskUsecase_CancelTask_Finished(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mock_app.NewMockTaskRepository(ctrl)
+	mockRepo.EXPECT().GetTask(gomock.Any(), int64(1)).Return(&models.Task{ID: 1, Status: models.StatusDone}, nil)
+
+	store := storage.NewMemory()
+	require.NoError(t, store.Put(context.Background(), "task_1.zip", strings.NewReader("zip"), 3))
+
+	uc := CreateTaskUsecase(mockRepo, t.TempDir(), WithArchiveStore(store))
+	task, err := uc.CancelTask(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusDone, task.Status)
+
+	_, err = store.Stat(context.Background(), "task_1.zip")
+	assert.NoError(t, err, "the archive of a finished task is kept")
+}
+
+func TestTaskUsecase_CancelTask_FinishedMeanwhile(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mock_app.NewMockTaskRepository(ctrl)
+	gomock.InOrder(
+		mockRepo.EXPECT().GetTask(gomock.Any(), int64(1)).Return(&models.Task{ID: 1, Status: models.StatusProcessing}, nil),
+		mockRepo.EXPECT().UpdateTaskStatus(gomock.Any(), int64(1), models.StatusCancelled).Return(errs.ErrInvalidTaskStatus),
+		mockRepo.EXPECT().GetTask(gomock.Any(), int64(1)).Return(&models.Task{ID: 1, Status: models.StatusDone}, nil),
+	)
+
+	uc := CreateTaskUsecase(mockRepo, t.TempDir())
+	task, err := uc.CancelTask(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusDone, task.Status)
+}
+
+func TestTaskUsecase_CancelTask_Processing(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mock_app.NewMockTaskRepository(ctrl)
+	gomock.InOrder(
+		mockRepo.EXPECT().GetTask(gomock.Any(), int64(1)).Return(&models.Task{ID: 1, Status: models.StatusProcessing}, nil),
+		mockRepo.EXPECT().UpdateTaskStatus(gomock.Any(), int64(1), models.StatusCancelled).Return(nil),
+		mockRepo.EXPECT().GetTask(gomock.Any(), int64(1)).Return(&models.Task{ID: 1, Status: models.StatusCancelled}, nil),
+	)
+
+	store := storage.NewMemory()
+	uc := CreateTaskUsecase(mockRepo, t.TempDir(), WithArchiveStore(store))
+
+	started := make(chan struct{})
+	var cause error
+	require.NoError(t, uc.jobs.start(context.Background(), "test", 1, func(ctx context.Context, taskID int64) {
+		close(started)
+		<-ctx.Done()
+		cause = context.Cause(ctx)
+		// the archive made it to the store just before the job noticed
+		store.Put(context.Background(), "task_1.zip", strings.NewReader("zip"), 3)
+	}))
+	<-started
+
+	_, err := uc.CancelTask(context.Background(), 1)
+	require.NoError(t, err)
+	assert.ErrorIs(t, cause, errTaskCancelled, "CancelTask returns only after the job did")
+
+	_, err = store.Stat(context.Background(), "task_1.zip")
+	assert.ErrorIs(t, err, storage.ErrNotFound, "partial output is removed")
+}
+
+func TestTaskUsecase_buildArchive_CancelledByRequest(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mock_app.NewMockTaskRepository(ctrl)
+	mockRepo.EXPECT().
+		GetTask(gomock.Any(), int64(1)).
+		Return(&models.Task{
+			ID:      1,
+			Status:  models.StatusProcessing,
+			Objects: []*models.Object{{URL: "http://example.com/doc.pdf"}},
+		}, nil)
+	// CancelTask has set the final status, the job leaves it alone
+
+	uc := CreateTaskUsecase(mockRepo, t.TempDir())
+	ctx, cancel := context.WithCancelCause(context.Background())
+	cancel(errTaskCancelled)
+	uc.buildArchive(ctx, 1)
+}
+
+func TestTaskUsecase_buildArchive_CancelledMeanwhile(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Write([]byte("%PDF-cancelled"))
+	}))
+	defer testServer.Close()
+
+	tests := []struct {
+		name string
+		// checks is the number of status reads that still see the task processing
+		checks int
+	}{
+		{name: "BeforeStore", checks: 0},
+		{name: "WhileStoring", checks: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			task := &models.Task{
+				ID:      1,
+				Status:  models.StatusProcessing,
+				Objects: []*models.Object{{URL: testServer.URL + "/doc.pdf"}},
+			}
+			mockRepo := mock_app.NewMockTaskRepository(ctrl)
+			calls := []*gomock.Call{mockRepo.EXPECT().GetTask(gomock.Any(), int64(1)).Return(task, nil)}
+			for range tt.checks {
+				calls = append(calls, mockRepo.EXPECT().GetTask(gomock.Any(), int64(1)).Return(task, nil))
+			}
+			// the job was not reached by CancelTask; no stats and no status are saved
+			calls = append(calls, mockRepo.EXPECT().GetTask(gomock.Any(), int64(1)).
+				Return(&models.Task{ID: 1, Status: models.StatusCancelled}, nil))
+			gomock.InOrder(calls...)
+			mockRepo.EXPECT().UpdateObject(gomock.Any(), int64(1), gomock.Any()).Return(nil).AnyTimes()
+
+			store := storage.NewMemory()
+			uc := CreateTaskUsecase(mockRepo, t.TempDir(), WithArchiveStore(store))
+			uc.buildArchive(context.Background(), 1)
+
+			_, err := store.Stat(context.Background(), "task_1.zip")
+			assert.ErrorIs(t, err, storage.ErrNotFound, "a cancelled task keeps no archive")
+		})
+	}
+}
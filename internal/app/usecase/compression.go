@@ -0,0 +1,71 @@
+package usecase
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/supchaser/test_task/internal/app/models"
+	"github.com/supchaser/test_task/internal/archive"
+	"github.com/supchaser/test_task/internal/utils/errs"
+)
+
+// WithCompression sets the compression used by tasks that do not choose
+// their own.
+func WithCompression(compression archive.Compression, level int) Option {
+	return func(u *TaskUsecase) {
+		u.compression = compression
+		u.compressionLevel = level
+	}
+}
+
+// normalizeCompression validates the compression options of a new task and
+// stores the method under its canonical name.
+func normalizeCompression(opts *models.TaskOptions) error {
+	if opts.Compression != "" {
+		compression, err := archive.ParseCompression(opts.Compression)
+		if err != nil {
+			return fmt.Errorf("%w: %w", errs.ErrInvalidCompression, err)
+		}
+		opts.Compression = string(compression)
+	}
+
+	if opts.CompressionLevel != nil {
+		if err := archive.ValidateLevel(*opts.CompressionLevel); err != nil {
+			return fmt.Errorf("%w: %w", errs.ErrInvalidCompression, err)
+		}
+	}
+
+	return nil
+}
+
+// writerOptions returns the archive settings of a task, falling back to the
+// usecase defaults for anything the task did not set.
+func (u *TaskUsecase) writerOptions(task *models.Task) []archive.Option {
+	compression := u.compression
+	if c, err := archive.ParseCompression(task.Compression); task.Compression != "" && err == nil {
+		compression = c
+	}
+
+	level := u.compressionLevel
+	if task.CompressionLevel != nil {
+		level = *task.CompressionLevel
+	}
+
+	opts := []archive.Option{archive.WithCompression(compression, level)}
+	if task.Password != "" {
+		opts = append(opts, archive.WithPassword(task.Password))
+	}
+	return opts
+}
+
+func archiveStats(contentSize, archiveSize int64) models.ArchiveStats {
+	stats := models.ArchiveStats{
+		ContentSize: contentSize,
+		ArchiveSize: archiveSize,
+	}
+	if contentSize > 0 {
+		saved := 1 - float64(archiveSize)/float64(contentSize)
+		stats.SavedRatio = math.Round(saved*1000) / 1000
+	}
+	return stats
+}
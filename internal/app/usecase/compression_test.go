@@ -0,0 +1,108 @@
+package usecase
+
+import (
+	"archive/zip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	mock_app "github.com/supchaser/test_task/internal/app/mocks"
+	"github.com/supchaser/test_task/internal/app/models"
+	"github.com/supchaser/test_task/internal/archive"
+	"github.com/supchaser/test_task/internal/utils/errs"
+)
+
+func TestTaskUsecase_CreateTask_Compression(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	level := 9
+	mockRepo := mock_app.NewMockTaskRepository(ctrl)
+	mockRepo.EXPECT().
+		CreateTask(gomock.Any(), models.TaskOptions{Format: "zip", Compression: "auto", CompressionLevel: &level}).
+		Return(&models.Task{ID: 1, Status: models.StatusWaiting}, nil)
+
+	uc := CreateTaskUsecase(mockRepo, "")
+	_, err := uc.CreateTask(context.Background(), models.TaskOptions{Compression: "AUTO", CompressionLevel: &level})
+	assert.NoError(t, err)
+
+	_, err = uc.CreateTask(context.Background(), models.TaskOptions{Compression: "lzma"})
+	assert.ErrorIs(t, err, errs.ErrInvalidCompression)
+
+	badLevel := 12
+	_, err = uc.CreateTask(context.Background(), models.TaskOptions{CompressionLevel: &badLevel})
+	assert.ErrorIs(t, err, errs.ErrInvalidCompression)
+}
+
+func TestTaskUsecase_buildArchive_AutoCompression(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	text := strings.Repeat("compressible text ", 500)
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".jpg") {
+			w.Header().Set("Content-Type", "image/jpeg")
+			w.Write([]byte("\xFF\xD8\xFF" + text))
+			return
+		}
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Write([]byte("%PDF-" + text))
+	}))
+	defer testServer.Close()
+
+	var stats models.ArchiveStats
+	mockRepo := mock_app.NewMockTaskRepository(ctrl)
+	mockRepo.EXPECT().UpdateTaskStatus(gomock.Any(), int64(1), models.StatusProcessing).Return(nil)
+	mockRepo.EXPECT().
+		GetTask(gomock.Any(), int64(1)).
+		Return(&models.Task{
+			ID:          1,
+			Status:      models.StatusProcessing,
+			Compression: "auto",
+			Objects: []*models.Object{
+				{URL: testServer.URL + "/photo.jpg"},
+				{URL: testServer.URL + "/doc.pdf"},
+			},
+		}, nil).AnyTimes()
+	mockRepo.EXPECT().UpdateObject(gomock.Any(), int64(1), gomock.Any()).Return(nil).AnyTimes()
+	mockRepo.EXPECT().
+		SetArchiveStats(gomock.Any(), int64(1), gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ int64, s models.ArchiveStats) error {
+			stats = s
+			return nil
+		})
+	mockRepo.EXPECT().UpdateTaskStatus(gomock.Any(), int64(1), models.StatusDone).Return(nil)
+
+	// the global default would deflate everything, the task asks for auto
+	uc := CreateTaskUsecase(mockRepo, t.TempDir(), WithCompression(archive.CompressionDeflate, archive.MaxLevel))
+	uc.ProcessTask(context.Background(), 1)
+
+	reader, err := zip.OpenReader(filepath.Join(uc.storagePath, archiveKey(1, "", 1)))
+	assert.NoError(t, err)
+	defer reader.Close()
+
+	methods := make(map[string]uint16)
+	for _, f := range reader.File {
+		methods[f.Name] = f.Method
+	}
+	assert.Equal(t, zip.Store, methods["photo.jpg"])
+	assert.Equal(t, zip.Store, methods["doc.pdf"])
+	assert.Equal(t, zip.Deflate, methods["manifest.json"])
+
+	assert.Equal(t, int64(2*len(text)+8), stats.ContentSize)
+	assert.Positive(t, stats.ArchiveSize)
+	assert.Negative(t, stats.SavedRatio)
+}
+
+func TestArchiveStats(t *testing.T) {
+	stats := archiveStats(1000, 250)
+	assert.Equal(t, 0.75, stats.SavedRatio)
+
+	stats = archiveStats(0, 100)
+	assert.Zero(t, stats.SavedRatio)
+}
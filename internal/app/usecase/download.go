@@ -0,0 +1,410 @@
+package usecase
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/supchaser/test_task/internal/app/models"
+	"github.com/supchaser/test_task/internal/utils/errs"
+	"github.com/supchaser/test_task/internal/utils/logger"
+	"github.com/supchaser/test_task/internal/utils/retry"
+	"github.com/supchaser/test_task/internal/utils/validate"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultMaxDownloads        = 8
+	defaultMaxDownloadsPerHost = 2
+)
+
+// WithDownloadLimits caps the number of simultaneous downloads across all
+// tasks and per origin host.
+func WithDownloadLimits(total, perHost int) Option {
+	return func(u *TaskUsecase) {
+		u.downloads = newDownloadLimiter(total, perHost)
+	}
+}
+
+// WithSizeLimits sets the largest object and the largest total size of the
+// files going into one archive, in bytes. Zero disables a limit.
+func WithSizeLimits(maxObject, maxArchive int64) Option {
+	return func(u *TaskUsecase) {
+		u.maxObjectSize = maxObject
+		u.maxArchiveSize = maxArchive
+	}
+}
+
+// downloadLimiter hands out download slots: one global semaphore shared by
+// every task plus a semaphore per host that lives while someone uses it.
+type downloadLimiter struct {
+	total   chan struct{}
+	perHost int
+	mu      sync.Mutex
+	hosts   map[string]*hostSlots
+}
+
+type hostSlots struct {
+	slots chan struct{}
+	users int
+}
+
+func newDownloadLimiter(total, perHost int) *downloadLimiter {
+	if total <= 0 {
+		total = defaultMaxDownloads
+	}
+	if perHost <= 0 {
+		perHost = defaultMaxDownloadsPerHost
+	}
+
+	return &downloadLimiter{
+		total:   make(chan struct{}, total),
+		perHost: perHost,
+		hosts:   make(map[string]*hostSlots),
+	}
+}
+
+// acquire blocks until both a global and a per-host slot are free.
+// The returned function gives both slots back.
+func (l *downloadLimiter) acquire(ctx context.Context, host string) (func(), error) {
+	l.mu.Lock()
+	h, ok := l.hosts[host]
+	if !ok {
+		h = &hostSlots{slots: make(chan struct{}, l.perHost)}
+		l.hosts[host] = h
+	}
+	h.users++
+	l.mu.Unlock()
+
+	leaveHost := func() {
+		l.mu.Lock()
+		h.users--
+		if h.users == 0 {
+			delete(l.hosts, host)
+		}
+		l.mu.Unlock()
+	}
+
+	select {
+	case h.slots <- struct{}{}:
+	case <-ctx.Done():
+		leaveHost()
+		return nil, ctx.Err()
+	}
+
+	select {
+	case l.total <- struct{}{}:
+	case <-ctx.Done():
+		<-h.slots
+		leaveHost()
+		return nil, ctx.Err()
+	}
+
+	return func() {
+		<-l.total
+		<-h.slots
+		leaveHost()
+	}, nil
+}
+
+// downloadResult is the outcome of fetching one object into a temporary file.
+type downloadResult struct {
+	path string
+	// remoteName is the file name suggested by Content-Disposition.
+	remoteName string
+	err        error
+}
+
+// downloadAll fetches every object concurrently within the limiter bounds.
+// Results are index-aligned with objects so the archive keeps request order.
+// The outcome of each download is recorded on the object itself, the
+// received bytes are taken from budget.
+func (u *TaskUsecase) downloadAll(ctx context.Context, taskID int64, objects []*models.Object, budget *archiveBudget) []downloadResult {
+	results := make([]downloadResult, len(objects))
+
+	var wg sync.WaitGroup
+	for i, obj := range objects {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// objects not started before the job was cancelled are left alone
+			if err := ctx.Err(); err != nil {
+				results[i].err = err
+				return
+			}
+
+			obj.State = models.ObjectDownloading
+			obj.Error = ""
+			u.saveObject(ctx, taskID, obj)
+
+			res, err := u.downloadObject(ctx, obj, budget)
+			res.err = err
+			results[i] = res
+			if err != nil {
+				logger.Warn("failed to download file",
+					zap.String("function", "TaskUsecase.downloadAll"),
+					zap.Int64("task_id", taskID),
+					zap.String("url", obj.URL),
+					zap.Error(err),
+				)
+				obj.State = models.ObjectFailed
+				obj.Error = err.Error()
+				u.saveObject(ctx, taskID, obj)
+			}
+		}()
+	}
+	wg.Wait()
+
+	return results
+}
+
+// downloadObject fetches the object into a temporary file, retrying
+// transient failures according to the retry policy. Every attempt is
+// recorded on the object. The received bytes are taken from budget, which
+// may be nil when the archive size is not limited.
+func (u *TaskUsecase) downloadObject(ctx context.Context, obj *models.Object, budget *archiveBudget) (downloadResult, error) {
+	parsed, err := url.Parse(obj.URL)
+	if err != nil {
+		return downloadResult{}, fmt.Errorf("parse url: %w", err)
+	}
+
+	started := time.Now()
+	defer func() {
+		obj.DurationMs = time.Since(started).Milliseconds()
+	}()
+
+	var res downloadResult
+	err = u.retryPolicy.Do(ctx, func(number int) error {
+		attempt := models.Attempt{
+			Phase:     models.PhaseDownload,
+			Number:    number,
+			StartedAt: time.Now(),
+		}
+
+		var err error
+		res, err = u.downloadAttempt(ctx, parsed.Host, obj, &attempt, budget)
+		if err != nil {
+			attempt.Error = err.Error()
+		}
+		obj.Attempts = append(obj.Attempts, attempt)
+		return err
+	})
+	if err != nil {
+		return downloadResult{}, err
+	}
+
+	return res, nil
+}
+
+func (u *TaskUsecase) downloadAttempt(ctx context.Context, host string, obj *models.Object, attempt *models.Attempt, budget *archiveBudget) (downloadResult, error) {
+	// the slot is held per attempt so that backoff does not block other downloads
+	release, err := u.downloads.acquire(ctx, host)
+	if err != nil {
+		return downloadResult{}, err
+	}
+	defer release()
+
+	resp, err := u.fetcher.Get(ctx, obj.URL)
+	if err != nil {
+		if retry.IsRetryableError(ctx, err) {
+			return downloadResult{}, retry.Retryable(err, 0)
+		}
+		return downloadResult{}, err
+	}
+	defer resp.Body.Close()
+
+	obj.HTTPStatus = resp.StatusCode
+	attempt.HTTPStatus = resp.StatusCode
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("invalid response status: %d", resp.StatusCode)
+		if retry.IsRetryableStatus(resp.StatusCode) {
+			return downloadResult{}, retry.Retryable(err, retry.ParseRetryAfter(resp.Header.Get("Retry-After")))
+		}
+		return downloadResult{}, err
+	}
+
+	declared := u.filePolicy.DeclaredType(resp.Header, obj.URL)
+	if err := u.filePolicy.ValidateDeclaredType(declared); err != nil {
+		return downloadResult{}, err
+	}
+
+	// the magic bytes are checked before anything is written to disk
+	body := bufio.NewReaderSize(resp.Body, sniffLen)
+	head, err := body.Peek(sniffLen)
+	if err != nil && !errors.Is(err, io.EOF) {
+		err = fmt.Errorf("read response body: %w", err)
+		if retry.IsRetryableError(ctx, err) {
+			return downloadResult{}, retry.Retryable(err, 0)
+		}
+		return downloadResult{}, err
+	}
+	contentType, err := u.filePolicy.ValidateContent(declared, head)
+	obj.ContentType = contentType
+	if err != nil {
+		return downloadResult{}, err
+	}
+	if resp.ContentLength > 0 {
+		if err := u.checkObjectSize(contentType, resp.ContentLength); err != nil {
+			return downloadResult{}, err
+		}
+		if err := budget.fits(resp.ContentLength); err != nil {
+			return downloadResult{}, err
+		}
+	}
+
+	var reader io.Reader = body
+	limit := u.objectSizeLimit(contentType)
+	if limit > 0 {
+		// one byte over the limit is enough to tell the file is too large
+		reader = io.LimitReader(body, limit+1)
+	}
+
+	file, err := os.CreateTemp(u.storagePath, ".download-*")
+	if err != nil {
+		return downloadResult{}, fmt.Errorf("create temp file: %w", err)
+	}
+
+	hash := sha256.New()
+	share := budget.share()
+	size, err := io.Copy(io.MultiWriter(file, hash, share), reader)
+	if err == nil && limit > 0 && size > limit {
+		err = u.checkObjectSize(contentType, size)
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		share.release()
+		if errors.Is(err, errs.ErrFileTooLarge) || errors.Is(err, errs.ErrArchiveTooLarge) {
+			return downloadResult{}, err
+		}
+		err = fmt.Errorf("save response body: %w", err)
+		// a connection dropped in the middle of the body is transient as well
+		if retry.IsRetryableError(ctx, err) {
+			return downloadResult{}, retry.Retryable(err, 0)
+		}
+		return downloadResult{}, err
+	}
+
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		share.release()
+		return downloadResult{}, fmt.Errorf("close temp file: %w", err)
+	}
+
+	obj.Size = size
+	obj.SHA256 = hex.EncodeToString(hash.Sum(nil))
+
+	return downloadResult{
+		path:       file.Name(),
+		remoteName: validate.DispositionFilename(resp.Header.Get("Content-Disposition")),
+	}, nil
+}
+
+// checkObjectSize applies the limit of the file type and the global
+// per-object limit.
+func (u *TaskUsecase) checkObjectSize(contentType string, size int64) error {
+	if err := u.filePolicy.ValidateSize(contentType, size); err != nil {
+		return err
+	}
+	return validate.ValidateObjectSize(size, u.maxObjectSize)
+}
+
+// objectSizeLimit is the tighter of the type and the global per-object limits, 0 if none.
+func (u *TaskUsecase) objectSizeLimit(contentType string) int64 {
+	limit := u.filePolicy.MaxSize(contentType)
+	if u.maxObjectSize > 0 && (limit == 0 || u.maxObjectSize < limit) {
+		limit = u.maxObjectSize
+	}
+	return limit
+}
+
+// archiveBudget is the number of bytes all objects of one archive may take
+// together. Concurrent downloads draw from it as they write; an object that
+// would overdraw it fails and gives back what it took, so the rest of the
+// archive can still be built. A nil budget is unlimited.
+type archiveBudget struct {
+	limit int64
+	used  atomic.Int64
+}
+
+func newArchiveBudget(limit int64) *archiveBudget {
+	if limit <= 0 {
+		return nil
+	}
+	return &archiveBudget{limit: limit}
+}
+
+// fits checks up front whether size bytes are still available.
+func (b *archiveBudget) fits(size int64) error {
+	if b == nil {
+		return nil
+	}
+	return validate.ValidateArchiveSize(b.used.Load()+size, b.limit)
+}
+
+// reserve takes size bytes for content that is already in the archive.
+func (b *archiveBudget) reserve(size int64) {
+	if b == nil {
+		return
+	}
+	b.used.Add(size)
+}
+
+func (b *archiveBudget) share() *budgetShare {
+	return &budgetShare{budget: b}
+}
+
+// budgetShare is what one download attempt took from the budget.
+type budgetShare struct {
+	budget *archiveBudget
+	taken  int64
+}
+
+func (s *budgetShare) Write(p []byte) (int, error) {
+	if s.budget == nil {
+		return len(p), nil
+	}
+
+	n := int64(len(p))
+	if used := s.budget.used.Add(n); used > s.budget.limit {
+		s.budget.used.Add(-n)
+		return 0, validate.ValidateArchiveSize(used, s.budget.limit)
+	}
+	s.taken += n
+	return len(p), nil
+}
+
+func (s *budgetShare) release() {
+	if s.budget == nil {
+		return
+	}
+	s.budget.used.Add(-s.taken)
+	s.taken = 0
+}
+
+// saveObject stores the object state; failures are only logged because the
+// archive itself is still worth finishing.
+func (u *TaskUsecase) saveObject(ctx context.Context, taskID int64, obj *models.Object) {
+	if err := u.taskRepository.UpdateObject(ctx, taskID, obj); err != nil {
+		logger.Warn("failed to save object state",
+			zap.String("function", "TaskUsecase.saveObject"),
+			zap.Int64("task_id", taskID),
+			zap.Int64("object_id", obj.ID),
+			zap.Error(err),
+		)
+	}
+}
+
+// sniffLen is the amount of data looked at to detect the content type.
+const sniffLen = 512
@@ -0,0 +1,467 @@
+package usecase
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	mock_app "github.com/supchaser/test_task/internal/app/mocks"
+	"github.com/supchaser/test_task/internal/app/models"
+	"github.com/supchaser/test_task/internal/utils/errs"
+	"github.com/supchaser/test_task/internal/utils/retry"
+	"github.com/supchaser/test_task/internal/utils/validate"
+)
+
+func TestDownloadLimiter_PerHost(t *testing.T) {
+	var current, peak int32
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&current, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&current, -1)
+		w.Write([]byte("%PDF-1.4"))
+	}))
+	defer testServer.Close()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mock_app.NewMockTaskRepository(ctrl)
+	mockRepo.EXPECT().UpdateObject(gomock.Any(), int64(1), gomock.Any()).Return(nil).AnyTimes()
+
+	uc := CreateTaskUsecase(mockRepo, t.TempDir(), WithDownloadLimits(10, 2))
+
+	objects := make([]*models.Object, 6)
+	for i := range objects {
+		objects[i] = &models.Object{URL: testServer.URL + "/file.pdf"}
+	}
+
+	results := uc.downloadAll(context.Background(), 1, objects, newArchiveBudget(uc.maxArchiveSize))
+
+	for _, res := range results {
+		assert.NoError(t, res.err)
+		os.Remove(res.path)
+	}
+	assert.LessOrEqual(t, atomic.LoadInt32(&peak), int32(2))
+	assert.Empty(t, uc.downloads.hosts)
+}
+
+func TestTaskUsecase_downloadAll_ScriptURL(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write([]byte("%PDF-1.4 served by a script"))
+	}))
+	defer testServer.Close()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mock_app.NewMockTaskRepository(ctrl)
+	mockRepo.EXPECT().UpdateObject(gomock.Any(), int64(1), gomock.Any()).Return(nil).AnyTimes()
+
+	uc := CreateTaskUsecase(mockRepo, t.TempDir())
+
+	// the path says php or html, the content decides
+	objects := []*models.Object{
+		{URL: testServer.URL + "/get.php?id=5"},
+		{URL: testServer.URL + "/download.html"},
+	}
+	results := uc.downloadAll(context.Background(), 1, objects, nil)
+
+	for i, res := range results {
+		assert.NoError(t, res.err)
+		assert.Equal(t, "application/pdf", objects[i].ContentType)
+		os.Remove(res.path)
+	}
+}
+
+func TestDownloadLimiter_CancelledWhileWaiting(t *testing.T) {
+	limiter := newDownloadLimiter(1, 1)
+
+	release, err := limiter.acquire(context.Background(), "example.com")
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err = limiter.acquire(ctx, "example.com")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	release()
+	assert.Empty(t, limiter.hosts)
+}
+
+func TestTaskUsecase_buildArchive_KeepsRequestOrder(t *testing.T) {
+	tempDir := t.TempDir()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the first object is the slowest one, it must still come first
+		if strings.HasSuffix(r.URL.Path, "first.pdf") {
+			time.Sleep(50 * time.Millisecond)
+		}
+		if strings.HasSuffix(r.URL.Path, "missing.pdf") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, ".jpg") {
+			w.Write([]byte("\xFF\xD8\xFF" + r.URL.Path))
+			return
+		}
+		w.Write([]byte("%PDF-" + r.URL.Path))
+	}))
+	defer testServer.Close()
+
+	objects := []*models.Object{
+		{URL: testServer.URL + "/first.pdf"},
+		{URL: testServer.URL + "/missing.pdf"},
+		{URL: testServer.URL + "/second.pdf"},
+		{URL: testServer.URL + "/third.jpg"},
+	}
+
+	mockRepo := mock_app.NewMockTaskRepository(ctrl)
+	mockRepo.EXPECT().UpdateTaskStatus(gomock.Any(), int64(1), models.StatusProcessing).Return(nil)
+	mockRepo.EXPECT().
+		GetTask(gomock.Any(), int64(1)).
+		Return(&models.Task{ID: 1, Status: models.StatusProcessing, Objects: objects}, nil).AnyTimes()
+	mockRepo.EXPECT().SetArchiveStats(gomock.Any(), int64(1), gomock.Any()).Return(nil)
+	mockRepo.EXPECT().UpdateTaskStatus(gomock.Any(), int64(1), models.StatusDone).Return(nil)
+
+	saved := make(map[string]models.Object)
+	var mu sync.Mutex
+	mockRepo.EXPECT().
+		UpdateObject(gomock.Any(), int64(1), gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ int64, obj *models.Object) error {
+			mu.Lock()
+			defer mu.Unlock()
+			saved[obj.URL] = *obj
+			return nil
+		}).
+		AnyTimes()
+
+	uc := CreateTaskUsecase(mockRepo, tempDir)
+	uc.ProcessTask(context.Background(), 1)
+
+	reader, err := zip.OpenReader(filepath.Join(uc.storagePath, archiveKey(1, "", 1)))
+	assert.NoError(t, err)
+	defer reader.Close()
+
+	names := make([]string, 0, len(reader.File))
+	for _, f := range reader.File {
+		names = append(names, f.Name)
+	}
+	assert.Equal(t, []string{"first.pdf", "second.pdf", "third.jpg", "manifest.json"}, names)
+
+	manifestFile, err := reader.Open("manifest.json")
+	assert.NoError(t, err)
+	defer manifestFile.Close()
+	var manifest models.Manifest
+	assert.NoError(t, json.NewDecoder(manifestFile).Decode(&manifest))
+	assert.Equal(t, int64(1), manifest.TaskID)
+	assert.Equal(t, 3, manifest.Archived)
+	assert.Equal(t, 1, manifest.Failed)
+	assert.Len(t, manifest.Objects, 4)
+	assert.Equal(t, "first.pdf", manifest.Objects[0].Name)
+	assert.Equal(t, sha256Hex("%PDF-/first.pdf"), manifest.Objects[0].SHA256)
+	assert.Equal(t, testServer.URL+"/missing.pdf", manifest.Objects[1].URL)
+	assert.Equal(t, models.ObjectFailed, manifest.Objects[1].State)
+	assert.Empty(t, manifest.Objects[1].Name)
+	assert.Contains(t, manifest.Objects[1].Error, "404")
+
+	first := saved[testServer.URL+"/first.pdf"]
+	assert.Equal(t, models.ObjectArchived, first.State)
+	assert.Equal(t, http.StatusOK, first.HTTPStatus)
+	assert.Equal(t, int64(len("%PDF-/first.pdf")), first.Size)
+	assert.Equal(t, sha256Hex("%PDF-/first.pdf"), first.SHA256)
+	assert.Equal(t, "application/pdf", first.ContentType)
+
+	missing := saved[testServer.URL+"/missing.pdf"]
+	assert.Equal(t, models.ObjectFailed, missing.State)
+	assert.Equal(t, http.StatusNotFound, missing.HTTPStatus)
+	assert.Contains(t, missing.Error, "404")
+
+	leftovers, err := filepath.Glob(filepath.Join(tempDir, ".download-*"))
+	assert.NoError(t, err)
+	assert.Empty(t, leftovers)
+}
+
+func sha256Hex(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestTaskUsecase_downloadObject_Retries(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var requests int32
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte("%PDF-1.4"))
+	}))
+	defer testServer.Close()
+
+	uc := CreateTaskUsecase(mock_app.NewMockTaskRepository(ctrl), t.TempDir(), WithRetryPolicy(retry.Policy{
+		MaxAttempts: 3,
+		BaseBackoff: time.Millisecond,
+		MaxBackoff:  10 * time.Millisecond,
+	}))
+
+	obj := &models.Object{URL: testServer.URL + "/doc.pdf"}
+	res, err := uc.downloadObject(context.Background(), obj, nil)
+
+	assert.NoError(t, err)
+	defer os.Remove(res.path)
+	assert.Len(t, obj.Attempts, 3)
+	assert.Equal(t, models.PhaseDownload, obj.Attempts[0].Phase)
+	assert.Equal(t, http.StatusBadGateway, obj.Attempts[0].HTTPStatus)
+	assert.Contains(t, obj.Attempts[1].Error, "502")
+	assert.Empty(t, obj.Attempts[2].Error)
+	assert.Equal(t, http.StatusOK, obj.HTTPStatus)
+}
+
+func TestTaskUsecase_downloadObject_GivesUp(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer testServer.Close()
+
+	uc := CreateTaskUsecase(mock_app.NewMockTaskRepository(ctrl), t.TempDir(), WithRetryPolicy(retry.Policy{
+		MaxAttempts: 2,
+		BaseBackoff: time.Millisecond,
+	}))
+
+	obj := &models.Object{URL: testServer.URL + "/doc.pdf"}
+	_, err := uc.downloadObject(context.Background(), obj, nil)
+
+	assert.ErrorContains(t, err, "503")
+	assert.Len(t, obj.Attempts, 2)
+}
+
+func TestTaskUsecase_downloadObject_RejectsContent(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantType    string
+	}{
+		{
+			name:        "HTMLBehindPdfURL",
+			contentType: "text/html; charset=utf-8",
+			body:        "<html><body>login</body></html>",
+		},
+		{
+			name:        "GenericTypeWithHTMLBody",
+			contentType: "application/octet-stream",
+			body:        "<html><body>login</body></html>",
+			wantType:    "text/html",
+		},
+		{
+			name:        "DeclaredJpegServesPdf",
+			contentType: "image/jpeg",
+			body:        "%PDF-1.4",
+			wantType:    "application/pdf",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.Write([]byte(tt.body))
+			}))
+			defer testServer.Close()
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			tempDir := t.TempDir()
+			uc := CreateTaskUsecase(mock_app.NewMockTaskRepository(ctrl), tempDir)
+			obj := &models.Object{URL: testServer.URL + "/file.pdf"}
+
+			_, err := uc.downloadObject(context.Background(), obj, nil)
+
+			assert.ErrorIs(t, err, errs.ErrInvalidFileType)
+			assert.Len(t, obj.Attempts, 1)
+			if tt.wantType != "" {
+				assert.Equal(t, tt.wantType, obj.ContentType)
+			}
+			leftovers, _ := filepath.Glob(filepath.Join(tempDir, ".download-*"))
+			assert.Empty(t, leftovers)
+		})
+	}
+}
+
+func TestTaskUsecase_downloadObject_QueryURL(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", `attachment; filename="report.pdf"`)
+		w.Write([]byte("%PDF-1.7 body"))
+	}))
+	defer testServer.Close()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	uc := CreateTaskUsecase(mock_app.NewMockTaskRepository(ctrl), t.TempDir())
+	obj := &models.Object{URL: testServer.URL + "/download?id=5"}
+
+	res, err := uc.downloadObject(context.Background(), obj, nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "application/pdf", obj.ContentType)
+	assert.Equal(t, "report.pdf", res.remoteName)
+	data, err := os.ReadFile(res.path)
+	assert.NoError(t, err)
+	assert.Equal(t, "%PDF-1.7 body", string(data))
+}
+
+func TestTaskUsecase_downloadObject_TypeSizeLimit(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// chunked, so the limit can only be noticed while streaming
+		w.Write([]byte("%PDF-1.4 "))
+		w.(http.Flusher).Flush()
+		w.Write([]byte(strings.Repeat("x", 100)))
+	}))
+	defer testServer.Close()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tempDir := t.TempDir()
+	policy := validate.Policy{Types: []validate.FileType{
+		{MIMEType: "application/pdf", Extensions: []string{".pdf"}, MaxSize: 50},
+	}}
+	uc := CreateTaskUsecase(mock_app.NewMockTaskRepository(ctrl), tempDir, WithFilePolicy(policy))
+	obj := &models.Object{URL: testServer.URL + "/big.pdf"}
+
+	_, err := uc.downloadObject(context.Background(), obj, nil)
+
+	assert.ErrorIs(t, err, errs.ErrFileTooLarge)
+	leftovers, _ := filepath.Glob(filepath.Join(tempDir, ".download-*"))
+	assert.Empty(t, leftovers)
+}
+
+func TestTaskUsecase_downloadAll_ArchiveSizeLimit(t *testing.T) {
+	body := "%PDF-1.4 " + strings.Repeat("x", 31)
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer testServer.Close()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mock_app.NewMockTaskRepository(ctrl)
+	mockRepo.EXPECT().UpdateObject(gomock.Any(), int64(1), gomock.Any()).Return(nil).AnyTimes()
+
+	uc := CreateTaskUsecase(mockRepo, t.TempDir(), WithSizeLimits(0, 100))
+	objects := []*models.Object{
+		{URL: testServer.URL + "/a.pdf"},
+		{URL: testServer.URL + "/b.pdf"},
+		{URL: testServer.URL + "/c.pdf"},
+	}
+
+	results := uc.downloadAll(context.Background(), 1, objects, newArchiveBudget(uc.maxArchiveSize))
+
+	failed := 0
+	for i, res := range results {
+		if res.err != nil {
+			failed++
+			assert.ErrorIs(t, res.err, errs.ErrArchiveTooLarge)
+			assert.Equal(t, models.ObjectFailed, objects[i].State)
+			assert.Contains(t, objects[i].Error, "archive size limit reached")
+			continue
+		}
+		os.Remove(res.path)
+	}
+	assert.Equal(t, 1, failed)
+}
+
+func TestTaskUsecase_downloadObject_ObjectSizeLimit(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("%PDF-1.4 " + strings.Repeat("x", 100)))
+	}))
+	defer testServer.Close()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	uc := CreateTaskUsecase(mock_app.NewMockTaskRepository(ctrl), t.TempDir(), WithSizeLimits(64, 0))
+	obj := &models.Object{URL: testServer.URL + "/big.pdf"}
+
+	_, err := uc.downloadObject(context.Background(), obj, nil)
+
+	assert.ErrorIs(t, err, errs.ErrFileTooLarge)
+	// a size limit is not a transient failure
+	assert.Len(t, obj.Attempts, 1)
+}
+
+func TestTaskUsecase_buildArchive_Encrypted(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("%PDF-1.4 confidential content"))
+	}))
+	defer testServer.Close()
+
+	mockRepo := mock_app.NewMockTaskRepository(ctrl)
+	mockRepo.EXPECT().UpdateTaskStatus(gomock.Any(), int64(1), models.StatusProcessing).Return(nil)
+	mockRepo.EXPECT().
+		GetTask(gomock.Any(), int64(1)).
+		Return(&models.Task{
+			ID:        1,
+			Status:    models.StatusProcessing,
+			Format:    "zip",
+			Encrypted: true,
+			Password:  "secret",
+			Objects:   []*models.Object{{URL: testServer.URL + "/doc.pdf"}},
+		}, nil).AnyTimes()
+	mockRepo.EXPECT().UpdateObject(gomock.Any(), int64(1), gomock.Any()).Return(nil).AnyTimes()
+	mockRepo.EXPECT().SetArchiveStats(gomock.Any(), int64(1), gomock.Any()).Return(nil)
+	mockRepo.EXPECT().UpdateTaskStatus(gomock.Any(), int64(1), models.StatusDone).Return(nil)
+
+	uc := CreateTaskUsecase(mockRepo, t.TempDir())
+	uc.ProcessTask(context.Background(), 1)
+
+	data, err := os.ReadFile(filepath.Join(uc.storagePath, archiveKey(1, "zip", 1)))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "confidential")
+
+	reader, err := zip.OpenReader(filepath.Join(uc.storagePath, archiveKey(1, "zip", 1)))
+	assert.NoError(t, err)
+	defer reader.Close()
+
+	assert.Len(t, reader.File, 2)
+	for _, f := range reader.File {
+		assert.NotZero(t, f.Flags&0x1, "entry %s is not encrypted", f.Name)
+	}
+}
@@ -0,0 +1,229 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/supchaser/test_task/internal/utils/errs"
+	"github.com/supchaser/test_task/internal/utils/logger"
+	"go.uber.org/zap"
+)
+
+// errJobRunning is returned when work is started for a task that already
+// has some running.
+var errJobRunning = errors.New("job already running")
+
+// defaultJobTimeout bounds a single archive job unless WithJobTimeout says
+// otherwise.
+const defaultJobTimeout = 30 * time.Minute
+
+// WithJobTimeout limits how long one archive job may run; 0 means no limit.
+func WithJobTimeout(timeout time.Duration) Option {
+	return func(u *TaskUsecase) {
+		u.jobs.timeout = timeout
+	}
+}
+
+// jobRunner runs archive jobs in the background. A job outlives the request
+// that started it: its context comes from the runner, which is only
+// cancelled by Shutdown, and keeps nothing from the request but the request
+// ID for the logs.
+type jobRunner struct {
+	ctx     context.Context
+	cancel  context.CancelCauseFunc
+	timeout time.Duration
+
+	mu       sync.Mutex
+	draining bool
+	wg       sync.WaitGroup
+	// running holds the work in progress per task, so it can be cancelled.
+	running map[int64]*runningJob
+}
+
+type runningJob struct {
+	cancel context.CancelCauseFunc
+	done   chan struct{}
+}
+
+func newJobRunner() *jobRunner {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	return &jobRunner{
+		ctx:     ctx,
+		cancel:  cancel,
+		timeout: defaultJobTimeout,
+		running: make(map[int64]*runningJob),
+	}
+}
+
+// track registers work on the task so that stop can cancel it. The
+// returned function must be called once the work is over. Only one piece of
+// work is tracked per task: errJobRunning is returned while another one runs.
+func (r *jobRunner) track(ctx context.Context, taskID int64) (context.Context, func(), error) {
+	r.mu.Lock()
+	if _, ok := r.running[taskID]; ok {
+		r.mu.Unlock()
+		return nil, nil, fmt.Errorf("%w: task %d", errJobRunning, taskID)
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	job := &runningJob{cancel: cancel, done: make(chan struct{})}
+	r.running[taskID] = job
+	r.mu.Unlock()
+
+	return ctx, func() {
+		r.mu.Lock()
+		if r.running[taskID] == job {
+			delete(r.running, taskID)
+		}
+		r.mu.Unlock()
+
+		cancel(nil)
+		close(job.done)
+	}, nil
+}
+
+// attach tracks work that runs in the caller's goroutine, such as a stream
+// answering a request, like a started job: Shutdown waits for it and cancels
+// it with errs.ErrShuttingDown once the drain deadline is reached. The
+// returned function must be called once the work is over.
+func (r *jobRunner) attach(ctx context.Context, taskID int64) (context.Context, func(), error) {
+	r.mu.Lock()
+	if r.draining {
+		r.mu.Unlock()
+		return nil, nil, errs.ErrShuttingDown
+	}
+	r.wg.Add(1)
+	r.mu.Unlock()
+
+	ctx, finish, err := r.track(ctx, taskID)
+	if err != nil {
+		r.wg.Done()
+		return nil, nil, err
+	}
+	stopOnShutdown := context.AfterFunc(r.ctx, func() {
+		r.stop(taskID, context.Cause(r.ctx))
+	})
+
+	return ctx, func() {
+		stopOnShutdown()
+		finish()
+		r.wg.Done()
+	}, nil
+}
+
+// stop cancels the work running for the task with cause and returns a
+// channel closed once it has returned, or nil when nothing runs.
+func (r *jobRunner) stop(taskID int64, cause error) <-chan struct{} {
+	r.mu.Lock()
+	job, ok := r.running[taskID]
+	r.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	job.cancel(cause)
+	return job.done
+}
+
+// start runs job for the task in its own goroutine. Once the runner is
+// draining no new job is started and errs.ErrShuttingDown is returned.
+func (r *jobRunner) start(reqCtx context.Context, name string, taskID int64, job func(ctx context.Context, taskID int64)) error {
+	r.mu.Lock()
+	if r.draining {
+		r.mu.Unlock()
+		return errs.ErrShuttingDown
+	}
+	r.wg.Add(1)
+	r.mu.Unlock()
+
+	ctx, finish, err := r.track(logger.WithRequestID(r.ctx, logger.RequestID(reqCtx)), taskID)
+	if err != nil {
+		r.wg.Done()
+		return err
+	}
+	cancel := context.CancelFunc(func() {})
+	if r.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+	}
+
+	go func() {
+		defer r.wg.Done()
+		defer finish()
+		defer cancel()
+
+		const funcName = "jobRunner.start"
+		started := time.Now()
+		logger.Debug("job started",
+			zap.String("function", funcName),
+			zap.String("job", name),
+			zap.Int64("task_id", taskID),
+			logger.RequestIDField(ctx),
+		)
+
+		job(ctx, taskID)
+
+		fields := []zap.Field{
+			zap.String("function", funcName),
+			zap.String("job", name),
+			zap.Int64("task_id", taskID),
+			logger.RequestIDField(ctx),
+			zap.Duration("duration", time.Since(started)),
+		}
+		if err := ctx.Err(); err != nil {
+			logger.Warn("job cancelled", append(fields, zap.Error(context.Cause(ctx)))...)
+			return
+		}
+		logger.Debug("job finished", fields...)
+	}()
+	return nil
+}
+
+func (r *jobRunner) isDraining() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.draining
+}
+
+// Draining reports whether Shutdown has been called.
+func (u *TaskUsecase) Draining() bool {
+	return u.jobs.isDraining()
+}
+
+// Shutdown stops accepting new archive jobs and waits for the running ones
+// until ctx is done. Jobs still running then are cancelled and leave their
+// tasks interrupted, to be resumed by ResumeTasks on the next start.
+func (u *TaskUsecase) Shutdown(ctx context.Context) error {
+	const funcName = "TaskUsecase.Shutdown"
+
+	u.jobs.mu.Lock()
+	u.jobs.draining = true
+	u.jobs.mu.Unlock()
+
+	logger.Info("draining archive jobs",
+		zap.String("function", funcName),
+	)
+
+	done := make(chan struct{})
+	go func() {
+		u.jobs.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		logger.Info("archive jobs drained",
+			zap.String("function", funcName),
+		)
+		return nil
+	case <-ctx.Done():
+	}
+
+	logger.Warn("drain deadline reached, interrupting archive jobs",
+		zap.String("function", funcName),
+	)
+	u.jobs.cancel(errs.ErrShuttingDown)
+	<-done
+	return fmt.Errorf("archive jobs interrupted: %w", ctx.Err())
+}
@@ -0,0 +1,208 @@
+package usecase
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	mock_app "github.com/supchaser/test_task/internal/app/mocks"
+	"github.com/supchaser/test_task/internal/app/models"
+	"github.com/supchaser/test_task/internal/utils/errs"
+	"github.com/supchaser/test_task/internal/utils/logger"
+)
+
+func TestJobRunner_DetachedFromRequest(t *testing.T) {
+	runner := newJobRunner()
+	defer runner.cancel(nil)
+
+	reqCtx, cancelReq := context.WithCancel(logger.WithRequestID(context.Background(), "req-1"))
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var jobErr error
+	var requestID string
+
+	runner.start(reqCtx, "test", 1, func(ctx context.Context, taskID int64) {
+		close(started)
+		<-release
+		jobErr = ctx.Err()
+		requestID = logger.RequestID(ctx)
+	})
+
+	<-started
+	// the handler returning must not cancel the job
+	cancelReq()
+	close(release)
+	runner.wg.Wait()
+
+	assert.NoError(t, jobErr)
+	assert.Equal(t, "req-1", requestID)
+}
+
+func TestJobRunner_Timeout(t *testing.T) {
+	runner := newJobRunner()
+	defer runner.cancel(nil)
+	runner.timeout = 10 * time.Millisecond
+
+	var jobErr error
+	runner.start(context.Background(), "test", 1, func(ctx context.Context, taskID int64) {
+		<-ctx.Done()
+		jobErr = ctx.Err()
+	})
+	runner.wg.Wait()
+
+	assert.ErrorIs(t, jobErr, context.DeadlineExceeded)
+}
+
+func TestJobRunner_OneJobPerTask(t *testing.T) {
+	runner := newJobRunner()
+	defer runner.cancel(nil)
+
+	started := make(chan struct{})
+	var cause error
+	require.NoError(t, runner.start(context.Background(), "test", 1, func(ctx context.Context, taskID int64) {
+		close(started)
+		<-ctx.Done()
+		cause = context.Cause(ctx)
+	}))
+	<-started
+
+	err := runner.start(context.Background(), "test", 1, func(context.Context, int64) {
+		t.Error("a second job for the task must not start")
+	})
+	assert.ErrorIs(t, err, errJobRunning)
+
+	// the first job is still the one tracked
+	done := runner.stop(1, errTaskCancelled)
+	require.NotNil(t, done)
+	<-done
+	assert.ErrorIs(t, cause, errTaskCancelled)
+	runner.wg.Wait()
+}
+
+func TestTaskUsecase_Shutdown_Drains(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	uc := CreateTaskUsecase(mock_app.NewMockTaskRepository(ctrl), t.TempDir())
+
+	release := make(chan struct{})
+	var jobErr error
+	require.NoError(t, uc.jobs.start(context.Background(), "test", 1, func(ctx context.Context, taskID int64) {
+		<-release
+		jobErr = ctx.Err()
+	}))
+
+	go func() {
+		// the job finishes while Shutdown is waiting
+		for !uc.Draining() {
+			time.Sleep(time.Millisecond)
+		}
+		close(release)
+	}()
+
+	require.NoError(t, uc.Shutdown(context.Background()))
+	assert.NoError(t, jobErr, "a drained job is not cancelled")
+
+	err := uc.jobs.start(context.Background(), "test", 2, func(context.Context, int64) {
+		t.Error("no job starts after Shutdown")
+	})
+	assert.ErrorIs(t, err, errs.ErrShuttingDown)
+}
+
+func TestTaskUsecase_Shutdown_Deadline(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	uc := CreateTaskUsecase(mock_app.NewMockTaskRepository(ctrl), t.TempDir(), WithJobTimeout(0))
+
+	started := make(chan struct{})
+	var cause error
+	require.NoError(t, uc.jobs.start(context.Background(), "test", 1, func(ctx context.Context, taskID int64) {
+		close(started)
+		<-ctx.Done()
+		cause = context.Cause(ctx)
+	}))
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := uc.Shutdown(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.ErrorIs(t, cause, errs.ErrShuttingDown, "Shutdown returns only after the job did")
+}
+
+func TestTaskUsecase_buildArchive_Cancelled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	obj := &models.Object{URL: "http://example.com/doc.pdf"}
+	mockRepo := mock_app.NewMockTaskRepository(ctrl)
+	mockRepo.EXPECT().
+		GetTask(gomock.Any(), int64(1)).
+		Return(&models.Task{ID: 1, Status: models.StatusProcessing, Objects: []*models.Object{obj}}, nil)
+	mockRepo.EXPECT().
+		UpdateTaskStatus(gomock.Any(), int64(1), models.StatusFailed).
+		DoAndReturn(func(ctx context.Context, _ int64, _ models.TaskStatus) error {
+			assert.NoError(t, ctx.Err(), "the status is saved despite the cancellation")
+			return nil
+		})
+	// no object is touched and nothing is stored
+	store := mock_app.NewMockArchiveStore(ctrl)
+
+	uc := CreateTaskUsecase(mockRepo, t.TempDir(), WithArchiveStore(store))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	uc.buildArchive(ctx, 1)
+
+	assert.Empty(t, obj.State)
+	assert.Empty(t, obj.Attempts)
+}
+
+func TestTaskUsecase_buildArchive_Interrupted(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mock_app.NewMockTaskRepository(ctrl)
+	mockRepo.EXPECT().
+		GetTask(gomock.Any(), int64(1)).
+		Return(&models.Task{
+			ID:      1,
+			Status:  models.StatusProcessing,
+			Objects: []*models.Object{{URL: "http://example.com/doc.pdf"}},
+		}, nil)
+	mockRepo.EXPECT().UpdateTaskStatus(gomock.Any(), int64(1), models.StatusInterrupted).Return(nil)
+
+	uc := CreateTaskUsecase(mockRepo, t.TempDir())
+	ctx, cancel := context.WithCancelCause(context.Background())
+	cancel(errs.ErrShuttingDown)
+	uc.buildArchive(ctx, 1)
+}
+
+func TestTaskUsecase_ResumeTasks_Interrupted(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mock_app.NewMockTaskRepository(ctrl)
+	mockRepo.EXPECT().
+		GetAllTasks(gomock.Any()).
+		Return([]*models.Task{
+			{ID: 1, Status: models.StatusInterrupted, Objects: []*models.Object{{ID: 1}}},
+			{ID: 2, Status: models.StatusWaiting, Objects: []*models.Object{{ID: 1}}},
+		}, nil)
+	processing := make(chan struct{})
+	mockRepo.EXPECT().
+		UpdateTaskStatus(gomock.Any(), int64(1), models.StatusProcessing).
+		DoAndReturn(func(context.Context, int64, models.TaskStatus) error {
+			close(processing)
+			// stop here, the archive itself is covered elsewhere
+			return errs.ErrInvalidTaskStatus
+		})
+
+	uc := CreateTaskUsecase(mockRepo, t.TempDir())
+	require.NoError(t, uc.ResumeTasks(context.Background()))
+	<-processing
+	require.NoError(t, uc.Shutdown(context.Background()))
+}
@@ -0,0 +1,130 @@
+package usecase
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/supchaser/test_task/internal/app/models"
+	"github.com/supchaser/test_task/internal/archive"
+)
+
+const (
+	manifestName = "manifest.json"
+	reportName   = "REPORT.txt"
+)
+
+// WithReport adds a human-readable REPORT.txt next to manifest.json.
+func WithReport(enabled bool) Option {
+	return func(u *TaskUsecase) {
+		u.report = enabled
+	}
+}
+
+// buildManifest describes every requested object in request order,
+// including the ones that did not make it into the archive.
+func buildManifest(task *models.Task) *models.Manifest {
+	manifest := &models.Manifest{
+		TaskID:    task.ID,
+		CreatedAt: time.Now(),
+		Objects:   make([]models.ManifestEntry, 0, len(task.Objects)),
+	}
+
+	for _, obj := range task.Objects {
+		entry := models.ManifestEntry{
+			URL:         obj.URL,
+			State:       obj.State,
+			ContentType: obj.ContentType,
+			DurationMs:  obj.DurationMs,
+			Attempts:    len(obj.Attempts),
+			Error:       obj.Error,
+		}
+
+		if obj.State == models.ObjectArchived {
+			entry.Name = obj.ArchiveName
+			entry.Size = obj.Size
+			entry.SHA256 = obj.SHA256
+			manifest.Archived++
+		} else {
+			manifest.Failed++
+		}
+
+		manifest.Objects = append(manifest.Objects, entry)
+	}
+
+	return manifest
+}
+
+func writeManifest(w archive.Writer, manifest *models.Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal manifest: %w", err)
+	}
+
+	if err := w.AddFile(archive.Entry{
+		Name:        manifestName,
+		Size:        int64(len(data)),
+		ModTime:     manifest.CreatedAt,
+		ContentType: "application/json",
+	}, bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("write manifest: %w", err)
+	}
+
+	return nil
+}
+
+func writeReport(w archive.Writer, manifest *models.Manifest) error {
+	data := []byte(formatReport(manifest))
+
+	if err := w.AddFile(archive.Entry{
+		Name:        reportName,
+		Size:        int64(len(data)),
+		ModTime:     manifest.CreatedAt,
+		ContentType: "text/plain",
+	}, bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("write report: %w", err)
+	}
+
+	return nil
+}
+
+func formatReport(manifest *models.Manifest) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Task %d, archived at %s\n", manifest.TaskID, manifest.CreatedAt.Format(time.RFC3339))
+	fmt.Fprintf(&b, "Files: %d archived, %d failed of %d requested\n\n",
+		manifest.Archived, manifest.Failed, len(manifest.Objects))
+
+	tw := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tSTATE\tNAME\tSIZE\tTIME\tURL")
+	for i, entry := range manifest.Objects {
+		name, size := entry.Name, fmt.Sprint(entry.Size)
+		if entry.State != models.ObjectArchived {
+			name, size = "-", "-"
+		}
+		duration := time.Duration(entry.DurationMs) * time.Millisecond
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n", i+1, entry.State, name, size, duration, entry.URL)
+	}
+	tw.Flush()
+
+	if manifest.Failed > 0 {
+		b.WriteString("\nFailures:\n")
+		for _, entry := range manifest.Objects {
+			if entry.State != models.ObjectArchived {
+				fmt.Fprintf(&b, "  %s\n    %s\n", entry.URL, entry.Error)
+			}
+		}
+	}
+
+	b.WriteString("\nChecksums (SHA-256):\n")
+	for _, entry := range manifest.Objects {
+		if entry.State == models.ObjectArchived {
+			fmt.Fprintf(&b, "  %s  %s\n", entry.SHA256, entry.Name)
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,39 @@
+package usecase
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/supchaser/test_task/internal/app/models"
+)
+
+func TestFormatReport(t *testing.T) {
+	task := &models.Task{
+		ID: 3,
+		Objects: []*models.Object{
+			{
+				URL:         "https://example.com/a.pdf",
+				ArchiveName: "a.pdf",
+				State:       models.ObjectArchived,
+				Size:        1234,
+				SHA256:      "abc123",
+				DurationMs:  250,
+			},
+			{
+				URL:   "https://example.com/b.pdf",
+				State: models.ObjectFailed,
+				Error: "invalid response status: 404",
+			},
+		},
+	}
+
+	report := formatReport(buildManifest(task))
+
+	assert.Contains(t, report, "Task 3")
+	assert.Contains(t, report, "1 archived, 1 failed of 2 requested")
+	assert.Contains(t, report, "a.pdf")
+	assert.Contains(t, report, "250ms")
+	assert.Contains(t, report, "https://example.com/b.pdf\n    invalid response status: 404")
+	assert.Contains(t, report, "abc123  a.pdf")
+	assert.NotContains(t, report, "abc123  -")
+}
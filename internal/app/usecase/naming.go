@@ -0,0 +1,144 @@
+package usecase
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/supchaser/test_task/internal/app/models"
+	"github.com/supchaser/test_task/internal/utils/validate"
+)
+
+// maxEntryNameLen keeps entry names well below the 255-byte limit of most
+// file systems, leaving room for collision suffixes.
+const maxEntryNameLen = 200
+
+// entryNamer hands out unique, safe file names for archive entries.
+type entryNamer struct {
+	policy validate.Policy
+	used   map[string]bool
+}
+
+func newEntryNamer(policy validate.Policy) *entryNamer {
+	n := &entryNamer{
+		policy: policy,
+		used:   make(map[string]bool),
+	}
+	// the archive metadata files are written last, keep their names free
+	n.used[strings.ToLower(manifestName)] = true
+	n.used[strings.ToLower(reportName)] = true
+	return n
+}
+
+// name picks the entry name for the object: the name requested by the
+// client, then the Content-Disposition file name, then the last segment of
+// the decoded URL path, then a generated one. Names taken earlier get a
+// numeric suffix.
+func (n *entryNamer) name(obj *models.Object, remoteName string) string {
+	name := ""
+	for _, candidate := range []string{obj.Name, remoteName, urlFileName(obj.URL)} {
+		if name = sanitizeFileName(candidate); name != "" {
+			break
+		}
+	}
+	if name == "" {
+		name = fmt.Sprintf("file_%d", obj.ID)
+	}
+
+	if path.Ext(name) == "" {
+		name += n.extension(obj.ContentType)
+	}
+
+	return n.unique(name)
+}
+
+// extension returns the first extension the policy lists for the type.
+func (n *entryNamer) extension(contentType string) string {
+	fileType, ok := n.policy.Lookup(contentType)
+	if !ok || len(fileType.Extensions) == 0 {
+		return ""
+	}
+	return fileType.Extensions[0]
+}
+
+// unique appends _1, _2, ... to the base name until it is free. Names are
+// compared case-insensitively, since archives are often unpacked on file
+// systems that ignore case.
+func (n *entryNamer) unique(name string) string {
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+
+	candidate := name
+	for i := 1; n.used[strings.ToLower(candidate)]; i++ {
+		candidate = fmt.Sprintf("%s_%d%s", base, i, ext)
+	}
+
+	n.used[strings.ToLower(candidate)] = true
+	return candidate
+}
+
+// reserve marks a name that is already taken in the archive.
+func (n *entryNamer) reserve(name string) {
+	n.used[strings.ToLower(name)] = true
+}
+
+// urlFileName returns the decoded last segment of the URL path, without the
+// query string.
+func urlFileName(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return path.Base(u.Path)
+}
+
+// sanitizeFileName reduces a name to a single safe path segment. It returns
+// an empty string if nothing usable is left.
+func sanitizeFileName(name string) string {
+	// only the last segment counts, whatever separator was used
+	name = strings.ReplaceAll(name, "\\", "/")
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case r == utf8.RuneError, unicode.IsControl(r):
+			continue
+		case strings.ContainsRune(`<>:"|?*`, r):
+			b.WriteRune('_')
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	name = strings.Trim(b.String(), " .")
+	if name == "" {
+		return ""
+	}
+
+	if len(name) > maxEntryNameLen {
+		ext := path.Ext(name)
+		if len(ext) > 16 {
+			ext = ""
+		}
+		name = truncateUTF8(strings.TrimSuffix(name, ext), maxEntryNameLen-len(ext)) + ext
+	}
+
+	return name
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a rune.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
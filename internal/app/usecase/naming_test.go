@@ -0,0 +1,78 @@
+package usecase
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/supchaser/test_task/internal/app/models"
+	"github.com/supchaser/test_task/internal/utils/validate"
+)
+
+func TestSanitizeFileName(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "plain", input: "report.pdf", expected: "report.pdf"},
+		{name: "traversal", input: "../../etc/passwd", expected: "passwd"},
+		{name: "windowsPath", input: `C:\Users\me\scan.jpg`, expected: "scan.jpg"},
+		{name: "dotDot", input: "..", expected: ""},
+		{name: "onlyDots", input: "...", expected: ""},
+		{name: "reserved", input: `a<b>c:d"e|f?g*.pdf`, expected: "a_b_c_d_e_f_g_.pdf"},
+		{name: "control", input: "na\x00me\n.pdf", expected: "name.pdf"},
+		{name: "unicode", input: "отчёт 2024.pdf", expected: "отчёт 2024.pdf"},
+		{name: "hidden", input: ".env", expected: "env"},
+		{name: "empty", input: "", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, sanitizeFileName(tt.input))
+		})
+	}
+}
+
+func TestSanitizeFileName_Long(t *testing.T) {
+	name := sanitizeFileName(strings.Repeat("я", 300) + ".pdf")
+
+	assert.LessOrEqual(t, len(name), maxEntryNameLen)
+	assert.True(t, strings.HasSuffix(name, ".pdf"))
+	assert.True(t, strings.HasPrefix(name, "яя"))
+}
+
+func TestEntryNamer(t *testing.T) {
+	namer := newEntryNamer(validate.DefaultPolicy())
+
+	names := []string{
+		namer.name(&models.Object{URL: "https://a.com/docs/test.pdf"}, ""),
+		namer.name(&models.Object{URL: "https://b.com/test.pdf?version=2"}, ""),
+		namer.name(&models.Object{URL: "https://c.com/TEST.pdf"}, ""),
+		namer.name(&models.Object{URL: "https://d.com/download?id=5"}, "invoice.pdf"),
+		namer.name(&models.Object{URL: "https://e.com/my%20photo.jpg"}, ""),
+		namer.name(&models.Object{ID: 42, URL: "https://f.com/", ContentType: "image/jpeg"}, ""),
+		namer.name(&models.Object{URL: "https://g.com/get", ContentType: "application/pdf"}, ""),
+		namer.name(&models.Object{URL: "https://h.com/a.pdf", Name: "custom.pdf"}, "remote.pdf"),
+		namer.name(&models.Object{URL: "https://i.com/..", Name: "../"}, ""),
+	}
+
+	assert.Equal(t, []string{
+		"test.pdf",
+		"test_1.pdf",
+		"TEST_2.pdf",
+		"invoice.pdf",
+		"my photo.jpg",
+		"file_42.jpeg",
+		"get.pdf",
+		"custom.pdf",
+		"file_0",
+	}, names)
+}
+
+func TestEntryNamer_ReservesMetadataNames(t *testing.T) {
+	namer := newEntryNamer(validate.DefaultPolicy())
+
+	assert.Equal(t, "manifest_1.json", namer.name(&models.Object{Name: "manifest.json"}, ""))
+	assert.Equal(t, "report_1.txt", namer.name(&models.Object{Name: "report.txt"}, ""))
+}
@@ -0,0 +1,94 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/supchaser/test_task/internal/app/models"
+	"github.com/supchaser/test_task/internal/utils/errs"
+	"github.com/supchaser/test_task/internal/utils/logger"
+	"go.uber.org/zap"
+)
+
+// DeleteTask removes a finished task together with its archive. A task that
+// is still active has to be cancelled first.
+func (u *TaskUsecase) DeleteTask(ctx context.Context, taskID int64) error {
+	const funcName = "TaskUsecase.DeleteTask"
+	logger.Debug("deleting task",
+		zap.String("function", funcName),
+		zap.Int64("task_id", taskID),
+	)
+
+	task, err := u.taskRepository.GetTask(ctx, taskID)
+	if err != nil {
+		logger.Error("failed to get task",
+			zap.String("function", funcName),
+			zap.Int64("task_id", taskID),
+			zap.Error(err),
+		)
+		return err
+	}
+	if !task.Status.IsFinished() {
+		return fmt.Errorf("%w: task is %s", errs.ErrInvalidTaskStatus, task.Status)
+	}
+
+	// the archives go first, so a failure leaves a task that can be deleted again
+	if err := u.deleteArchives(ctx, task); err != nil {
+		return err
+	}
+
+	if err := u.taskRepository.DeleteTask(ctx, taskID); err != nil {
+		logger.Error("failed to delete task",
+			zap.String("function", funcName),
+			zap.Int64("task_id", taskID),
+			zap.Error(err),
+		)
+		return err
+	}
+
+	logger.Info("task deleted",
+		zap.String("function", funcName),
+		zap.Int64("task_id", taskID),
+	)
+	return nil
+}
+
+// PurgeTasks deletes the finished tasks matching the filter with their
+// archives and returns the IDs of the deleted tasks.
+func (u *TaskUsecase) PurgeTasks(ctx context.Context, filter models.PurgeFilter) ([]int64, error) {
+	const funcName = "TaskUsecase.PurgeTasks"
+	logger.Debug("purging tasks",
+		zap.String("function", funcName),
+		zap.Any("statuses", filter.Statuses),
+		zap.Time("finished_before", filter.FinishedBefore),
+	)
+
+	for _, status := range filter.Statuses {
+		if !status.IsFinished() {
+			return nil, fmt.Errorf("%w: %q is not a finished status", errs.ErrInvalidFilter, status)
+		}
+	}
+
+	purged, err := u.taskRepository.PurgeTasks(ctx, filter)
+	ids := make([]int64, 0, len(purged))
+	for _, task := range purged {
+		ids = append(ids, task.ID)
+
+		// the record is gone already, a failure here only leaves a stray file
+		u.deleteArchives(ctx, task)
+	}
+	if err != nil {
+		logger.Error("failed to purge tasks",
+			zap.String("function", funcName),
+			zap.Int("purged", len(ids)),
+			zap.Error(err),
+		)
+		return ids, err
+	}
+
+	logger.Info("tasks purged",
+		zap.String("function", funcName),
+		zap.Int("count", len(ids)),
+	)
+	return ids, nil
+}
@@ -0,0 +1,86 @@
+package usecase
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	mock_app "github.com/supchaser/test_task/internal/app/mocks"
+	"github.com/supchaser/test_task/internal/app/models"
+	"github.com/supchaser/test_task/internal/storage"
+	"github.com/supchaser/test_task/internal/utils/errs"
+)
+
+func TestTaskUsecase_DeleteTask(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := storage.NewMemory()
+	require.NoError(t, store.Put(context.Background(), "task_1.tar", strings.NewReader("tar"), 3))
+
+	mockRepo := mock_app.NewMockTaskRepository(ctrl)
+	mockRepo.EXPECT().GetTask(gomock.Any(), int64(1)).Return(&models.Task{ID: 1, Status: models.StatusDone, Format: "tar"}, nil)
+	mockRepo.EXPECT().DeleteTask(gomock.Any(), int64(1)).Return(nil)
+
+	uc := CreateTaskUsecase(mockRepo, t.TempDir(), WithArchiveStore(store))
+	require.NoError(t, uc.DeleteTask(context.Background(), 1))
+
+	_, err := store.Stat(context.Background(), "task_1.tar")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func TestTaskUsecase_DeleteTask_Active(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mock_app.NewMockTaskRepository(ctrl)
+	mockRepo.EXPECT().GetTask(gomock.Any(), int64(1)).Return(&models.Task{ID: 1, Status: models.StatusProcessing}, nil)
+	// neither the archive nor the record is touched
+	store := mock_app.NewMockArchiveStore(ctrl)
+
+	uc := CreateTaskUsecase(mockRepo, t.TempDir(), WithArchiveStore(store))
+	err := uc.DeleteTask(context.Background(), 1)
+	assert.ErrorIs(t, err, errs.ErrInvalidTaskStatus)
+}
+
+func TestTaskUsecase_PurgeTasks(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := storage.NewMemory()
+	require.NoError(t, store.Put(context.Background(), "task_1.zip", strings.NewReader("zip"), 3))
+	require.NoError(t, store.Put(context.Background(), "task_3.zip", strings.NewReader("zip"), 3))
+
+	filter := models.PurgeFilter{Statuses: []models.TaskStatus{models.StatusDone, models.StatusExpired}}
+	mockRepo := mock_app.NewMockTaskRepository(ctrl)
+	mockRepo.EXPECT().
+		PurgeTasks(gomock.Any(), filter).
+		Return([]*models.Task{
+			{ID: 1, Status: models.StatusDone},
+			{ID: 2, Status: models.StatusExpired},
+		}, nil)
+
+	uc := CreateTaskUsecase(mockRepo, t.TempDir(), WithArchiveStore(store))
+	ids, err := uc.PurgeTasks(context.Background(), filter)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []int64{1, 2}, ids)
+
+	_, err = store.Stat(context.Background(), "task_1.zip")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	_, err = store.Stat(context.Background(), "task_3.zip")
+	assert.NoError(t, err, "archives of other tasks stay")
+}
+
+func TestTaskUsecase_PurgeTasks_InvalidStatus(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	uc := CreateTaskUsecase(mock_app.NewMockTaskRepository(ctrl), t.TempDir())
+	_, err := uc.PurgeTasks(context.Background(), models.PurgeFilter{
+		Statuses: []models.TaskStatus{models.StatusDone, models.StatusWaiting},
+	})
+	assert.ErrorIs(t, err, errs.ErrInvalidFilter)
+}
@@ -0,0 +1,123 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	"github.com/supchaser/test_task/internal/utils/logger"
+	"go.uber.org/zap"
+)
+
+// WithIdleTTL makes the reaper expire waiting tasks that got no new objects
+// for longer than ttl. Zero disables expiration.
+func WithIdleTTL(ttl time.Duration) Option {
+	return func(u *TaskUsecase) {
+		u.idleTTL = ttl
+	}
+}
+
+// WithRetention makes the reaper delete finished tasks and their archives
+// once they are older than retention. Zero keeps them forever.
+func WithRetention(retention time.Duration) Option {
+	return func(u *TaskUsecase) {
+		u.retention = retention
+	}
+}
+
+// RunReaper calls Reap every interval until ctx is cancelled.
+func (u *TaskUsecase) RunReaper(ctx context.Context, interval time.Duration) {
+	const funcName = "TaskUsecase.RunReaper"
+	logger.Info("reaper started",
+		zap.String("function", funcName),
+		zap.Duration("interval", interval),
+		zap.Duration("idle_ttl", u.idleTTL),
+		zap.Duration("retention", u.retention),
+	)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info("reaper stopped",
+				zap.String("function", funcName),
+			)
+			return
+		case <-ticker.C:
+			u.Reap(ctx)
+		}
+	}
+}
+
+// Reap expires idle waiting tasks and removes finished tasks past retention.
+func (u *TaskUsecase) Reap(ctx context.Context) {
+	if u.idleTTL > 0 {
+		u.expireIdleTasks(ctx)
+	}
+
+	if u.retention > 0 {
+		u.removeExpiredTasks(ctx)
+	}
+}
+
+func (u *TaskUsecase) expireIdleTasks(ctx context.Context) {
+	const funcName = "TaskUsecase.expireIdleTasks"
+
+	expired, err := u.taskRepository.ExpireIdleTasks(ctx, u.idleTTL)
+	if err != nil {
+		logger.Error("failed to expire idle tasks",
+			zap.String("function", funcName),
+			zap.Error(err),
+		)
+	}
+
+	if len(expired) > 0 {
+		logger.Info("idle tasks expired",
+			zap.String("function", funcName),
+			zap.Int("count", len(expired)),
+		)
+	}
+}
+
+func (u *TaskUsecase) removeExpiredTasks(ctx context.Context) {
+	const funcName = "TaskUsecase.removeExpiredTasks"
+
+	tasks, err := u.taskRepository.GetAllTasks(ctx)
+	if err != nil {
+		logger.Error("failed to get tasks",
+			zap.String("function", funcName),
+			zap.Error(err),
+		)
+		return
+	}
+
+	deadline := time.Now().Add(-u.retention)
+	removed := 0
+	for _, task := range tasks {
+		if !task.Status.IsFinished() || task.FinishedAt == nil || task.FinishedAt.After(deadline) {
+			continue
+		}
+
+		if err := u.deleteArchives(ctx, task); err != nil {
+			continue
+		}
+
+		if err := u.taskRepository.DeleteTask(ctx, task.ID); err != nil {
+			logger.Error("failed to delete task",
+				zap.String("function", funcName),
+				zap.Int64("task_id", task.ID),
+				zap.Error(err),
+			)
+			continue
+		}
+		removed++
+	}
+
+	if removed > 0 {
+		logger.Info("finished tasks removed by retention policy",
+			zap.String("function", funcName),
+			zap.Int("count", removed),
+		)
+	}
+}
@@ -0,0 +1,95 @@
+package usecase
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	mock_app "github.com/supchaser/test_task/internal/app/mocks"
+	"github.com/supchaser/test_task/internal/app/models"
+)
+
+func TestTaskUsecase_Reap(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tempDir := t.TempDir()
+	old := time.Now().Add(-48 * time.Hour)
+	recent := time.Now().Add(-time.Hour)
+
+	mockRepo := mock_app.NewMockTaskRepository(ctrl)
+	mockRepo.EXPECT().
+		ExpireIdleTasks(gomock.Any(), 30*time.Minute).
+		Return([]int64{4}, nil)
+	mockRepo.EXPECT().
+		GetAllTasks(gomock.Any()).
+		Return([]*models.Task{
+			{ID: 1, Status: models.StatusDone, FinishedAt: &old},
+			{ID: 2, Status: models.StatusDone, FinishedAt: &recent},
+			{ID: 3, Status: models.StatusWaiting},
+			{ID: 4, Status: models.StatusExpired, FinishedAt: &old},
+		}, nil)
+	mockRepo.EXPECT().DeleteTask(gomock.Any(), int64(1)).Return(nil)
+	mockRepo.EXPECT().DeleteTask(gomock.Any(), int64(4)).Return(nil)
+
+	uc := CreateTaskUsecase(mockRepo, tempDir,
+		WithIdleTTL(30*time.Minute),
+		WithRetention(24*time.Hour),
+	)
+
+	oldArchive := filepath.Join(uc.storagePath, archiveKey(1, "", 1))
+	recentArchive := filepath.Join(uc.storagePath, archiveKey(2, "", 1))
+	assert.NoError(t, os.WriteFile(oldArchive, []byte("zip"), 0644))
+	assert.NoError(t, os.WriteFile(recentArchive, []byte("zip"), 0644))
+
+	uc.Reap(context.Background())
+
+	_, err := os.Stat(oldArchive)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(recentArchive)
+	assert.NoError(t, err)
+}
+
+func TestTaskUsecase_Reap_Disabled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// no expectations: with both policies off the repository must not be touched
+	mockRepo := mock_app.NewMockTaskRepository(ctrl)
+
+	uc := CreateTaskUsecase(mockRepo, t.TempDir())
+	uc.Reap(context.Background())
+}
+
+func TestTaskUsecase_RunReaper_StopsOnCancel(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mock_app.NewMockTaskRepository(ctrl)
+	mockRepo.EXPECT().
+		ExpireIdleTasks(gomock.Any(), time.Minute).
+		Return(nil, nil).
+		AnyTimes()
+
+	uc := CreateTaskUsecase(mockRepo, t.TempDir(), WithIdleTTL(time.Minute))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		uc.RunReaper(ctx, 10*time.Millisecond)
+		close(stopped)
+	}()
+
+	time.Sleep(30 * time.Millisecond)
+	cancel()
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("reaper did not stop")
+	}
+}
@@ -0,0 +1,130 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/supchaser/test_task/internal/app/models"
+	"github.com/supchaser/test_task/internal/archive"
+	"github.com/supchaser/test_task/internal/utils/errs"
+	"github.com/supchaser/test_task/internal/utils/logger"
+	"go.uber.org/zap"
+)
+
+// RetryTask builds a new archive version of a done or failed task. Only the
+// objects missing from the previous version are downloaded again, or every
+// object when all is set. Earlier versions stay in the store until the task
+// is removed.
+func (u *TaskUsecase) RetryTask(ctx context.Context, taskID int64, all bool) (*models.Task, error) {
+	const funcName = "TaskUsecase.RetryTask"
+	logger.Debug("retrying task",
+		zap.String("function", funcName),
+		zap.Int64("task_id", taskID),
+		zap.Bool("all", all),
+	)
+
+	if u.Draining() {
+		return nil, errs.ErrShuttingDown
+	}
+
+	task, err := u.taskRepository.RetryTask(ctx, taskID, all)
+	if err != nil {
+		logger.Error("failed to retry task",
+			zap.String("function", funcName),
+			zap.Int64("task_id", taskID),
+			zap.Error(err),
+		)
+		return nil, err
+	}
+
+	if err := u.jobs.start(ctx, "retry", taskID, u.buildArchive); err != nil {
+		// shutdown began after the check above; the task is resumed on the next start
+		u.taskRepository.UpdateTaskStatus(ctx, taskID, models.StatusInterrupted)
+		return nil, err
+	}
+
+	logger.Info("task retry started",
+		zap.String("function", funcName),
+		zap.Int64("task_id", taskID),
+		zap.Int("archive_version", task.ArchiveVersion),
+	)
+	return task, nil
+}
+
+// copyPrevious copies the entries of the objects a retried task already has
+// archived from the previous version into w and returns those objects. A
+// first build keeps nothing, and so does a retry whose previous archive
+// cannot be fetched: its objects are downloaded again instead.
+func (u *TaskUsecase) copyPrevious(ctx context.Context, task *models.Task, w archive.Writer) (map[*models.Object]bool, error) {
+	const funcName = "TaskUsecase.copyPrevious"
+
+	version := archiveVersion(task)
+	byName := make(map[string]*models.Object)
+	for _, obj := range task.Objects {
+		if obj.State == models.ObjectArchived && obj.ArchiveName != "" {
+			byName[obj.ArchiveName] = obj
+		}
+	}
+	if version <= 1 || len(byName) == 0 {
+		return nil, nil
+	}
+
+	key := archiveKey(task.ID, task.Format, version-1)
+	prev, err := u.fetchArchive(ctx, key)
+	if err != nil {
+		logger.Warn("previous archive unavailable, downloading every object again",
+			zap.String("function", funcName),
+			zap.Int64("task_id", task.ID),
+			zap.String("archive_key", key),
+			zap.Error(err),
+		)
+		return nil, nil
+	}
+	defer func() {
+		prev.Close()
+		os.Remove(prev.Name())
+	}()
+
+	info, err := prev.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("stat previous archive: %w", err)
+	}
+
+	kept := make(map[*models.Object]bool, len(byName))
+	err = w.Copy(prev, info.Size(), func(name string) bool {
+		obj, ok := byName[name]
+		if ok {
+			// a name is taken once, whatever else the archive holds
+			kept[obj] = true
+			delete(byName, name)
+		}
+		return ok
+	})
+	if err != nil {
+		return nil, fmt.Errorf("copy previous archive %s: %w", key, err)
+	}
+	return kept, nil
+}
+
+// fetchArchive copies a stored archive into a scratch file, since reading
+// entries needs random access the store does not promise.
+func (u *TaskUsecase) fetchArchive(ctx context.Context, key string) (*os.File, error) {
+	body, err := u.store.Open(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	file, err := os.CreateTemp(u.storagePath, ".archive-*")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(file, body); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, fmt.Errorf("fetch %s: %w", key, err)
+	}
+	return file, nil
+}
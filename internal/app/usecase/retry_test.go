@@ -0,0 +1,232 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	mock_app "github.com/supchaser/test_task/internal/app/mocks"
+	"github.com/supchaser/test_task/internal/app/models"
+	"github.com/supchaser/test_task/internal/archive"
+	"github.com/supchaser/test_task/internal/storage"
+	"github.com/supchaser/test_task/internal/utils/errs"
+)
+
+// putZip stores a zip with the given entries under key.
+func putZip(t *testing.T, store *storage.Memory, key string, files map[string]string) {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := archive.NewWriter(archive.FormatZip, &buf)
+	require.NoError(t, err)
+	for name, content := range files {
+		require.NoError(t, w.AddFile(archive.Entry{Name: name, Size: int64(len(content)), ModTime: time.Now()}, bytes.NewReader([]byte(content))))
+	}
+	require.NoError(t, w.Close())
+	require.NoError(t, store.Put(context.Background(), key, &buf, int64(buf.Len())))
+}
+
+// readStored unpacks a stored zip.
+func readStored(t *testing.T, store *storage.Memory, key string) (map[string]string, models.Manifest) {
+	t.Helper()
+	info, err := store.Stat(context.Background(), key)
+	require.NoError(t, err)
+	body, err := store.Open(context.Background(), key)
+	require.NoError(t, err)
+	defer body.Close()
+
+	var buf bytes.Buffer
+	_, err = buf.ReadFrom(body)
+	require.NoError(t, err)
+	require.Equal(t, info.Size, int64(buf.Len()))
+	return readStream(t, buf.Bytes())
+}
+
+func newRetryServer(t *testing.T, requests *atomic.Int32) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Write([]byte("%PDF-fresh " + r.URL.Path))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestTaskUsecase_buildArchive_RetryKeepsArchived(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var requests atomic.Int32
+	server := newRetryServer(t, &requests)
+
+	store := storage.NewMemory()
+	putZip(t, store, "task_1.zip", map[string]string{
+		"a.pdf":      "%PDF-first version",
+		manifestName: "{}",
+	})
+
+	mockRepo := mock_app.NewMockTaskRepository(ctrl)
+	mockRepo.EXPECT().
+		GetTask(gomock.Any(), int64(1)).
+		Return(&models.Task{
+			ID:             1,
+			Status:         models.StatusProcessing,
+			ArchiveVersion: 2,
+			Objects: []*models.Object{
+				{ID: 1, URL: server.URL + "/a.pdf", State: models.ObjectArchived, ArchiveName: "a.pdf", Size: 18},
+				{ID: 2, URL: server.URL + "/b.pdf", State: models.ObjectPending},
+			},
+		}, nil).AnyTimes()
+	mockRepo.EXPECT().UpdateObject(gomock.Any(), int64(1), gomock.Any()).Return(nil).AnyTimes()
+	mockRepo.EXPECT().SetArchiveStats(gomock.Any(), int64(1), gomock.Any()).Return(nil)
+	mockRepo.EXPECT().UpdateTaskStatus(gomock.Any(), int64(1), models.StatusDone).Return(nil)
+
+	uc := CreateTaskUsecase(mockRepo, t.TempDir(), WithArchiveStore(store))
+	uc.buildArchive(context.Background(), 1)
+
+	assert.Equal(t, int32(1), requests.Load(), "the archived object is not downloaded again")
+	files, manifest := readStored(t, store, "task_1.v2.zip")
+	assert.Equal(t, "%PDF-first version", files["a.pdf"])
+	assert.Equal(t, "%PDF-fresh /b.pdf", files["b.pdf"])
+	assert.Equal(t, 2, manifest.Archived)
+	assert.Zero(t, manifest.Failed)
+
+	_, err := store.Stat(context.Background(), "task_1.zip")
+	assert.NoError(t, err, "the previous version is kept")
+}
+
+func TestTaskUsecase_buildArchive_RetryWithoutPrevious(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var requests atomic.Int32
+	server := newRetryServer(t, &requests)
+
+	mockRepo := mock_app.NewMockTaskRepository(ctrl)
+	mockRepo.EXPECT().
+		GetTask(gomock.Any(), int64(1)).
+		Return(&models.Task{
+			ID:             1,
+			Status:         models.StatusProcessing,
+			ArchiveVersion: 2,
+			Objects: []*models.Object{
+				{ID: 1, URL: server.URL + "/a.pdf", State: models.ObjectArchived, ArchiveName: "a.pdf"},
+				{ID: 2, URL: server.URL + "/b.pdf", State: models.ObjectPending},
+			},
+		}, nil).AnyTimes()
+	mockRepo.EXPECT().UpdateObject(gomock.Any(), int64(1), gomock.Any()).Return(nil).AnyTimes()
+	mockRepo.EXPECT().SetArchiveStats(gomock.Any(), int64(1), gomock.Any()).Return(nil)
+	mockRepo.EXPECT().UpdateTaskStatus(gomock.Any(), int64(1), models.StatusDone).Return(nil)
+
+	// a streamed first version was never stored, so everything is fetched
+	store := storage.NewMemory()
+	uc := CreateTaskUsecase(mockRepo, t.TempDir(), WithArchiveStore(store))
+	uc.buildArchive(context.Background(), 1)
+
+	assert.Equal(t, int32(2), requests.Load())
+	files, _ := readStored(t, store, "task_1.v2.zip")
+	assert.Equal(t, "%PDF-fresh /a.pdf", files["a.pdf"])
+	assert.Equal(t, "%PDF-fresh /b.pdf", files["b.pdf"])
+}
+
+func TestTaskUsecase_RetryTask(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var requests atomic.Int32
+	server := newRetryServer(t, &requests)
+
+	task := &models.Task{
+		ID:             1,
+		Status:         models.StatusProcessing,
+		ArchiveVersion: 2,
+		Objects:        []*models.Object{{ID: 1, URL: server.URL + "/a.pdf", State: models.ObjectPending}},
+	}
+	mockRepo := mock_app.NewMockTaskRepository(ctrl)
+	mockRepo.EXPECT().RetryTask(gomock.Any(), int64(1), true).Return(task.Clone(), nil)
+	mockRepo.EXPECT().GetTask(gomock.Any(), int64(1)).Return(task, nil).AnyTimes()
+	mockRepo.EXPECT().UpdateObject(gomock.Any(), int64(1), gomock.Any()).Return(nil).AnyTimes()
+	mockRepo.EXPECT().SetArchiveStats(gomock.Any(), int64(1), gomock.Any()).Return(nil)
+	mockRepo.EXPECT().UpdateTaskStatus(gomock.Any(), int64(1), models.StatusDone).Return(nil)
+
+	store := storage.NewMemory()
+	uc := CreateTaskUsecase(mockRepo, t.TempDir(), WithArchiveStore(store))
+	retried, err := uc.RetryTask(context.Background(), 1, true)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusProcessing, retried.Status)
+	assert.Equal(t, 2, retried.ArchiveVersion)
+
+	require.NoError(t, uc.Shutdown(context.Background()))
+	_, err = store.Stat(context.Background(), "task_1.v2.zip")
+	assert.NoError(t, err)
+}
+
+func TestTaskUsecase_RetryTask_Rejected(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mock_app.NewMockTaskRepository(ctrl)
+	mockRepo.EXPECT().RetryTask(gomock.Any(), int64(1), false).Return(nil, errs.ErrInvalidTaskStatus)
+
+	uc := CreateTaskUsecase(mockRepo, t.TempDir())
+	_, err := uc.RetryTask(context.Background(), 1, false)
+	assert.ErrorIs(t, err, errs.ErrInvalidTaskStatus)
+
+	require.NoError(t, uc.Shutdown(context.Background()))
+	_, err = uc.RetryTask(context.Background(), 1, false)
+	assert.ErrorIs(t, err, errs.ErrShuttingDown)
+}
+
+func TestTaskUsecase_OpenArchive_Versions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := storage.NewMemory()
+	putZip(t, store, "task_1.zip", map[string]string{"a.pdf": "first"})
+
+	// the second version is still being built
+	task := &models.Task{ID: 1, Status: models.StatusProcessing, ArchiveVersion: 3}
+	mockRepo := mock_app.NewMockTaskRepository(ctrl)
+	mockRepo.EXPECT().GetTask(gomock.Any(), int64(1)).Return(task, nil).AnyTimes()
+	uc := CreateTaskUsecase(mockRepo, t.TempDir(), WithArchiveStore(store))
+
+	file, err := uc.OpenArchive(context.Background(), 1, 1)
+	require.NoError(t, err)
+	file.Body.Close()
+	assert.Equal(t, "task_1.zip", file.Name)
+
+	_, err = uc.OpenArchive(context.Background(), 1, 0)
+	assert.ErrorIs(t, err, errs.ErrArchiveNotReady)
+	_, err = uc.OpenArchive(context.Background(), 1, 2)
+	assert.ErrorIs(t, err, errs.ErrVersionNotFound, "a version that was never stored")
+	_, err = uc.OpenArchive(context.Background(), 1, 4)
+	assert.ErrorIs(t, err, errs.ErrVersionNotFound)
+}
+
+func TestTaskUsecase_DeleteTask_AllVersions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := storage.NewMemory()
+	putZip(t, store, "task_1.zip", map[string]string{"a.pdf": "first"})
+	putZip(t, store, "task_1.v2.zip", map[string]string{"a.pdf": "second"})
+
+	mockRepo := mock_app.NewMockTaskRepository(ctrl)
+	mockRepo.EXPECT().GetTask(gomock.Any(), int64(1)).Return(&models.Task{ID: 1, Status: models.StatusDone, ArchiveVersion: 2}, nil)
+	mockRepo.EXPECT().DeleteTask(gomock.Any(), int64(1)).Return(nil)
+
+	uc := CreateTaskUsecase(mockRepo, t.TempDir(), WithArchiveStore(store))
+	require.NoError(t, uc.DeleteTask(context.Background(), 1))
+
+	for _, key := range []string{"task_1.zip", "task_1.v2.zip"} {
+		_, err := store.Stat(context.Background(), key)
+		assert.ErrorIs(t, err, storage.ErrNotFound, key)
+	}
+}
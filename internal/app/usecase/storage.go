@@ -0,0 +1,211 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/supchaser/test_task/internal/app"
+	"github.com/supchaser/test_task/internal/app/models"
+	"github.com/supchaser/test_task/internal/storage"
+	"github.com/supchaser/test_task/internal/utils/errs"
+	"github.com/supchaser/test_task/internal/utils/logger"
+	"go.uber.org/zap"
+)
+
+// WithArchiveStore sets where finished archives are kept. By default they
+// are files in the storage path.
+func WithArchiveStore(store app.ArchiveStore) Option {
+	return func(u *TaskUsecase) {
+		u.store = store
+	}
+}
+
+// archiveKey is the name of one archive version of a task in the archive
+// store. The first version keeps the name it had before retries existed.
+func archiveKey(taskID int64, format string, version int) string {
+	if version <= 1 {
+		return fmt.Sprintf("task_%d%s", taskID, taskFormat(format).Extension())
+	}
+	return fmt.Sprintf("task_%d.v%d%s", taskID, version, taskFormat(format).Extension())
+}
+
+// archiveVersion is the version the latest archive of the task is stored as.
+func archiveVersion(task *models.Task) int {
+	return max(task.ArchiveVersion, 1)
+}
+
+// deleteArchives removes every archive version of the task. It goes on past
+// a failed version and returns the first error.
+func (u *TaskUsecase) deleteArchives(ctx context.Context, task *models.Task) error {
+	var first error
+	for version := 1; version <= archiveVersion(task); version++ {
+		key := archiveKey(task.ID, task.Format, version)
+		if err := u.store.Delete(ctx, key); err != nil {
+			logger.Error("failed to remove archive",
+				zap.String("function", "TaskUsecase.deleteArchives"),
+				zap.Int64("task_id", task.ID),
+				zap.String("archive_key", key),
+				zap.Error(err),
+			)
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+// tempPatterns match the scratch files of downloads and archives being built.
+var tempPatterns = []string{".download-*", ".archive-*"}
+
+// tempRemover is implemented by stores that keep partial uploads on disk.
+type tempRemover interface {
+	RemoveTemp() (int, error)
+}
+
+// CleanupTempFiles removes scratch files left behind by a process that
+// stopped mid-task. It is meant to run at startup, before any task is
+// processed, since every temp file found then is an orphan.
+func (u *TaskUsecase) CleanupTempFiles() error {
+	const funcName = "TaskUsecase.CleanupTempFiles"
+
+	removed := 0
+	for _, pattern := range tempPatterns {
+		matches, err := filepath.Glob(filepath.Join(u.storagePath, pattern))
+		if err != nil {
+			return err
+		}
+		for _, path := range matches {
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				logger.Error("failed to remove temp file",
+					zap.String("function", funcName),
+					zap.String("path", path),
+					zap.Error(err),
+				)
+				return err
+			}
+			removed++
+		}
+	}
+
+	if remover, ok := u.store.(tempRemover); ok {
+		n, err := remover.RemoveTemp()
+		removed += n
+		if err != nil {
+			logger.Error("failed to remove partial archives",
+				zap.String("function", funcName),
+				zap.Error(err),
+			)
+			return err
+		}
+	}
+
+	logger.Info("temp files cleaned up",
+		zap.String("function", funcName),
+		zap.Int("removed", removed),
+	)
+	return nil
+}
+
+// storeArchive hands the finished archive file to the store and returns its size.
+func (u *TaskUsecase) storeArchive(ctx context.Context, key string, file *os.File) (int64, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("stat archive: %w", err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("rewind archive: %w", err)
+	}
+	if err := u.store.Put(ctx, key, file, info.Size()); err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// OpenArchive opens a stored archive of the task. Version 0 is the latest
+// one, which is only available once the task is done; earlier versions stay
+// available while a retry builds the next one.
+func (u *TaskUsecase) OpenArchive(ctx context.Context, taskID int64, version int) (*models.ArchiveFile, error) {
+	const funcName = "TaskUsecase.OpenArchive"
+	logger.Debug("opening archive",
+		zap.String("function", funcName),
+		zap.Int64("task_id", taskID),
+		zap.Int("version", version),
+	)
+
+	task, err := u.taskRepository.GetTask(ctx, taskID)
+	if err != nil {
+		logger.Error("failed to get task",
+			zap.String("function", funcName),
+			zap.Int64("task_id", taskID),
+			zap.Error(err),
+		)
+		return nil, err
+	}
+
+	latest := archiveVersion(task)
+	if version < 0 || version > latest {
+		return nil, fmt.Errorf("%w: task has %d", errs.ErrVersionNotFound, latest)
+	}
+	if version == 0 || version == latest {
+		if task.Stats != nil && task.Stats.Streamed {
+			return nil, errs.ErrArchiveNotStored
+		}
+		if task.Status != models.StatusDone {
+			return nil, fmt.Errorf("%w: task is %s", errs.ErrArchiveNotReady, task.Status)
+		}
+		version = latest
+	}
+
+	key := archiveKey(task.ID, task.Format, version)
+	info, err := u.store.Stat(ctx, key)
+	if err != nil {
+		return nil, versionError(funcName, task, version, key, err)
+	}
+	body, err := u.store.Open(ctx, key)
+	if err != nil {
+		return nil, versionError(funcName, task, version, key, err)
+	}
+
+	return &models.ArchiveFile{
+		Name:        key,
+		ContentType: taskFormat(task.Format).ContentType(),
+		Size:        info.Size,
+		ModTime:     info.ModTime,
+		Body:        body,
+	}, nil
+}
+
+// versionError is storeError for an archive version. An earlier version
+// that is gone, for example because it was never stored, is not a server
+// fault.
+func versionError(funcName string, task *models.Task, version int, key string, err error) error {
+	if version < archiveVersion(task) && errors.Is(err, storage.ErrNotFound) {
+		logger.Warn("archive version not stored",
+			zap.String("function", funcName),
+			zap.Int64("task_id", task.ID),
+			zap.String("archive_key", key),
+		)
+		return fmt.Errorf("%w: %w", errs.ErrVersionNotFound, err)
+	}
+	return storeError(funcName, task.ID, key, err)
+}
+
+// storeError logs a failed store lookup and reports a missing archive of a
+// finished task as errs.ErrArchiveMissing.
+func storeError(funcName string, taskID int64, key string, err error) error {
+	logger.Error("failed to open archive",
+		zap.String("function", funcName),
+		zap.Int64("task_id", taskID),
+		zap.String("archive_key", key),
+		zap.Error(err),
+	)
+	if errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("%w: %w", errs.ErrArchiveMissing, err)
+	}
+	return err
+}
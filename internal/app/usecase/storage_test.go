@@ -0,0 +1,170 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	mock_app "github.com/supchaser/test_task/internal/app/mocks"
+	"github.com/supchaser/test_task/internal/app/models"
+	"github.com/supchaser/test_task/internal/storage"
+	"github.com/supchaser/test_task/internal/utils/errs"
+)
+
+func TestTaskUsecase_buildArchive_UsesStore(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Write([]byte("%PDF-stored"))
+	}))
+	defer testServer.Close()
+
+	mockRepo := mock_app.NewMockTaskRepository(ctrl)
+	mockRepo.EXPECT().UpdateTaskStatus(gomock.Any(), int64(1), models.StatusProcessing).Return(nil)
+	mockRepo.EXPECT().
+		GetTask(gomock.Any(), int64(1)).
+		Return(&models.Task{
+			ID:      1,
+			Status:  models.StatusProcessing,
+			Format:  "tar.gz",
+			Objects: []*models.Object{{URL: testServer.URL + "/doc.pdf"}},
+		}, nil).AnyTimes()
+	mockRepo.EXPECT().UpdateObject(gomock.Any(), int64(1), gomock.Any()).Return(nil).AnyTimes()
+	mockRepo.EXPECT().SetArchiveStats(gomock.Any(), int64(1), gomock.Any()).Return(nil)
+	mockRepo.EXPECT().UpdateTaskStatus(gomock.Any(), int64(1), models.StatusDone).Return(nil)
+
+	store := storage.NewMemory()
+	workDir := t.TempDir()
+	uc := CreateTaskUsecase(mockRepo, workDir, WithArchiveStore(store))
+	uc.ProcessTask(context.Background(), 1)
+
+	info, err := store.Stat(context.Background(), "task_1.tar.gz")
+	require.NoError(t, err)
+	assert.Positive(t, info.Size)
+
+	// nothing but the store keeps the archive
+	entries, err := os.ReadDir(workDir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestTaskUsecase_OpenArchive(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := storage.NewMemory()
+	require.NoError(t, store.Put(context.Background(), "task_1.tar.zst", strings.NewReader("archive"), 7))
+
+	tests := []struct {
+		name        string
+		task        *models.Task
+		expectedErr error
+	}{
+		{
+			name: "Success",
+			task: &models.Task{ID: 1, Status: models.StatusDone, Format: "tar.zst"},
+		},
+		{
+			name:        "NotReady",
+			task:        &models.Task{ID: 1, Status: models.StatusProcessing, Format: "tar.zst"},
+			expectedErr: errs.ErrArchiveNotReady,
+		},
+		{
+			name:        "Streamed",
+			task:        &models.Task{ID: 1, Status: models.StatusDone, Stats: &models.ArchiveStats{Streamed: true}},
+			expectedErr: errs.ErrArchiveNotStored,
+		},
+		{
+			name:        "Missing",
+			task:        &models.Task{ID: 1, Status: models.StatusDone, Format: "zip"},
+			expectedErr: errs.ErrArchiveMissing,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := mock_app.NewMockTaskRepository(ctrl)
+			mockRepo.EXPECT().GetTask(gomock.Any(), int64(1)).Return(tt.task, nil)
+
+			uc := CreateTaskUsecase(mockRepo, t.TempDir(), WithArchiveStore(store))
+			file, err := uc.OpenArchive(context.Background(), 1, 0)
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			defer file.Body.Close()
+			assert.Equal(t, "task_1.tar.zst", file.Name)
+			assert.Equal(t, "application/zstd", file.ContentType)
+			assert.Equal(t, int64(7), file.Size)
+			data, err := io.ReadAll(file.Body)
+			require.NoError(t, err)
+			assert.Equal(t, "archive", string(data))
+		})
+	}
+}
+
+func TestTaskUsecase_CleanupTempFiles(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	workDir := t.TempDir()
+	for _, name := range []string{".download-1", ".archive-2", ".put-3", "task_1.zip"} {
+		require.NoError(t, os.WriteFile(filepath.Join(workDir, name), []byte("data"), 0o644))
+	}
+
+	uc := CreateTaskUsecase(mock_app.NewMockTaskRepository(ctrl), workDir)
+	require.NoError(t, uc.CleanupTempFiles())
+
+	entries, err := os.ReadDir(workDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "task_1.zip", entries[0].Name(), "finished archives are kept")
+}
+
+func TestTaskUsecase_buildArchive_StoreFails(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Write([]byte("%PDF-stored"))
+	}))
+	defer testServer.Close()
+
+	mockRepo := mock_app.NewMockTaskRepository(ctrl)
+	mockRepo.EXPECT().UpdateTaskStatus(gomock.Any(), int64(1), models.StatusProcessing).Return(nil)
+	mockRepo.EXPECT().
+		GetTask(gomock.Any(), int64(1)).
+		Return(&models.Task{
+			ID:      1,
+			Status:  models.StatusProcessing,
+			Objects: []*models.Object{{URL: testServer.URL + "/doc.pdf"}},
+		}, nil).AnyTimes()
+	mockRepo.EXPECT().UpdateObject(gomock.Any(), int64(1), gomock.Any()).Return(nil).AnyTimes()
+	// the task must not be reported done when the archive was not stored
+	mockRepo.EXPECT().UpdateTaskStatus(gomock.Any(), int64(1), models.StatusFailed).Return(nil)
+
+	store := mock_app.NewMockArchiveStore(ctrl)
+	store.EXPECT().Put(gomock.Any(), "task_1.zip", gomock.Any(), gomock.Any()).Return(errors.New("disk full"))
+
+	workDir := t.TempDir()
+	uc := CreateTaskUsecase(mockRepo, workDir, WithArchiveStore(store))
+	uc.ProcessTask(context.Background(), 1)
+
+	entries, err := os.ReadDir(workDir)
+	require.NoError(t, err)
+	assert.Empty(t, entries, "scratch files are removed after a failure")
+}
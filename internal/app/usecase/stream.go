@@ -0,0 +1,428 @@
+package usecase
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/supchaser/test_task/internal/app/models"
+	"github.com/supchaser/test_task/internal/archive"
+	"github.com/supchaser/test_task/internal/utils/errs"
+	"github.com/supchaser/test_task/internal/utils/logger"
+	"github.com/supchaser/test_task/internal/utils/retry"
+	"github.com/supchaser/test_task/internal/utils/validate"
+	"go.uber.org/zap"
+)
+
+// errStreamAborted marks failures of the stream itself, usually a client
+// that went away. Nothing more can be sent after one.
+var errStreamAborted = errors.New("archive stream aborted")
+
+// StreamTask builds the zip of a waiting task straight into w instead of
+// storing it. Nothing is written to w when an error is returned before the
+// stream starts; failed objects are only reported in the trailing manifest.
+// Shutdown waits for the stream like for an archive job; a stream it has to
+// cut off leaves the task failed.
+func (u *TaskUsecase) StreamTask(ctx context.Context, taskID int64, w io.Writer) error {
+	const funcName = "TaskUsecase.StreamTask"
+	logger.Debug("streaming task archive",
+		zap.String("function", funcName),
+		zap.Int64("task_id", taskID),
+	)
+
+	if u.Draining() {
+		return errs.ErrShuttingDown
+	}
+
+	task, err := u.taskRepository.GetTask(ctx, taskID)
+	if err != nil {
+		logger.Error("failed to get task",
+			zap.String("function", funcName),
+			zap.Int64("task_id", taskID),
+			zap.Error(err),
+		)
+		return err
+	}
+
+	if task.Status != models.StatusWaiting {
+		return fmt.Errorf("%w: task is %s", errs.ErrInvalidTaskStatus, task.Status)
+	}
+	if len(task.Objects) == 0 {
+		return errs.ErrNoObjects
+	}
+	if format := taskFormat(task.Format); format != archive.FormatZip {
+		return fmt.Errorf("%w: format is %s", errs.ErrStreamFormat, format)
+	}
+
+	ctx, finish, err := u.jobs.attach(ctx, taskID)
+	if err != nil {
+		return err
+	}
+	defer finish()
+
+	if err := u.taskRepository.UpdateTaskStatus(ctx, taskID, models.StatusProcessing); err != nil {
+		logger.Error("failed to update task status",
+			zap.String("function", funcName),
+			zap.Int64("task_id", taskID),
+			zap.Error(err),
+		)
+		return err
+	}
+
+	manifest, stats, err := u.streamArchive(ctx, w, task, true)
+	if err != nil {
+		logger.Error("archive stream interrupted",
+			zap.String("function", funcName),
+			zap.Int64("task_id", taskID),
+			zap.Error(err),
+		)
+		// the client that asked for the stream is gone, so the task is never
+		// resumed into a stored archive, not even after a shutdown
+		u.taskRepository.UpdateTaskStatus(context.WithoutCancel(ctx), taskID, models.StatusFailed)
+		return err
+	}
+
+	stats.Streamed = true
+	if err := u.taskRepository.SetArchiveStats(ctx, taskID, stats); err != nil {
+		logger.Warn("failed to save archive stats",
+			zap.String("function", funcName),
+			zap.Int64("task_id", taskID),
+			zap.Error(err),
+		)
+	}
+
+	status := models.StatusDone
+	if manifest.Archived == 0 {
+		status = models.StatusFailed
+	}
+	if err := u.taskRepository.UpdateTaskStatus(ctx, taskID, status); err != nil {
+		logger.Error("failed to update task status",
+			zap.String("function", funcName),
+			zap.Int64("task_id", taskID),
+			zap.Error(err),
+		)
+	}
+
+	logger.Info("task archive streamed",
+		zap.String("function", funcName),
+		zap.Int64("task_id", taskID),
+		zap.Int("files_processed", manifest.Archived),
+		zap.Int("total_files", len(task.Objects)),
+	)
+
+	return nil
+}
+
+// StreamArchive streams a one-off zip of the requested URLs into w without
+// creating a task. The objects go through the same checks and limits as the
+// objects of a task.
+func (u *TaskUsecase) StreamArchive(ctx context.Context, req models.StreamRequest, w io.Writer) error {
+	const funcName = "TaskUsecase.StreamArchive"
+	logger.Debug("streaming one-off archive",
+		zap.String("function", funcName),
+		zap.Int("urls", len(req.URLs)),
+	)
+
+	if u.Draining() {
+		return errs.ErrShuttingDown
+	}
+
+	if len(req.URLs) == 0 {
+		return errs.ErrNoObjects
+	}
+	// the last URL has to fit into a task just like an added object
+	if err := validate.ValidateObjectLimit(len(req.URLs)-1, u.taskRepository.GetMaxObjects()); err != nil {
+		return err
+	}
+
+	format, err := archive.ParseFormat(req.Format)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errs.ErrInvalidFormat, err)
+	}
+	if format != archive.FormatZip {
+		return fmt.Errorf("%w: format is %s", errs.ErrStreamFormat, format)
+	}
+	if err := normalizeCompression(&req.TaskOptions); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	task := &models.Task{
+		Status:           models.StatusProcessing,
+		Format:           string(format),
+		Encrypted:        req.Password != "",
+		Compression:      req.Compression,
+		CompressionLevel: req.CompressionLevel,
+		Password:         req.Password,
+		Objects:          make([]*models.Object, 0, len(req.URLs)),
+		CreatedAt:        now,
+		UpdatedAt:        now,
+	}
+	for i, rawURL := range req.URLs {
+		task.Objects = append(task.Objects, &models.Object{
+			ID:    int64(i + 1),
+			URL:   rawURL,
+			Name:  req.Names[rawURL],
+			State: models.ObjectPending,
+		})
+	}
+
+	manifest, _, err := u.streamArchive(ctx, w, task, false)
+	if err != nil {
+		logger.Error("archive stream interrupted",
+			zap.String("function", funcName),
+			zap.Error(err),
+		)
+		return err
+	}
+
+	logger.Info("one-off archive streamed",
+		zap.String("function", funcName),
+		zap.Int("files_processed", manifest.Archived),
+		zap.Int("total_files", len(task.Objects)),
+	)
+
+	return nil
+}
+
+// streamArchive downloads the objects one at a time and writes each into the
+// zip as it arrives, then appends the manifest. Object states are saved to
+// the repository only when persist is set. The returned error means the
+// stream itself failed and the archive is incomplete.
+func (u *TaskUsecase) streamArchive(ctx context.Context, w io.Writer, task *models.Task, persist bool) (*models.Manifest, models.ArchiveStats, error) {
+	const funcName = "TaskUsecase.streamArchive"
+
+	save := func(obj *models.Object) {
+		if persist {
+			u.saveObject(ctx, task.ID, obj)
+		}
+	}
+
+	out := &countingWriter{w: w}
+	archiveWriter, err := archive.NewWriter(archive.FormatZip, out, u.writerOptions(task)...)
+	if err != nil {
+		return nil, models.ArchiveStats{}, err
+	}
+
+	budget := newArchiveBudget(u.maxArchiveSize)
+	namer := newEntryNamer(u.filePolicy)
+	var contentSize int64
+	for _, obj := range task.Objects {
+		if err := ctx.Err(); err != nil {
+			return nil, models.ArchiveStats{}, fmt.Errorf("%w: %w", errStreamAborted, err)
+		}
+
+		obj.State = models.ObjectDownloading
+		obj.Error = ""
+		save(obj)
+
+		if err := u.streamObject(ctx, archiveWriter, namer, obj, budget); err != nil {
+			if errors.Is(err, errStreamAborted) {
+				return nil, models.ArchiveStats{}, err
+			}
+			if ctx.Err() != nil {
+				return nil, models.ArchiveStats{}, fmt.Errorf("%w: %w", errStreamAborted, context.Cause(ctx))
+			}
+			logger.Warn("failed to stream file",
+				zap.String("function", funcName),
+				zap.Int64("task_id", task.ID),
+				zap.String("url", obj.URL),
+				zap.Error(err),
+			)
+			obj.State = models.ObjectFailed
+			obj.Error = err.Error()
+			save(obj)
+			continue
+		}
+
+		obj.State = models.ObjectArchived
+		save(obj)
+		contentSize += obj.Size
+	}
+
+	// the response is already under way, so failures can only be reported
+	// inside the archive
+	manifest := buildManifest(task)
+	if err := writeManifest(archiveWriter, manifest); err != nil {
+		return nil, models.ArchiveStats{}, fmt.Errorf("%w: %w", errStreamAborted, err)
+	}
+	if u.report {
+		if err := writeReport(archiveWriter, manifest); err != nil {
+			return nil, models.ArchiveStats{}, fmt.Errorf("%w: %w", errStreamAborted, err)
+		}
+	}
+	if err := archiveWriter.Close(); err != nil {
+		return nil, models.ArchiveStats{}, fmt.Errorf("%w: %w", errStreamAborted, err)
+	}
+
+	return manifest, archiveStats(contentSize, out.n), nil
+}
+
+// streamObject downloads one object into its own zip entry, retrying
+// transient failures until the entry is started. Once data has gone out a
+// failure leaves a truncated entry behind, which the manifest reports.
+func (u *TaskUsecase) streamObject(ctx context.Context, w archive.Writer, namer *entryNamer, obj *models.Object, budget *archiveBudget) error {
+	parsed, err := url.Parse(obj.URL)
+	if err != nil {
+		return fmt.Errorf("parse url: %w", err)
+	}
+
+	started := time.Now()
+	defer func() {
+		obj.DurationMs = time.Since(started).Milliseconds()
+	}()
+
+	return u.retryPolicy.Do(ctx, func(number int) error {
+		attempt := models.Attempt{
+			Phase:     models.PhaseDownload,
+			Number:    number,
+			StartedAt: time.Now(),
+		}
+
+		err := u.streamAttempt(ctx, parsed.Host, w, namer, obj, &attempt, budget)
+		if err != nil {
+			attempt.Error = err.Error()
+		}
+		obj.Attempts = append(obj.Attempts, attempt)
+		return err
+	})
+}
+
+func (u *TaskUsecase) streamAttempt(ctx context.Context, host string, w archive.Writer, namer *entryNamer, obj *models.Object, attempt *models.Attempt, budget *archiveBudget) error {
+	release, err := u.downloads.acquire(ctx, host)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	resp, err := u.fetcher.Get(ctx, obj.URL)
+	if err != nil {
+		if retry.IsRetryableError(ctx, err) {
+			return retry.Retryable(err, 0)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	obj.HTTPStatus = resp.StatusCode
+	attempt.HTTPStatus = resp.StatusCode
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("invalid response status: %d", resp.StatusCode)
+		if retry.IsRetryableStatus(resp.StatusCode) {
+			return retry.Retryable(err, retry.ParseRetryAfter(resp.Header.Get("Retry-After")))
+		}
+		return err
+	}
+
+	declared := u.filePolicy.DeclaredType(resp.Header, obj.URL)
+	if err := u.filePolicy.ValidateDeclaredType(declared); err != nil {
+		return err
+	}
+
+	body := bufio.NewReaderSize(resp.Body, sniffLen)
+	head, err := body.Peek(sniffLen)
+	if err != nil && !errors.Is(err, io.EOF) {
+		err = fmt.Errorf("read response body: %w", err)
+		if retry.IsRetryableError(ctx, err) {
+			return retry.Retryable(err, 0)
+		}
+		return err
+	}
+	contentType, err := u.filePolicy.ValidateContent(declared, head)
+	obj.ContentType = contentType
+	if err != nil {
+		return err
+	}
+	if resp.ContentLength > 0 {
+		if err := u.checkObjectSize(contentType, resp.ContentLength); err != nil {
+			return err
+		}
+		if err := budget.fits(resp.ContentLength); err != nil {
+			return err
+		}
+	}
+
+	// from here on the data goes out, so nothing below is retried
+	name := namer.name(obj, validate.DispositionFilename(resp.Header.Get("Content-Disposition")))
+	src := &entrySource{
+		r:     body,
+		limit: u.objectSizeLimit(contentType),
+		check: func(size int64) error { return u.checkObjectSize(contentType, size) },
+		hash:  sha256.New(),
+		share: budget.share(),
+	}
+	entry := archive.Entry{
+		Name:        name,
+		Size:        archive.SizeUnknown,
+		ModTime:     time.Now(),
+		ContentType: contentType,
+	}
+	if err := w.AddFile(entry, src); err != nil {
+		if src.err == nil {
+			return fmt.Errorf("%w: %w", errStreamAborted, err)
+		}
+		if errors.Is(src.err, errs.ErrFileTooLarge) || errors.Is(src.err, errs.ErrArchiveTooLarge) {
+			return fmt.Errorf("entry %s is truncated: %w", name, src.err)
+		}
+		return fmt.Errorf("entry %s is truncated: read response body: %w", name, src.err)
+	}
+
+	obj.ArchiveName = name
+	obj.Size = src.size
+	obj.SHA256 = hex.EncodeToString(src.hash.Sum(nil))
+	return nil
+}
+
+// entrySource feeds a response body into its zip entry. It enforces the size
+// limits before the bytes reach the archive and keeps the read error apart,
+// so that a failed download is not mistaken for a failed stream. The bytes
+// that went out stay charged to the budget.
+type entrySource struct {
+	r     io.Reader
+	limit int64
+	check func(size int64) error
+	hash  hash.Hash
+	share *budgetShare
+	size  int64
+	err   error
+}
+
+func (s *entrySource) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if n > 0 {
+		if s.limit > 0 && s.size+int64(n) > s.limit {
+			s.err = s.check(s.size + int64(n))
+			return 0, s.err
+		}
+		if _, err := s.share.Write(p[:n]); err != nil {
+			s.err = err
+			return 0, err
+		}
+		s.hash.Write(p[:n])
+		s.size += int64(n)
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		s.err = err
+	}
+	return n, err
+}
+
+// countingWriter counts the bytes of the archive sent to the client.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
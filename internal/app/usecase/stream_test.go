@@ -0,0 +1,302 @@
+package usecase
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	mock_app "github.com/supchaser/test_task/internal/app/mocks"
+	"github.com/supchaser/test_task/internal/app/models"
+	"github.com/supchaser/test_task/internal/utils/errs"
+)
+
+func newStreamServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/doc.pdf":
+			w.Header().Set("Content-Type", "application/pdf")
+			w.Write([]byte("%PDF-streamed document"))
+		case "/big.pdf":
+			// no Content-Length, so the limit is only hit while streaming
+			w.Header().Set("Content-Type", "application/pdf")
+			w.Write([]byte("%PDF-" + strings.Repeat("x", 1000)))
+			w.(http.Flusher).Flush()
+			w.Write([]byte(strings.Repeat("y", 1000)))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// readStream unpacks a streamed zip and its manifest.
+func readStream(t *testing.T, data []byte) (map[string]string, models.Manifest) {
+	t.Helper()
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+
+	files := make(map[string]string)
+	for _, f := range reader.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		rc.Close()
+		files[f.Name] = string(content)
+	}
+
+	var manifest models.Manifest
+	require.NoError(t, json.Unmarshal([]byte(files[manifestName]), &manifest))
+	return files, manifest
+}
+
+func TestTaskUsecase_StreamArchive(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	server := newStreamServer(t)
+	mockRepo := mock_app.NewMockTaskRepository(ctrl)
+	mockRepo.EXPECT().GetMaxObjects().Return(3).AnyTimes()
+
+	uc := CreateTaskUsecase(mockRepo, t.TempDir(), WithSizeLimits(1500, 0))
+
+	var buf bytes.Buffer
+	err := uc.StreamArchive(context.Background(), models.StreamRequest{
+		Request: models.Request{
+			URLs:  []string{server.URL + "/doc.pdf", server.URL + "/missing.pdf", server.URL + "/big.pdf"},
+			Names: map[string]string{server.URL + "/doc.pdf": "report.pdf"},
+		},
+	}, &buf)
+	require.NoError(t, err)
+
+	files, manifest := readStream(t, buf.Bytes())
+	assert.Equal(t, "%PDF-streamed document", files["report.pdf"])
+	assert.Zero(t, manifest.TaskID)
+	assert.Equal(t, 1, manifest.Archived)
+	assert.Equal(t, 2, manifest.Failed)
+	require.Len(t, manifest.Objects, 3)
+	assert.Equal(t, models.ObjectArchived, manifest.Objects[0].State)
+	assert.Equal(t, models.ObjectFailed, manifest.Objects[1].State)
+	assert.Contains(t, manifest.Objects[1].Error, "404")
+
+	// the oversized object was cut at the limit and is reported as failed
+	assert.Equal(t, models.ObjectFailed, manifest.Objects[2].State)
+	assert.Contains(t, manifest.Objects[2].Error, errs.ErrFileTooLarge.Error())
+	assert.LessOrEqual(t, len(files["big.pdf"]), 1500)
+}
+
+func TestTaskUsecase_StreamArchive_Validation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mock_app.NewMockTaskRepository(ctrl)
+	mockRepo.EXPECT().GetMaxObjects().Return(2).AnyTimes()
+	uc := CreateTaskUsecase(mockRepo, t.TempDir())
+
+	tests := []struct {
+		name        string
+		req         models.StreamRequest
+		expectedErr error
+	}{
+		{
+			name:        "NoURLs",
+			expectedErr: errs.ErrNoObjects,
+		},
+		{
+			name:        "TooManyURLs",
+			req:         models.StreamRequest{Request: models.Request{URLs: []string{"a", "b", "c"}}},
+			expectedErr: errs.ErrMaxObjectsReached,
+		},
+		{
+			name: "TarFormat",
+			req: models.StreamRequest{
+				Request:     models.Request{URLs: []string{"a"}},
+				TaskOptions: models.TaskOptions{Format: "tar"},
+			},
+			expectedErr: errs.ErrStreamFormat,
+		},
+		{
+			name: "InvalidCompression",
+			req: models.StreamRequest{
+				Request:     models.Request{URLs: []string{"a"}},
+				TaskOptions: models.TaskOptions{Compression: "lzma"},
+			},
+			expectedErr: errs.ErrInvalidCompression,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := uc.StreamArchive(context.Background(), tt.req, &buf)
+			assert.ErrorIs(t, err, tt.expectedErr)
+			assert.Zero(t, buf.Len(), "nothing is sent for a rejected request")
+		})
+	}
+}
+
+func TestTaskUsecase_StreamTask(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	server := newStreamServer(t)
+	var stats models.ArchiveStats
+	mockRepo := mock_app.NewMockTaskRepository(ctrl)
+	mockRepo.EXPECT().
+		GetTask(gomock.Any(), int64(1)).
+		Return(&models.Task{
+			ID:      1,
+			Status:  models.StatusWaiting,
+			Objects: []*models.Object{{ID: 1, URL: server.URL + "/doc.pdf"}},
+		}, nil)
+	mockRepo.EXPECT().UpdateTaskStatus(gomock.Any(), int64(1), models.StatusProcessing).Return(nil)
+	mockRepo.EXPECT().UpdateObject(gomock.Any(), int64(1), gomock.Any()).Return(nil).AnyTimes()
+	mockRepo.EXPECT().
+		SetArchiveStats(gomock.Any(), int64(1), gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ int64, s models.ArchiveStats) error {
+			stats = s
+			return nil
+		})
+	mockRepo.EXPECT().UpdateTaskStatus(gomock.Any(), int64(1), models.StatusDone).Return(nil)
+
+	uc := CreateTaskUsecase(mockRepo, t.TempDir())
+
+	var buf bytes.Buffer
+	require.NoError(t, uc.StreamTask(context.Background(), 1, &buf))
+
+	files, manifest := readStream(t, buf.Bytes())
+	assert.Equal(t, "%PDF-streamed document", files["doc.pdf"])
+	assert.Equal(t, int64(1), manifest.TaskID)
+	assert.True(t, stats.Streamed)
+	assert.Equal(t, int64(buf.Len()), stats.ArchiveSize)
+	assert.NoFileExists(t, filepath.Join(uc.storagePath, archiveKey(1, "", 1)))
+}
+
+func TestTaskUsecase_StreamTask_Rejected(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tests := []struct {
+		name        string
+		task        *models.Task
+		expectedErr error
+	}{
+		{
+			name:        "NotWaiting",
+			task:        &models.Task{ID: 1, Status: models.StatusDone, Objects: []*models.Object{{ID: 1}}},
+			expectedErr: errs.ErrInvalidTaskStatus,
+		},
+		{
+			name:        "NoObjects",
+			task:        &models.Task{ID: 1, Status: models.StatusWaiting},
+			expectedErr: errs.ErrNoObjects,
+		},
+		{
+			name:        "TarFormat",
+			task:        &models.Task{ID: 1, Status: models.StatusWaiting, Format: "tar.gz", Objects: []*models.Object{{ID: 1}}},
+			expectedErr: errs.ErrStreamFormat,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := mock_app.NewMockTaskRepository(ctrl)
+			mockRepo.EXPECT().GetTask(gomock.Any(), int64(1)).Return(tt.task, nil)
+
+			uc := CreateTaskUsecase(mockRepo, t.TempDir())
+			err := uc.StreamTask(context.Background(), 1, io.Discard)
+			assert.ErrorIs(t, err, tt.expectedErr)
+		})
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("connection reset by peer")
+}
+
+func TestTaskUsecase_StreamTask_ClientGone(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	server := newStreamServer(t)
+	mockRepo := mock_app.NewMockTaskRepository(ctrl)
+	mockRepo.EXPECT().
+		GetTask(gomock.Any(), int64(1)).
+		Return(&models.Task{
+			ID:      1,
+			Status:  models.StatusWaiting,
+			Objects: []*models.Object{{ID: 1, URL: server.URL + "/doc.pdf"}},
+		}, nil)
+	mockRepo.EXPECT().UpdateTaskStatus(gomock.Any(), int64(1), models.StatusProcessing).Return(nil)
+	mockRepo.EXPECT().UpdateObject(gomock.Any(), int64(1), gomock.Any()).Return(nil).AnyTimes()
+	mockRepo.EXPECT().UpdateTaskStatus(gomock.Any(), int64(1), models.StatusFailed).Return(nil)
+
+	uc := CreateTaskUsecase(mockRepo, t.TempDir())
+	err := uc.StreamTask(context.Background(), 1, failingWriter{})
+	assert.ErrorIs(t, err, errStreamAborted)
+}
+
+func TestTaskUsecase_StreamTask_Shutdown(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	requested := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(requested)
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	mockRepo := mock_app.NewMockTaskRepository(ctrl)
+	mockRepo.EXPECT().
+		GetTask(gomock.Any(), int64(1)).
+		Return(&models.Task{
+			ID:      1,
+			Status:  models.StatusWaiting,
+			Objects: []*models.Object{{ID: 1, URL: server.URL + "/doc.pdf"}},
+		}, nil)
+	mockRepo.EXPECT().UpdateTaskStatus(gomock.Any(), int64(1), models.StatusProcessing).Return(nil)
+	mockRepo.EXPECT().UpdateObject(gomock.Any(), int64(1), gomock.Any()).Return(nil).AnyTimes()
+	var failed atomic.Bool
+	mockRepo.EXPECT().
+		UpdateTaskStatus(gomock.Any(), int64(1), models.StatusFailed).
+		DoAndReturn(func(context.Context, int64, models.TaskStatus) error {
+			failed.Store(true)
+			return nil
+		})
+	// a stream cut off by the shutdown must not become resumable
+	mockRepo.EXPECT().UpdateTaskStatus(gomock.Any(), int64(1), models.StatusInterrupted).Times(0)
+
+	uc := CreateTaskUsecase(mockRepo, t.TempDir(), WithJobTimeout(0))
+
+	streamErr := make(chan error, 1)
+	go func() {
+		streamErr <- uc.StreamTask(context.Background(), 1, io.Discard)
+	}()
+	<-requested
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := uc.Shutdown(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.True(t, failed.Load(), "Shutdown returns only after the stream has saved its status")
+
+	assert.ErrorIs(t, <-streamErr, errs.ErrShuttingDown)
+}
@@ -1,42 +1,130 @@
 package usecase
 
 import (
-	"archive/zip"
 	"context"
+	"errors"
 	"fmt"
-	"io"
-	"net/http"
 	"os"
-	"path/filepath"
+	"time"
 
 	"github.com/supchaser/test_task/internal/app"
 	"github.com/supchaser/test_task/internal/app/models"
+	"github.com/supchaser/test_task/internal/archive"
+	"github.com/supchaser/test_task/internal/fetcher"
+	"github.com/supchaser/test_task/internal/storage"
+	"github.com/supchaser/test_task/internal/utils/errs"
 	"github.com/supchaser/test_task/internal/utils/logger"
+	"github.com/supchaser/test_task/internal/utils/retry"
+	"github.com/supchaser/test_task/internal/utils/validate"
 	"go.uber.org/zap"
 )
 
 type TaskUsecase struct {
 	taskRepository app.TaskRepository
+	// storagePath holds downloads and archives being built; finished
+	// archives go to store.
 	storagePath    string
+	store          app.ArchiveStore
+	autoFinalize   int
+	idleTTL        time.Duration
+	retention      time.Duration
+	downloads      *downloadLimiter
+	retryPolicy    retry.Policy
+	fetcher        app.Fetcher
+	filePolicy     validate.Policy
+	maxObjectSize  int64
+	maxArchiveSize int64
+	report         bool
+	// compression and compressionLevel apply to tasks that set none.
+	compression      archive.Compression
+	compressionLevel int
+	jobs             *jobRunner
 }
 
-func CreateTaskUsecase(taskRepository app.TaskRepository, storagePath string) *TaskUsecase {
+type Option func(*TaskUsecase)
+
+// WithAutoFinalize sets the number of objects after which archiving starts
+// on its own. Zero disables auto-finalization, so tasks are only archived
+// through FinalizeTask.
+func WithAutoFinalize(objects int) Option {
+	return func(u *TaskUsecase) {
+		u.autoFinalize = objects
+	}
+}
+
+// WithRetryPolicy sets how object downloads retry transient failures.
+func WithRetryPolicy(policy retry.Policy) Option {
+	return func(u *TaskUsecase) {
+		u.retryPolicy = policy
+	}
+}
+
+// WithFilePolicy sets the file types a downloaded object may have.
+func WithFilePolicy(policy validate.Policy) Option {
+	return func(u *TaskUsecase) {
+		u.filePolicy = policy
+	}
+}
+
+// WithFetcher sets the HTTP client used to download objects.
+func WithFetcher(f app.Fetcher) Option {
+	return func(u *TaskUsecase) {
+		u.fetcher = f
+	}
+}
+
+func CreateTaskUsecase(taskRepository app.TaskRepository, storagePath string, opts ...Option) *TaskUsecase {
 	if storagePath == "" {
 		storagePath = "./storage"
 	}
-	return &TaskUsecase{
+	u := &TaskUsecase{
 		taskRepository: taskRepository,
 		storagePath:    storagePath,
+		autoFinalize:   validate.DefaultMaxObjectsPerTask,
+		downloads:      newDownloadLimiter(defaultMaxDownloads, defaultMaxDownloadsPerHost),
+		retryPolicy:    retry.DefaultPolicy(),
+		fetcher:        fetcher.Default(),
+		filePolicy:     validate.DefaultPolicy(),
+
+		compression:      archive.CompressionDeflate,
+		compressionLevel: archive.DefaultLevel,
+		jobs:             newJobRunner(),
+	}
+
+	for _, opt := range opts {
+		opt(u)
+	}
+	if u.store == nil {
+		u.store = storage.NewLocal(storagePath)
 	}
+
+	return u
 }
 
-func (u *TaskUsecase) CreateTask(ctx context.Context) (*models.Task, error) {
+// CreateTask creates a task whose archive will be built with the given
+// options; an empty format means zip.
+func (u *TaskUsecase) CreateTask(ctx context.Context, opts models.TaskOptions) (*models.Task, error) {
 	const funcName = "TaskUsecase.CreateTask"
 	logger.Debug("creating new task",
 		zap.String("function", funcName),
+		zap.String("format", opts.Format),
+		zap.Bool("encrypted", opts.Password != ""),
 	)
 
-	task, err := u.taskRepository.CreateTask(ctx)
+	archiveFormat, err := archive.ParseFormat(opts.Format)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errs.ErrInvalidFormat, err)
+	}
+	if opts.Password != "" && archiveFormat != archive.FormatZip {
+		return nil, fmt.Errorf("%w: format is %s", errs.ErrEncryptionFormat, archiveFormat)
+	}
+	opts.Format = string(archiveFormat)
+
+	if err := normalizeCompression(&opts); err != nil {
+		return nil, err
+	}
+
+	task, err := u.taskRepository.CreateTask(ctx, opts)
 	if err != nil {
 		logger.Error("failed to create task",
 			zap.String("function", funcName),
@@ -68,7 +156,7 @@ func (u *TaskUsecase) GetTask(ctx context.Context, id int64) (*models.Task, erro
 	return task, nil
 }
 
-func (u *TaskUsecase) AddObject(ctx context.Context, taskID int64, url string) (*models.Task, error) {
+func (u *TaskUsecase) AddObject(ctx context.Context, taskID int64, url, name string) (*models.Task, error) {
 	const funcName = "TaskUsecase.AddObject"
 	logger.Debug("adding object to task",
 		zap.String("function", funcName),
@@ -76,7 +164,11 @@ func (u *TaskUsecase) AddObject(ctx context.Context, taskID int64, url string) (
 		zap.String("url", url),
 	)
 
-	task, err := u.taskRepository.AddObject(ctx, taskID, url)
+	if u.Draining() {
+		return nil, errs.ErrShuttingDown
+	}
+
+	task, err := u.taskRepository.AddObject(ctx, taskID, url, name)
 	if err != nil {
 		logger.Error("failed to add object",
 			zap.String("function", funcName),
@@ -87,13 +179,198 @@ func (u *TaskUsecase) AddObject(ctx context.Context, taskID int64, url string) (
 		return nil, err
 	}
 
-	if len(task.Objects) == 3 {
-		go u.ProcessTask(ctx, task.ID)
+	if u.readyForArchive(task) {
+		if err := u.startArchive(ctx, "process", task.ID); err != nil {
+			logger.Warn("archive job not started",
+				zap.String("function", funcName),
+				zap.Int64("task_id", task.ID),
+				zap.Error(err),
+			)
+		} else {
+			task.Status = models.StatusProcessing
+		}
 	}
 
 	return task, nil
 }
 
+// FinalizeTask starts archiving with whatever objects the task has right now.
+// A non-empty password replaces the one given at creation.
+func (u *TaskUsecase) FinalizeTask(ctx context.Context, taskID int64, password string) (*models.Task, error) {
+	const funcName = "TaskUsecase.FinalizeTask"
+	logger.Debug("finalizing task",
+		zap.String("function", funcName),
+		zap.Int64("task_id", taskID),
+	)
+
+	if u.Draining() {
+		return nil, errs.ErrShuttingDown
+	}
+
+	task, err := u.taskRepository.GetTask(ctx, taskID)
+	if err != nil {
+		logger.Error("failed to get task",
+			zap.String("function", funcName),
+			zap.Int64("task_id", taskID),
+			zap.Error(err),
+		)
+		return nil, err
+	}
+
+	if task.Status != models.StatusWaiting {
+		logger.Warn("task cannot be finalized",
+			zap.String("function", funcName),
+			zap.Int64("task_id", taskID),
+			zap.String("status", string(task.Status)),
+		)
+		return nil, fmt.Errorf("%w: task is %s", errs.ErrInvalidTaskStatus, task.Status)
+	}
+
+	if len(task.Objects) == 0 {
+		logger.Warn("task has no objects to archive",
+			zap.String("function", funcName),
+			zap.Int64("task_id", taskID),
+		)
+		return nil, errs.ErrNoObjects
+	}
+
+	if password != "" {
+		if format := taskFormat(task.Format); format != archive.FormatZip {
+			return nil, fmt.Errorf("%w: format is %s", errs.ErrEncryptionFormat, format)
+		}
+		if err := u.taskRepository.SetTaskPassword(ctx, taskID, password); err != nil {
+			logger.Error("failed to set task password",
+				zap.String("function", funcName),
+				zap.Int64("task_id", taskID),
+				zap.Error(err),
+			)
+			return nil, err
+		}
+		task.Encrypted = true
+	}
+
+	if err := u.startArchive(ctx, "build", taskID); err != nil {
+		logger.Error("failed to start archive job",
+			zap.String("function", funcName),
+			zap.Int64("task_id", taskID),
+			zap.Error(err),
+		)
+		return nil, err
+	}
+
+	task.Status = models.StatusProcessing
+	return task, nil
+}
+
+// startArchive moves the task to processing and starts the job building its
+// archive. The status changes before the job starts, so of two concurrent
+// callers only one gets past the update and the task never gets a second job.
+func (u *TaskUsecase) startArchive(ctx context.Context, name string, taskID int64) error {
+	if err := u.taskRepository.UpdateTaskStatus(ctx, taskID, models.StatusProcessing); err != nil {
+		return err
+	}
+
+	if err := u.jobs.start(ctx, name, taskID, u.buildArchive); err != nil {
+		// shutdown began in the meantime; the task is resumed on the next start
+		u.taskRepository.UpdateTaskStatus(context.WithoutCancel(ctx), taskID, models.StatusInterrupted)
+		return err
+	}
+
+	return nil
+}
+
+// taskFormat returns the archive format of a task. Tasks created before
+// formats were introduced have none stored and are zip.
+func taskFormat(format string) archive.Format {
+	f, err := archive.ParseFormat(format)
+	if err != nil {
+		return archive.FormatZip
+	}
+	return f
+}
+
+func (u *TaskUsecase) readyForArchive(task *models.Task) bool {
+	return task.Status == models.StatusWaiting &&
+		u.autoFinalize > 0 &&
+		len(task.Objects) >= u.autoFinalize
+}
+
+// HandlePromotedTask is called by the repository when a queued task gets an
+// active slot. Objects may have been added while the task was queued, so it
+// can already be complete.
+func (u *TaskUsecase) HandlePromotedTask(taskID int64) {
+	const funcName = "TaskUsecase.HandlePromotedTask"
+	ctx := context.Background()
+
+	task, err := u.taskRepository.GetTask(ctx, taskID)
+	if err != nil {
+		logger.Error("failed to get promoted task",
+			zap.String("function", funcName),
+			zap.Int64("task_id", taskID),
+			zap.Error(err),
+		)
+		return
+	}
+
+	if u.readyForArchive(task) {
+		if err := u.startArchive(ctx, "process", taskID); err != nil {
+			logger.Warn("archive job not started",
+				zap.String("function", funcName),
+				zap.Int64("task_id", taskID),
+				zap.Error(err),
+			)
+		}
+	}
+}
+
+// ResumeTasks restarts archiving for restored tasks that already have all
+// of their objects but never got a finished archive, and for tasks
+// interrupted by the last shutdown.
+func (u *TaskUsecase) ResumeTasks(ctx context.Context) error {
+	const funcName = "TaskUsecase.ResumeTasks"
+	logger.Debug("resuming tasks",
+		zap.String("function", funcName),
+	)
+
+	tasks, err := u.taskRepository.GetAllTasks(ctx)
+	if err != nil {
+		logger.Error("failed to get tasks for resume",
+			zap.String("function", funcName),
+			zap.Error(err),
+		)
+		return err
+	}
+
+	resumed := 0
+	for _, task := range tasks {
+		if !u.readyForArchive(task) && task.Status != models.StatusInterrupted {
+			continue
+		}
+
+		if err := u.startArchive(ctx, "process", task.ID); err != nil {
+			if errors.Is(err, errs.ErrShuttingDown) {
+				return err
+			}
+			logger.Warn("task not resumed",
+				zap.String("function", funcName),
+				zap.Int64("task_id", task.ID),
+				zap.Error(err),
+			)
+			continue
+		}
+		resumed++
+	}
+
+	logger.Info("tasks resumed",
+		zap.String("function", funcName),
+		zap.Int("resumed", resumed),
+	)
+
+	return nil
+}
+
+// ProcessTask moves a waiting task to processing and builds its archive in
+// the calling goroutine. Background jobs are started through startArchive.
 func (u *TaskUsecase) ProcessTask(ctx context.Context, taskID int64) {
 	const funcName = "TaskUsecase.processTask"
 	logger.Info("starting task processing",
@@ -110,6 +387,14 @@ func (u *TaskUsecase) ProcessTask(ctx context.Context, taskID int64) {
 		return
 	}
 
+	u.buildArchive(ctx, taskID)
+}
+
+// buildArchive downloads the objects of a task that is already in processing
+// status and packs them into the archive.
+func (u *TaskUsecase) buildArchive(ctx context.Context, taskID int64) {
+	const funcName = "TaskUsecase.buildArchive"
+
 	task, err := u.taskRepository.GetTask(ctx, taskID)
 	if err != nil {
 		logger.Error("failed to get task for processing",
@@ -120,82 +405,200 @@ func (u *TaskUsecase) ProcessTask(ctx context.Context, taskID int64) {
 		return
 	}
 
-	zipPath := filepath.Join(u.storagePath, fmt.Sprintf("task_%d.zip", taskID))
-	zipFile, err := os.Create(zipPath)
+	format := taskFormat(task.Format)
+	key := archiveKey(taskID, task.Format, archiveVersion(task))
+	// the archive is built locally and handed to the store once complete
+	outFile, err := os.CreateTemp(u.storagePath, ".archive-*")
 	if err != nil {
-		logger.Error("failed to create zip file",
+		logger.Error("failed to create archive file",
 			zap.String("function", funcName),
 			zap.Int64("task_id", taskID),
-			zap.String("zip_path", zipPath),
+			zap.String("storage_path", u.storagePath),
 			zap.Error(err),
 		)
 		u.taskRepository.UpdateTaskStatus(ctx, taskID, models.StatusFailed)
 		return
 	}
-	defer zipFile.Close()
+	defer func() {
+		outFile.Close()
+		os.Remove(outFile.Name())
+	}()
 
-	zipWriter := zip.NewWriter(zipFile)
-	defer zipWriter.Close()
+	archiveWriter, err := archive.NewWriter(format, outFile, u.writerOptions(task)...)
+	if err != nil {
+		logger.Error("failed to create archive writer",
+			zap.String("function", funcName),
+			zap.Int64("task_id", taskID),
+			zap.String("format", string(format)),
+			zap.Error(err),
+		)
+		u.taskRepository.UpdateTaskStatus(ctx, taskID, models.StatusFailed)
+		return
+	}
 
+	namer := newEntryNamer(u.filePolicy)
+	budget := newArchiveBudget(u.maxArchiveSize)
 	successCount := 0
+	var contentSize int64
+
+	// a retry takes over what the previous version already has
+	kept, err := u.copyPrevious(ctx, task, archiveWriter)
+	if err != nil {
+		logger.Error("failed to copy previous archive",
+			zap.String("function", funcName),
+			zap.Int64("task_id", taskID),
+			zap.Error(err),
+		)
+		u.taskRepository.UpdateTaskStatus(ctx, taskID, models.StatusFailed)
+		return
+	}
+	pending := make([]*models.Object, 0, len(task.Objects))
 	for _, obj := range task.Objects {
-		resp, err := http.Get(obj.URL)
-		if err != nil {
-			logger.Warn("failed to download file",
-				zap.String("function", funcName),
-				zap.Int64("task_id", taskID),
-				zap.String("url", obj.URL),
-				zap.Error(err),
-			)
+		if !kept[obj] {
+			pending = append(pending, obj)
 			continue
 		}
-		defer resp.Body.Close()
+		namer.reserve(obj.ArchiveName)
+		budget.reserve(obj.Size)
+		successCount++
+		contentSize += obj.Size
+	}
 
-		if resp.StatusCode != http.StatusOK {
-			logger.Warn("invalid response status",
-				zap.String("function", funcName),
-				zap.Int64("task_id", taskID),
-				zap.String("url", obj.URL),
-				zap.Int("status_code", resp.StatusCode),
-			)
+	results := u.downloadAll(ctx, taskID, pending, budget)
+	defer func() {
+		for _, res := range results {
+			if res.path != "" {
+				os.Remove(res.path)
+			}
+		}
+	}()
+
+	for i, obj := range pending {
+		if ctx.Err() != nil {
+			u.abortJob(ctx, funcName, taskID)
+			return
+		}
+		if results[i].err != nil {
 			continue
 		}
 
-		fileName := filepath.Base(obj.URL)
-		fileWriter, err := zipWriter.Create(fileName)
-		if err != nil {
-			logger.Warn("failed to create file in archive",
+		fileName := namer.name(obj, results[i].remoteName)
+		if err := addFileToArchive(archiveWriter, fileName, obj.ContentType, results[i].path); err != nil {
+			logger.Warn("failed to write file to archive",
 				zap.String("function", funcName),
 				zap.Int64("task_id", taskID),
 				zap.String("file_name", fileName),
 				zap.Error(err),
 			)
+			obj.State = models.ObjectFailed
+			obj.Error = err.Error()
+			u.saveObject(ctx, taskID, obj)
 			continue
 		}
 
-		if _, err := io.Copy(fileWriter, resp.Body); err != nil {
-			logger.Warn("failed to write file to archive",
+		obj.State = models.ObjectArchived
+		obj.ArchiveName = fileName
+		u.saveObject(ctx, taskID, obj)
+		successCount++
+		contentSize += obj.Size
+	}
+
+	if successCount > 0 {
+		manifest := buildManifest(task)
+		if err := writeManifest(archiveWriter, manifest); err != nil {
+			logger.Warn("failed to write manifest",
 				zap.String("function", funcName),
 				zap.Int64("task_id", taskID),
-				zap.String("file_name", fileName),
 				zap.Error(err),
 			)
-			continue
 		}
-
-		successCount++
+		if u.report {
+			if err := writeReport(archiveWriter, manifest); err != nil {
+				logger.Warn("failed to write report",
+					zap.String("function", funcName),
+					zap.Int64("task_id", taskID),
+					zap.Error(err),
+				)
+			}
+		}
 	}
 
+	closeErr := archiveWriter.Close()
+
 	if successCount == 0 {
 		logger.Error("no files were added to archive",
 			zap.String("function", funcName),
 			zap.Int64("task_id", taskID),
 		)
 		u.taskRepository.UpdateTaskStatus(ctx, taskID, models.StatusFailed)
-		os.Remove(zipPath)
 		return
 	}
 
+	if closeErr != nil {
+		logger.Error("failed to finish archive",
+			zap.String("function", funcName),
+			zap.Int64("task_id", taskID),
+			zap.Error(closeErr),
+		)
+		u.taskRepository.UpdateTaskStatus(ctx, taskID, models.StatusFailed)
+		return
+	}
+
+	// a job cancelled while packing must not leave a stored archive behind
+	if ctx.Err() != nil {
+		u.abortJob(ctx, funcName, taskID)
+		return
+	}
+	if u.taskCancelled(ctx, taskID) {
+		logger.Info("task was cancelled, archive is not stored",
+			zap.String("function", funcName),
+			zap.Int64("task_id", taskID),
+		)
+		return
+	}
+
+	archiveSize, err := u.storeArchive(ctx, key, outFile)
+	if err != nil && ctx.Err() != nil {
+		u.abortJob(ctx, funcName, taskID)
+		return
+	}
+	if err != nil {
+		logger.Error("failed to store archive",
+			zap.String("function", funcName),
+			zap.Int64("task_id", taskID),
+			zap.String("archive_key", key),
+			zap.Error(err),
+		)
+		u.taskRepository.UpdateTaskStatus(ctx, taskID, models.StatusFailed)
+		return
+	}
+	// cancelled while the archive was uploaded
+	if u.taskCancelled(ctx, taskID) {
+		logger.Info("task was cancelled, removing stored archive",
+			zap.String("function", funcName),
+			zap.Int64("task_id", taskID),
+			zap.String("archive_key", key),
+		)
+		if err := u.store.Delete(context.WithoutCancel(ctx), key); err != nil {
+			logger.Warn("failed to remove archive of cancelled task",
+				zap.String("function", funcName),
+				zap.Int64("task_id", taskID),
+				zap.String("archive_key", key),
+				zap.Error(err),
+			)
+		}
+		return
+	}
+
+	stats := archiveStats(contentSize, archiveSize)
+	if err := u.taskRepository.SetArchiveStats(ctx, taskID, stats); err != nil {
+		logger.Warn("failed to save archive stats",
+			zap.String("function", funcName),
+			zap.Int64("task_id", taskID),
+			zap.Error(err),
+		)
+	}
+
 	if err := u.taskRepository.UpdateTaskStatus(ctx, taskID, models.StatusDone); err != nil {
 		logger.Error("failed to update task status",
 			zap.String("function", funcName),
@@ -210,10 +613,64 @@ func (u *TaskUsecase) ProcessTask(ctx context.Context, taskID int64) {
 		zap.Int64("task_id", taskID),
 		zap.Int("files_processed", successCount),
 		zap.Int("total_files", len(task.Objects)),
-		zap.String("zip_path", zipPath),
+		zap.Int("kept_files", len(kept)),
+		zap.String("archive_key", key),
 	)
 }
 
+// abortJob marks the task of a cancelled job as interrupted when the job was
+// stopped by Shutdown and as failed otherwise, for example on timeout. The
+// status is saved even though ctx is already done. A task cancelled through
+// CancelTask already has its final status.
+func (u *TaskUsecase) abortJob(ctx context.Context, funcName string, taskID int64) {
+	status := models.StatusFailed
+	switch cause := context.Cause(ctx); {
+	case errors.Is(cause, errTaskCancelled):
+		logger.Info("task processing cancelled by request",
+			zap.String("function", funcName),
+			zap.Int64("task_id", taskID),
+			logger.RequestIDField(ctx),
+		)
+		return
+	case errors.Is(cause, errs.ErrShuttingDown):
+		status = models.StatusInterrupted
+	}
+
+	logger.Warn("task processing cancelled",
+		zap.String("function", funcName),
+		zap.Int64("task_id", taskID),
+		zap.String("status", string(status)),
+		logger.RequestIDField(ctx),
+		zap.Error(context.Cause(ctx)),
+	)
+	u.taskRepository.UpdateTaskStatus(context.WithoutCancel(ctx), taskID, status)
+}
+
+func addFileToArchive(w archive.Writer, name, contentType, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open downloaded file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("stat downloaded file: %w", err)
+	}
+
+	entry := archive.Entry{
+		Name:        name,
+		Size:        info.Size(),
+		ModTime:     time.Now(),
+		ContentType: contentType,
+	}
+	if err := w.AddFile(entry, file); err != nil {
+		return fmt.Errorf("add file to archive: %w", err)
+	}
+
+	return nil
+}
+
 func (u *TaskUsecase) GetTaskStatus(ctx context.Context, id int64) (*models.Task, error) {
 	const funcName = "TaskUsecase.GetTaskStatus"
 	logger.Debug("getting task status",
@@ -256,6 +713,22 @@ func (u *TaskUsecase) GetMaxTasks() int {
 	return u.taskRepository.GetMaxTasks()
 }
 
+func (u *TaskUsecase) GetMaxObjectsPerTask() int {
+	return u.taskRepository.GetMaxObjects()
+}
+
+func (u *TaskUsecase) GetFilePolicy() validate.Policy {
+	return u.filePolicy
+}
+
 func (u *TaskUsecase) GetActiveTasksCount() int {
 	return u.taskRepository.GetActiveTasksCount()
 }
+
+func (u *TaskUsecase) GetQueuedTasksCount() int {
+	return u.taskRepository.GetQueuedTasksCount()
+}
+
+func (u *TaskUsecase) EstimateRetryAfter() time.Duration {
+	return u.taskRepository.EstimateRetryAfter()
+}
@@ -13,6 +13,7 @@ import (
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	mock_app "github.com/supchaser/test_task/internal/app/mocks"
 	"github.com/supchaser/test_task/internal/app/models"
 	"github.com/supchaser/test_task/internal/utils/errs"
@@ -30,6 +31,7 @@ func TestTaskUsecase_CreateTask(t *testing.T) {
 
 	tests := []struct {
 		name          string
+		opts          models.TaskOptions
 		mockSetup     func(*mock_app.MockTaskRepository)
 		expectedTask  *models.Task
 		expectedError error
@@ -38,7 +40,7 @@ func TestTaskUsecase_CreateTask(t *testing.T) {
 			name: "Success",
 			mockSetup: func(mockRepo *mock_app.MockTaskRepository) {
 				mockRepo.EXPECT().
-					CreateTask(gomock.Any()).
+					CreateTask(gomock.Any(), models.TaskOptions{Format: "zip"}).
 					Return(&models.Task{
 						ID:        1,
 						Status:    models.StatusWaiting,
@@ -55,12 +57,59 @@ func TestTaskUsecase_CreateTask(t *testing.T) {
 			name: "MaxTasksReached",
 			mockSetup: func(mockRepo *mock_app.MockTaskRepository) {
 				mockRepo.EXPECT().
-					CreateTask(gomock.Any()).
+					CreateTask(gomock.Any(), gomock.Any()).
 					Return(nil, errs.ErrMaxTasksReached)
 			},
 			expectedTask:  nil,
 			expectedError: errs.ErrMaxTasksReached,
 		},
+		{
+			name: "TarGzAlias",
+			opts: models.TaskOptions{Format: "tgz"},
+			mockSetup: func(mockRepo *mock_app.MockTaskRepository) {
+				mockRepo.EXPECT().
+					CreateTask(gomock.Any(), models.TaskOptions{Format: "tar.gz"}).
+					Return(&models.Task{
+						ID:        2,
+						Status:    models.StatusWaiting,
+						Format:    "tar.gz",
+						CreatedAt: time.Now(),
+					}, nil)
+			},
+			expectedTask: &models.Task{
+				ID:     2,
+				Status: models.StatusWaiting,
+			},
+		},
+		{
+			name:          "InvalidFormat",
+			opts:          models.TaskOptions{Format: "rar"},
+			expectedError: errs.ErrInvalidFormat,
+		},
+		{
+			name: "Encrypted",
+			opts: models.TaskOptions{Password: "secret"},
+			mockSetup: func(mockRepo *mock_app.MockTaskRepository) {
+				mockRepo.EXPECT().
+					CreateTask(gomock.Any(), models.TaskOptions{Format: "zip", Password: "secret"}).
+					Return(&models.Task{
+						ID:        3,
+						Status:    models.StatusWaiting,
+						Format:    "zip",
+						Encrypted: true,
+						CreatedAt: time.Now(),
+					}, nil)
+			},
+			expectedTask: &models.Task{
+				ID:     3,
+				Status: models.StatusWaiting,
+			},
+		},
+		{
+			name:          "PasswordWithTar",
+			opts:          models.TaskOptions{Format: "tar.gz", Password: "secret"},
+			expectedError: errs.ErrEncryptionFormat,
+		},
 	}
 
 	for _, tt := range tests {
@@ -71,7 +120,7 @@ func TestTaskUsecase_CreateTask(t *testing.T) {
 			}
 
 			uc := CreateTaskUsecase(mockRepo, "")
-			result, err := uc.CreateTask(context.Background())
+			result, err := uc.CreateTask(context.Background(), tt.opts)
 
 			if tt.expectedError != nil {
 				assert.Error(t, err)
@@ -170,7 +219,7 @@ func TestTaskUsecase_AddObject(t *testing.T) {
 			url:    validURL,
 			mockSetup: func(mockRepo *mock_app.MockTaskRepository) {
 				mockRepo.EXPECT().
-					AddObject(gomock.Any(), int64(1), validURL).
+					AddObject(gomock.Any(), int64(1), validURL, "").
 					Return(&models.Task{
 						ID:     1,
 						Status: models.StatusWaiting,
@@ -194,7 +243,7 @@ func TestTaskUsecase_AddObject(t *testing.T) {
 			url:    validURL,
 			mockSetup: func(mockRepo *mock_app.MockTaskRepository) {
 				mockRepo.EXPECT().
-					AddObject(gomock.Any(), int64(2), validURL).
+					AddObject(gomock.Any(), int64(2), validURL, "").
 					Return(nil, errs.ErrTaskNotFound)
 			},
 			expectedTask:  nil,
@@ -206,7 +255,7 @@ func TestTaskUsecase_AddObject(t *testing.T) {
 			url:    invalidURL,
 			mockSetup: func(mockRepo *mock_app.MockTaskRepository) {
 				mockRepo.EXPECT().
-					AddObject(gomock.Any(), int64(1), invalidURL).
+					AddObject(gomock.Any(), int64(1), invalidURL, "").
 					Return(nil, errs.ErrInvalidFileType)
 			},
 			expectedTask:  nil,
@@ -222,7 +271,7 @@ func TestTaskUsecase_AddObject(t *testing.T) {
 			}
 
 			uc := CreateTaskUsecase(mockRepo, "")
-			result, err := uc.AddObject(context.Background(), tt.taskID, tt.url)
+			result, err := uc.AddObject(context.Background(), tt.taskID, tt.url, "")
 
 			if tt.expectedError != nil {
 				assert.Error(t, err)
@@ -239,6 +288,191 @@ func TestTaskUsecase_AddObject(t *testing.T) {
 	}
 }
 
+func TestTaskUsecase_FinalizeTask(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tests := []struct {
+		name          string
+		taskID        int64
+		password      string
+		mockSetup     func(*mock_app.MockTaskRepository)
+		expectedError error
+	}{
+		{
+			name:   "TaskNotFound",
+			taskID: 1,
+			mockSetup: func(mockRepo *mock_app.MockTaskRepository) {
+				mockRepo.EXPECT().
+					GetTask(gomock.Any(), int64(1)).
+					Return(nil, errs.ErrTaskNotFound)
+			},
+			expectedError: errs.ErrTaskNotFound,
+		},
+		{
+			name:   "NoObjects",
+			taskID: 1,
+			mockSetup: func(mockRepo *mock_app.MockTaskRepository) {
+				mockRepo.EXPECT().
+					GetTask(gomock.Any(), int64(1)).
+					Return(&models.Task{ID: 1, Status: models.StatusWaiting}, nil)
+			},
+			expectedError: errs.ErrNoObjects,
+		},
+		{
+			name:   "AlreadyDone",
+			taskID: 1,
+			mockSetup: func(mockRepo *mock_app.MockTaskRepository) {
+				mockRepo.EXPECT().
+					GetTask(gomock.Any(), int64(1)).
+					Return(&models.Task{
+						ID:      1,
+						Status:  models.StatusDone,
+						Objects: []*models.Object{{URL: "http://example.com/a.pdf"}},
+					}, nil)
+			},
+			expectedError: errs.ErrInvalidTaskStatus,
+		},
+		{
+			name:   "StatusUpdateRejected",
+			taskID: 1,
+			mockSetup: func(mockRepo *mock_app.MockTaskRepository) {
+				mockRepo.EXPECT().
+					GetTask(gomock.Any(), int64(1)).
+					Return(&models.Task{
+						ID:      1,
+						Status:  models.StatusWaiting,
+						Objects: []*models.Object{{URL: "http://example.com/a.pdf"}},
+					}, nil)
+				mockRepo.EXPECT().
+					UpdateTaskStatus(gomock.Any(), int64(1), models.StatusProcessing).
+					Return(errs.ErrInvalidTaskStatus)
+			},
+			expectedError: errs.ErrInvalidTaskStatus,
+		},
+		{
+			name:     "PasswordOnTarTask",
+			taskID:   1,
+			password: "secret",
+			mockSetup: func(mockRepo *mock_app.MockTaskRepository) {
+				mockRepo.EXPECT().
+					GetTask(gomock.Any(), int64(1)).
+					Return(&models.Task{
+						ID:      1,
+						Status:  models.StatusWaiting,
+						Format:  "tar",
+						Objects: []*models.Object{{URL: "http://example.com/a.pdf"}},
+					}, nil)
+			},
+			expectedError: errs.ErrEncryptionFormat,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := mock_app.NewMockTaskRepository(ctrl)
+			tt.mockSetup(mockRepo)
+
+			uc := CreateTaskUsecase(mockRepo, "")
+			result, err := uc.FinalizeTask(context.Background(), tt.taskID, tt.password)
+
+			assert.Nil(t, result)
+			assert.ErrorIs(t, err, tt.expectedError)
+		})
+	}
+}
+
+func TestTaskUsecase_FinalizeTask_SingleObject(t *testing.T) {
+	tempDir := t.TempDir()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("%PDF-1.4 test file content"))
+	}))
+	defer testServer.Close()
+
+	task := &models.Task{
+		ID:      7,
+		Status:  models.StatusWaiting,
+		Objects: []*models.Object{{URL: testServer.URL + "/only.pdf"}},
+	}
+
+	done := make(chan struct{})
+	mockRepo := mock_app.NewMockTaskRepository(ctrl)
+	mockRepo.EXPECT().GetTask(gomock.Any(), int64(7)).Return(task.Clone(), nil)
+	mockRepo.EXPECT().UpdateTaskStatus(gomock.Any(), int64(7), models.StatusProcessing).Return(nil)
+	mockRepo.EXPECT().GetTask(gomock.Any(), int64(7)).Return(task.Clone(), nil).AnyTimes()
+	mockRepo.EXPECT().UpdateObject(gomock.Any(), int64(7), gomock.Any()).Return(nil).AnyTimes()
+	mockRepo.EXPECT().SetArchiveStats(gomock.Any(), int64(7), gomock.Any()).Return(nil)
+	mockRepo.EXPECT().
+		UpdateTaskStatus(gomock.Any(), int64(7), models.StatusDone).
+		DoAndReturn(func(context.Context, int64, models.TaskStatus) error {
+			close(done)
+			return nil
+		})
+
+	uc := CreateTaskUsecase(mockRepo, tempDir)
+	result, err := uc.FinalizeTask(context.Background(), 7, "")
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.StatusProcessing, result.Status)
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("archive was not built")
+	}
+}
+
+func TestTaskUsecase_AutoFinalize(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mock_app.NewMockTaskRepository(ctrl)
+	mockRepo.EXPECT().
+		AddObject(gomock.Any(), int64(1), "http://example.com/c.pdf", "").
+		Return(&models.Task{
+			ID:      1,
+			Status:  models.StatusWaiting,
+			Objects: []*models.Object{{}, {}, {}},
+		}, nil)
+
+	// with auto-finalization disabled a third object must not start processing
+	uc := CreateTaskUsecase(mockRepo, "", WithAutoFinalize(0))
+	result, err := uc.AddObject(context.Background(), 1, "http://example.com/c.pdf", "")
+
+	assert.NoError(t, err)
+	assert.Len(t, result.Objects, 3)
+}
+
+func TestTaskUsecase_AutoFinalize_AlreadyProcessing(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mock_app.NewMockTaskRepository(ctrl)
+	mockRepo.EXPECT().
+		AddObject(gomock.Any(), int64(1), "http://example.com/c.pdf", "").
+		Return(&models.Task{
+			ID:      1,
+			Status:  models.StatusWaiting,
+			Objects: []*models.Object{{}, {}, {}},
+		}, nil)
+	// another request moved the task to processing first: no second job may
+	// start, so nothing but the status update is expected
+	mockRepo.EXPECT().
+		UpdateTaskStatus(gomock.Any(), int64(1), models.StatusProcessing).
+		Return(errs.ErrInvalidTaskStatus)
+
+	uc := CreateTaskUsecase(mockRepo, t.TempDir(), WithAutoFinalize(3))
+	result, err := uc.AddObject(context.Background(), 1, "http://example.com/c.pdf", "")
+
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusWaiting, result.Status)
+	require.NoError(t, uc.Shutdown(context.Background()))
+}
+
 func TestTaskUsecase_GetTaskStatus(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -383,7 +617,7 @@ func TestTaskUsecase_processTask(t *testing.T) {
 
 	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("test file content"))
+		w.Write([]byte("%PDF-1.4 test file content"))
 	}))
 	defer testServer.Close()
 
@@ -418,7 +652,11 @@ func TestTaskUsecase_processTask(t *testing.T) {
 							{URL: testServer.URL + "/image1.jpg"},
 							{URL: testServer.URL + "/image2.jpg"},
 						},
-					}, nil)
+					}, nil).AnyTimes()
+
+				mockRepo.EXPECT().
+					SetArchiveStats(gomock.Any(), int64(1), gomock.Any()).
+					Return(nil)
 
 				mockRepo.EXPECT().
 					UpdateTaskStatus(gomock.Any(), int64(1), models.StatusDone).
@@ -447,7 +685,7 @@ func TestTaskUsecase_processTask(t *testing.T) {
 						Objects: []*models.Object{
 							{URL: testServer.URL + "/image1.jpg"},
 						},
-					}, nil)
+					}, nil).AnyTimes()
 
 				mockRepo.EXPECT().
 					UpdateTaskStatus(gomock.Any(), int64(2), models.StatusFailed).
@@ -476,7 +714,7 @@ func TestTaskUsecase_processTask(t *testing.T) {
 						Objects: []*models.Object{
 							{URL: "http://invalid.url/bad.docx"},
 						},
-					}, nil)
+					}, nil).AnyTimes()
 
 				mockRepo.EXPECT().
 					UpdateTaskStatus(gomock.Any(), int64(3), models.StatusFailed).
@@ -505,7 +743,11 @@ func TestTaskUsecase_processTask(t *testing.T) {
 						Objects: []*models.Object{
 							{URL: testServer.URL + "/document.pdf"},
 						},
-					}, nil)
+					}, nil).AnyTimes()
+
+				mockRepo.EXPECT().
+					SetArchiveStats(gomock.Any(), int64(4), gomock.Any()).
+					Return(nil)
 
 				mockRepo.EXPECT().
 					UpdateTaskStatus(gomock.Any(), int64(4), models.StatusDone).
@@ -524,6 +766,11 @@ func TestTaskUsecase_processTask(t *testing.T) {
 				tt.mockSetup(mockRepo)
 			}
 
+			mockRepo.EXPECT().
+				UpdateObject(gomock.Any(), tt.taskID, gomock.Any()).
+				Return(nil).
+				AnyTimes()
+
 			uc := CreateTaskUsecase(mockRepo, tt.storagePath)
 			uc.ProcessTask(context.Background(), tt.taskID)
 			zipPath := filepath.Join(tt.storagePath, fmt.Sprintf("task_%d.zip", tt.taskID))
@@ -540,6 +787,52 @@ func TestTaskUsecase_processTask(t *testing.T) {
 	}
 }
 
+func TestTaskUsecase_ResumeTasks(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tests := []struct {
+		name          string
+		mockSetup     func(*mock_app.MockTaskRepository)
+		expectedError error
+	}{
+		{
+			name: "NothingToResume",
+			mockSetup: func(mockRepo *mock_app.MockTaskRepository) {
+				mockRepo.EXPECT().
+					GetAllTasks(gomock.Any()).
+					Return([]*models.Task{
+						{ID: 1, Status: models.StatusWaiting, Objects: []*models.Object{{URL: "http://example.com/a.pdf"}}},
+						{ID: 2, Status: models.StatusDone, Objects: []*models.Object{{}, {}, {}}},
+						{ID: 3, Status: models.StatusFailed, Objects: []*models.Object{{}, {}, {}}},
+					}, nil)
+			},
+			expectedError: nil,
+		},
+		{
+			name: "RepositoryError",
+			mockSetup: func(mockRepo *mock_app.MockTaskRepository) {
+				mockRepo.EXPECT().
+					GetAllTasks(gomock.Any()).
+					Return(nil, assert.AnError)
+			},
+			expectedError: assert.AnError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := mock_app.NewMockTaskRepository(ctrl)
+			tt.mockSetup(mockRepo)
+
+			uc := CreateTaskUsecase(mockRepo, "")
+			err := uc.ResumeTasks(context.Background())
+
+			assert.ErrorIs(t, err, tt.expectedError)
+		})
+	}
+}
+
 func TestTaskUsecase_GetMaxTasks(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -554,6 +847,19 @@ func TestTaskUsecase_GetMaxTasks(t *testing.T) {
 	assert.Equal(t, expectedMax, result)
 }
 
+func TestTaskUsecase_GetMaxObjectsPerTask(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mock_app.NewMockTaskRepository(ctrl)
+	mockRepo.EXPECT().GetMaxObjects().Return(10)
+
+	uc := CreateTaskUsecase(mockRepo, "")
+	result := uc.GetMaxObjectsPerTask()
+
+	assert.Equal(t, 10, result)
+}
+
 func TestTaskUsecase_GetActiveTasksCount(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -567,3 +873,29 @@ func TestTaskUsecase_GetActiveTasksCount(t *testing.T) {
 
 	assert.Equal(t, expectedCount, result)
 }
+
+func TestTaskUsecase_GetQueuedTasksCount(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mock_app.NewMockTaskRepository(ctrl)
+	mockRepo.EXPECT().GetQueuedTasksCount().Return(2)
+
+	uc := CreateTaskUsecase(mockRepo, "")
+	result := uc.GetQueuedTasksCount()
+
+	assert.Equal(t, 2, result)
+}
+
+func TestTaskUsecase_EstimateRetryAfter(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mock_app.NewMockTaskRepository(ctrl)
+	mockRepo.EXPECT().EstimateRetryAfter().Return(20 * time.Second)
+
+	uc := CreateTaskUsecase(mockRepo, "")
+	result := uc.EstimateRetryAfter()
+
+	assert.Equal(t, 20*time.Second, result)
+}
@@ -0,0 +1,190 @@
+package archive
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// WinZip AES encryption (AE-1), see https://www.winzip.com/en/support/aes-encryption/.
+// Entries are stored with compression method 99 and an extra field naming
+// the real method; the data is salt, password verifier, the AES-CTR
+// encrypted (and possibly deflated) content and a truncated HMAC-SHA1.
+const (
+	aesMethod       uint16 = 99
+	aesExtraID      uint16 = 0x9901
+	aesVendorAE1    uint16 = 1
+	aesStrength256  byte   = 3
+	aesKeyLen              = 32
+	aesSaltLen             = 16
+	aesVerifierLen         = 2
+	aesAuthCodeLen         = 10
+	aesKDFIteration        = 1000
+)
+
+var ErrEncryptionUnsupported = errors.New("encryption is only supported for zip archives")
+
+// aesExtra returns the AES extra field announcing the real compression method.
+func aesExtra(method uint16) []byte {
+	extra := make([]byte, 11)
+	binary.LittleEndian.PutUint16(extra[0:], aesExtraID)
+	binary.LittleEndian.PutUint16(extra[2:], 7)
+	binary.LittleEndian.PutUint16(extra[4:], aesVendorAE1)
+	copy(extra[6:], "AE")
+	extra[8] = aesStrength256
+	binary.LittleEndian.PutUint16(extra[9:], method)
+	return extra
+}
+
+// deriveAESKeys returns the encryption key, the authentication key and the
+// password verifier for the given salt.
+func deriveAESKeys(password string, salt []byte) (encKey, authKey, verifier []byte, err error) {
+	key, err := pbkdf2.Key(sha1.New, password, salt, aesKDFIteration, 2*aesKeyLen+aesVerifierLen)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("derive aes key: %w", err)
+	}
+	return key[:aesKeyLen], key[aesKeyLen : 2*aesKeyLen], key[2*aesKeyLen:], nil
+}
+
+// winzipCTR is AES in counter mode as WinZip does it: a little-endian
+// block counter starting at 1, unlike the big-endian cipher.NewCTR.
+type winzipCTR struct {
+	block   cipher.Block
+	counter [aes.BlockSize]byte
+	stream  [aes.BlockSize]byte
+	pos     int
+}
+
+func newWinzipCTR(key []byte) (*winzipCTR, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return &winzipCTR{block: block, pos: aes.BlockSize}, nil
+}
+
+func (c *winzipCTR) XORKeyStream(dst, src []byte) {
+	for i := range src {
+		if c.pos == aes.BlockSize {
+			for j := range c.counter {
+				c.counter[j]++
+				if c.counter[j] != 0 {
+					break
+				}
+			}
+			c.block.Encrypt(c.stream[:], c.counter[:])
+			c.pos = 0
+		}
+		dst[i] = src[i] ^ c.stream[c.pos]
+		c.pos++
+	}
+}
+
+// aesWriter encrypts one zip entry. It is used as the zip compressor for
+// aesMethod, so archive/zip still counts sizes and the CRC of the plain data.
+type aesWriter struct {
+	w   io.Writer
+	ctr *winzipCTR
+	mac hash.Hash
+	// deflate compresses the plain data before encryption, nil for store.
+	deflate *flate.Writer
+	// prefix holds the salt and the password verifier until the first
+	// write: archive/zip creates the compressor before the local header.
+	prefix []byte
+	buf    []byte
+}
+
+func newAESWriter(w io.Writer, password string, method uint16, level int) (*aesWriter, error) {
+	salt := make([]byte, aesSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("generate salt: %w", err)
+	}
+
+	encKey, authKey, verifier, err := deriveAESKeys(password, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	ctr, err := newWinzipCTR(encKey)
+	if err != nil {
+		return nil, fmt.Errorf("create aes cipher: %w", err)
+	}
+
+	aw := &aesWriter{
+		w:      w,
+		ctr:    ctr,
+		mac:    hmac.New(sha1.New, authKey),
+		prefix: append(salt, verifier...),
+	}
+	if method == zip.Deflate {
+		aw.deflate, err = flate.NewWriter(encryptingWriter{aw}, level)
+		if err != nil {
+			return nil, fmt.Errorf("create deflate writer: %w", err)
+		}
+	}
+	return aw, nil
+}
+
+func (w *aesWriter) Write(p []byte) (int, error) {
+	if w.deflate != nil {
+		return w.deflate.Write(p)
+	}
+	return w.encrypt(p)
+}
+
+func (w *aesWriter) encrypt(p []byte) (int, error) {
+	if err := w.writePrefix(); err != nil {
+		return 0, err
+	}
+	if cap(w.buf) < len(p) {
+		w.buf = make([]byte, len(p))
+	}
+	out := w.buf[:len(p)]
+	w.ctr.XORKeyStream(out, p)
+	w.mac.Write(out)
+	if _, err := w.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *aesWriter) Close() error {
+	if w.deflate != nil {
+		if err := w.deflate.Close(); err != nil {
+			return err
+		}
+	}
+	if err := w.writePrefix(); err != nil {
+		return err
+	}
+	_, err := w.w.Write(w.mac.Sum(nil)[:aesAuthCodeLen])
+	return err
+}
+
+func (w *aesWriter) writePrefix() error {
+	if w.prefix == nil {
+		return nil
+	}
+	_, err := w.w.Write(w.prefix)
+	w.prefix = nil
+	return err
+}
+
+// encryptingWriter feeds the deflate output of an aesWriter into its cipher.
+type encryptingWriter struct {
+	aw *aesWriter
+}
+
+func (e encryptingWriter) Write(p []byte) (int, error) {
+	return e.aw.encrypt(p)
+}
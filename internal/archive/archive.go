@@ -0,0 +1,324 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var ErrUnknownFormat = errors.New("unknown archive format")
+
+type Format string
+
+const (
+	FormatZip    Format = "zip"
+	FormatTar    Format = "tar"
+	FormatTarGz  Format = "tar.gz"
+	FormatTarZst Format = "tar.zst"
+)
+
+// Formats lists every supported format, the default first.
+var Formats = []Format{FormatZip, FormatTar, FormatTarGz, FormatTarZst}
+
+// ParseFormat accepts a format name, with or without a leading dot, and the
+// common aliases tgz and tzst. An empty name means zip.
+func ParseFormat(name string) (Format, error) {
+	name = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(name)), ".")
+	switch name {
+	case "", "zip":
+		return FormatZip, nil
+	case "tar":
+		return FormatTar, nil
+	case "tar.gz", "tgz":
+		return FormatTarGz, nil
+	case "tar.zst", "tzst":
+		return FormatTarZst, nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrUnknownFormat, name)
+}
+
+func (f Format) Extension() string {
+	return "." + string(f)
+}
+
+func (f Format) ContentType() string {
+	switch f {
+	case FormatTar:
+		return "application/x-tar"
+	case FormatTarGz:
+		return "application/gzip"
+	case FormatTarZst:
+		return "application/zstd"
+	}
+	return "application/zip"
+}
+
+// SizeUnknown as Entry.Size makes AddFile read r to the end. Only zip
+// supports it: a tar header needs the size before the data.
+const SizeUnknown = -1
+
+var ErrSizeRequired = errors.New("tar entries need a known size")
+
+// Entry describes a regular file added to an archive.
+type Entry struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+	// ContentType lets CompressionAuto store already compressed data as is.
+	ContentType string
+}
+
+// Writer adds files to an archive. Close finishes the archive but does not
+// close the underlying writer.
+type Writer interface {
+	// AddFile writes entry.Size bytes from r, or all of r for SizeUnknown.
+	AddFile(entry Entry, r io.Reader) error
+	// Copy adds the entries of src, an archive of the same format, whose
+	// names keep accepts. Zip entries are copied without recompression, so
+	// they stay encrypted with the password they were written with.
+	Copy(src io.ReaderAt, size int64, keep func(name string) bool) error
+	Close() error
+}
+
+type options struct {
+	password    string
+	compression Compression
+	level       int
+}
+
+type Option func(*options)
+
+// WithPassword encrypts every entry with WinZip AES-256. Only zip supports it.
+func WithPassword(password string) Option {
+	return func(o *options) {
+		o.password = password
+	}
+}
+
+// WithCompression sets the zip compression method and the compression
+// level, DefaultLevel or MinLevel..MaxLevel. The default is deflate at
+// DefaultLevel.
+func WithCompression(compression Compression, level int) Option {
+	return func(o *options) {
+		o.compression = compression
+		o.level = level
+	}
+}
+
+func NewWriter(format Format, w io.Writer, opts ...Option) (Writer, error) {
+	o := options{compression: CompressionDeflate, level: DefaultLevel}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.password != "" && format != FormatZip {
+		return nil, fmt.Errorf("%w: %q", ErrEncryptionUnsupported, format)
+	}
+	if err := ValidateLevel(o.level); err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case FormatZip:
+		return newZipWriter(w, o), nil
+	case FormatTar:
+		return &tarWriter{tw: tar.NewWriter(w), format: format}, nil
+	case FormatTarGz:
+		gz, err := gzip.NewWriterLevel(w, o.level)
+		if err != nil {
+			return nil, fmt.Errorf("create gzip writer: %w", err)
+		}
+		return &tarWriter{tw: tar.NewWriter(gz), compressor: gz, format: format}, nil
+	case FormatTarZst:
+		var zstdOpts []zstd.EOption
+		if o.level != DefaultLevel {
+			zstdOpts = append(zstdOpts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(o.level)))
+		}
+		zw, err := zstd.NewWriter(w, zstdOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("create zstd writer: %w", err)
+		}
+		return &tarWriter{tw: tar.NewWriter(zw), compressor: zw, format: format}, nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+}
+
+type zipWriter struct {
+	zw          *zip.Writer
+	compression Compression
+	encrypted   bool
+	// method is the real compression method of the entry being written;
+	// the AES compressor reads it since the zip header only says aesMethod.
+	method uint16
+}
+
+func newZipWriter(w io.Writer, o options) *zipWriter {
+	zipW := &zipWriter{
+		zw:          zip.NewWriter(w),
+		compression: o.compression,
+		encrypted:   o.password != "",
+	}
+
+	level := o.level
+	zipW.zw.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+		return flate.NewWriter(out, level)
+	})
+	if zipW.encrypted {
+		password := o.password
+		zipW.zw.RegisterCompressor(aesMethod, func(out io.Writer) (io.WriteCloser, error) {
+			return newAESWriter(out, password, zipW.method, level)
+		})
+	}
+	return zipW
+}
+
+// entryMethod picks store or deflate for one entry.
+func (w *zipWriter) entryMethod(entry Entry) uint16 {
+	switch w.compression {
+	case CompressionStore:
+		return zip.Store
+	case CompressionAuto:
+		if IsCompressedType(entry.ContentType) {
+			return zip.Store
+		}
+	}
+	return zip.Deflate
+}
+
+func (w *zipWriter) AddFile(entry Entry, r io.Reader) error {
+	w.method = w.entryMethod(entry)
+	header := &zip.FileHeader{
+		Name:     entry.Name,
+		Method:   w.method,
+		Modified: entry.ModTime,
+	}
+	if w.encrypted {
+		header.Method = aesMethod
+		header.Flags = 0x1 // encrypted
+		header.Extra = aesExtra(w.method)
+	}
+	fw, err := w.zw.CreateHeader(header)
+	if err != nil {
+		return fmt.Errorf("create zip entry: %w", err)
+	}
+	if entry.Size == SizeUnknown {
+		_, err = io.Copy(fw, r)
+	} else {
+		_, err = io.CopyN(fw, r, entry.Size)
+	}
+	if err != nil {
+		return fmt.Errorf("write zip entry: %w", err)
+	}
+	return nil
+}
+
+func (w *zipWriter) Copy(src io.ReaderAt, size int64, keep func(name string) bool) error {
+	zr, err := zip.NewReader(src, size)
+	if err != nil {
+		return fmt.Errorf("open zip: %w", err)
+	}
+	for _, f := range zr.File {
+		if !keep(f.Name) {
+			continue
+		}
+		raw, err := f.OpenRaw()
+		if err != nil {
+			return fmt.Errorf("open zip entry: %w", err)
+		}
+		header := f.FileHeader
+		fw, err := w.zw.CreateRaw(&header)
+		if err != nil {
+			return fmt.Errorf("create zip entry: %w", err)
+		}
+		if _, err := io.Copy(fw, raw); err != nil {
+			return fmt.Errorf("copy zip entry: %w", err)
+		}
+	}
+	return nil
+}
+
+func (w *zipWriter) Close() error {
+	return w.zw.Close()
+}
+
+type tarWriter struct {
+	tw *tar.Writer
+	// compressor wraps the output for tar.gz and tar.zst, nil for plain tar.
+	compressor io.WriteCloser
+	format     Format
+}
+
+func (w *tarWriter) AddFile(entry Entry, r io.Reader) error {
+	if entry.Size == SizeUnknown {
+		return fmt.Errorf("%w: %s", ErrSizeRequired, entry.Name)
+	}
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     entry.Name,
+		Size:     entry.Size,
+		Mode:     0o644,
+		ModTime:  entry.ModTime,
+		Format:   tar.FormatPAX,
+	}
+	if err := w.tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("write tar header: %w", err)
+	}
+	if _, err := io.CopyN(w.tw, r, entry.Size); err != nil {
+		return fmt.Errorf("write tar entry: %w", err)
+	}
+	return nil
+}
+
+func (w *tarWriter) Copy(src io.ReaderAt, size int64, keep func(name string) bool) error {
+	var r io.Reader = io.NewSectionReader(src, 0, size)
+	switch w.format {
+	case FormatTarGz:
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return fmt.Errorf("open gzip: %w", err)
+		}
+		defer gz.Close()
+		r = gz
+	case FormatTarZst:
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return fmt.Errorf("open zstd: %w", err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read tar header: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg || !keep(header.Name) {
+			continue
+		}
+		entry := Entry{Name: header.Name, Size: header.Size, ModTime: header.ModTime}
+		if err := w.AddFile(entry, tr); err != nil {
+			return err
+		}
+	}
+}
+
+func (w *tarWriter) Close() error {
+	err := w.tw.Close()
+	if w.compressor != nil {
+		err = errors.Join(err, w.compressor.Close())
+	}
+	return err
+}
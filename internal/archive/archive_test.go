@@ -0,0 +1,459 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected Format
+		err      bool
+	}{
+		{name: "Empty", input: "", expected: FormatZip},
+		{name: "Zip", input: "zip", expected: FormatZip},
+		{name: "Tar", input: "TAR", expected: FormatTar},
+		{name: "TarGz", input: "tar.gz", expected: FormatTarGz},
+		{name: "Tgz", input: ".tgz", expected: FormatTarGz},
+		{name: "TarZst", input: " tar.zst ", expected: FormatTarZst},
+		{name: "Tzst", input: "tzst", expected: FormatTarZst},
+		{name: "Unknown", input: "rar", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format, err := ParseFormat(tt.input)
+			if tt.err {
+				assert.True(t, errors.Is(err, ErrUnknownFormat))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, format)
+		})
+	}
+}
+
+func TestFormat_ExtensionAndContentType(t *testing.T) {
+	assert.Equal(t, ".zip", FormatZip.Extension())
+	assert.Equal(t, ".tar.gz", FormatTarGz.Extension())
+	assert.Equal(t, "application/zip", FormatZip.ContentType())
+	assert.Equal(t, "application/x-tar", FormatTar.ContentType())
+	assert.Equal(t, "application/gzip", FormatTarGz.ContentType())
+	assert.Equal(t, "application/zstd", FormatTarZst.ContentType())
+}
+
+func TestNewWriter_UnknownFormat(t *testing.T) {
+	_, err := NewWriter(Format("rar"), io.Discard)
+	assert.True(t, errors.Is(err, ErrUnknownFormat))
+}
+
+func TestWriter_RoundTrip(t *testing.T) {
+	files := map[string]string{
+		"a.txt":         "first file",
+		"dir/b.pdf":     "%PDF-second",
+		"manifest.json": "{}",
+	}
+	order := []string{"a.txt", "dir/b.pdf", "manifest.json"}
+
+	for _, format := range Formats {
+		t.Run(string(format), func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := NewWriter(format, &buf)
+			require.NoError(t, err)
+			for _, name := range order {
+				content := files[name]
+				require.NoError(t, w.AddFile(Entry{Name: name, Size: int64(len(content)), ModTime: time.Now()}, strings.NewReader(content)))
+			}
+			require.NoError(t, w.Close())
+
+			assert.Equal(t, files, readArchive(t, format, buf.Bytes()))
+		})
+	}
+}
+
+func TestWriter_Copy(t *testing.T) {
+	files := map[string]string{
+		"a.txt":         "first file",
+		"dir/b.pdf":     "%PDF-second",
+		"manifest.json": "{}",
+	}
+	keep := func(name string) bool { return name != "manifest.json" }
+
+	for _, format := range Formats {
+		t.Run(string(format), func(t *testing.T) {
+			var prev bytes.Buffer
+			w, err := NewWriter(format, &prev)
+			require.NoError(t, err)
+			for _, name := range []string{"a.txt", "dir/b.pdf", "manifest.json"} {
+				content := files[name]
+				require.NoError(t, w.AddFile(Entry{Name: name, Size: int64(len(content)), ModTime: time.Now()}, strings.NewReader(content)))
+			}
+			require.NoError(t, w.Close())
+
+			var buf bytes.Buffer
+			w, err = NewWriter(format, &buf)
+			require.NoError(t, err)
+			require.NoError(t, w.Copy(bytes.NewReader(prev.Bytes()), int64(prev.Len()), keep))
+			require.NoError(t, w.AddFile(Entry{Name: "c.txt", Size: 3, ModTime: time.Now()}, strings.NewReader("new")))
+			require.NoError(t, w.Close())
+
+			assert.Equal(t, map[string]string{
+				"a.txt":     "first file",
+				"dir/b.pdf": "%PDF-second",
+				"c.txt":     "new",
+			}, readArchive(t, format, buf.Bytes()))
+		})
+	}
+}
+
+func TestZipWriter_CopyEncrypted(t *testing.T) {
+	const password = "s3cr3t-pa$$"
+	content := strings.Repeat("confidential ", 100)
+
+	var prev bytes.Buffer
+	w, err := NewWriter(FormatZip, &prev, WithPassword(password))
+	require.NoError(t, err)
+	require.NoError(t, w.AddFile(Entry{Name: "secret.txt", Size: int64(len(content)), ModTime: time.Now()}, strings.NewReader(content)))
+	require.NoError(t, w.Close())
+
+	var buf bytes.Buffer
+	w, err = NewWriter(FormatZip, &buf, WithPassword(password))
+	require.NoError(t, err)
+	require.NoError(t, w.Copy(bytes.NewReader(prev.Bytes()), int64(prev.Len()), func(string) bool { return true }))
+	require.NoError(t, w.Close())
+
+	reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	require.Len(t, reader.File, 1)
+	data, err := decryptAESEntry(reader.File[0], password)
+	require.NoError(t, err)
+	assert.Equal(t, content, string(data))
+}
+
+func TestWriter_ShortReader(t *testing.T) {
+	for _, format := range Formats {
+		t.Run(string(format), func(t *testing.T) {
+			w, err := NewWriter(format, io.Discard)
+			require.NoError(t, err)
+			err = w.AddFile(Entry{Name: "short.txt", Size: 10, ModTime: time.Now()}, strings.NewReader("abc"))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestWriter_SizeUnknown(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(FormatZip, &buf)
+	require.NoError(t, err)
+	require.NoError(t, w.AddFile(Entry{Name: "stream.txt", Size: SizeUnknown, ModTime: time.Now()}, strings.NewReader("streamed data")))
+	require.NoError(t, w.Close())
+	assert.Equal(t, map[string]string{"stream.txt": "streamed data"}, readArchive(t, FormatZip, buf.Bytes()))
+
+	for _, format := range []Format{FormatTar, FormatTarGz, FormatTarZst} {
+		w, err := NewWriter(format, io.Discard)
+		require.NoError(t, err)
+		err = w.AddFile(Entry{Name: "stream.txt", Size: SizeUnknown}, strings.NewReader("streamed data"))
+		assert.ErrorIs(t, err, ErrSizeRequired, string(format))
+	}
+}
+
+func TestZipWriter_Compression(t *testing.T) {
+	text := strings.Repeat("plain text compresses well ", 200)
+	entries := []Entry{
+		{Name: "notes.txt", Size: int64(len(text)), ContentType: "text/plain; charset=utf-8"},
+		{Name: "photo.jpg", Size: int64(len(text)), ContentType: "image/jpeg"},
+	}
+
+	tests := []struct {
+		name        string
+		compression Compression
+		level       int
+		expected    map[string]uint16
+	}{
+		{
+			name:        "Deflate",
+			compression: CompressionDeflate,
+			level:       DefaultLevel,
+			expected:    map[string]uint16{"notes.txt": zip.Deflate, "photo.jpg": zip.Deflate},
+		},
+		{
+			name:        "Store",
+			compression: CompressionStore,
+			level:       DefaultLevel,
+			expected:    map[string]uint16{"notes.txt": zip.Store, "photo.jpg": zip.Store},
+		},
+		{
+			name:        "Auto",
+			compression: CompressionAuto,
+			level:       MaxLevel,
+			expected:    map[string]uint16{"notes.txt": zip.Deflate, "photo.jpg": zip.Store},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := NewWriter(FormatZip, &buf, WithCompression(tt.compression, tt.level))
+			require.NoError(t, err)
+			for _, entry := range entries {
+				require.NoError(t, w.AddFile(entry, strings.NewReader(text)))
+			}
+			require.NoError(t, w.Close())
+
+			reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+			require.NoError(t, err)
+			for _, f := range reader.File {
+				assert.Equal(t, tt.expected[f.Name], f.Method, f.Name)
+				if f.Method == zip.Store {
+					assert.Equal(t, f.UncompressedSize64, f.CompressedSize64, f.Name)
+				} else {
+					assert.Less(t, f.CompressedSize64, f.UncompressedSize64, f.Name)
+				}
+			}
+			assert.Equal(t, map[string]string{"notes.txt": text, "photo.jpg": text}, readArchive(t, FormatZip, buf.Bytes()))
+		})
+	}
+}
+
+func TestNewWriter_InvalidLevel(t *testing.T) {
+	for _, format := range Formats {
+		_, err := NewWriter(format, io.Discard, WithCompression(CompressionDeflate, 42))
+		assert.True(t, errors.Is(err, ErrInvalidCompression), format)
+	}
+}
+
+func TestNewWriter_LevelsForTar(t *testing.T) {
+	content := strings.Repeat("a", 4096)
+	for _, format := range []Format{FormatTarGz, FormatTarZst} {
+		for _, level := range []int{MinLevel, 1, MaxLevel} {
+			var buf bytes.Buffer
+			w, err := NewWriter(format, &buf, WithCompression(CompressionDeflate, level))
+			require.NoError(t, err)
+			require.NoError(t, w.AddFile(Entry{Name: "a.txt", Size: int64(len(content))}, strings.NewReader(content)))
+			require.NoError(t, w.Close())
+			assert.Equal(t, map[string]string{"a.txt": content}, readArchive(t, format, buf.Bytes()))
+		}
+	}
+}
+
+func TestParseCompression(t *testing.T) {
+	for input, expected := range map[string]Compression{
+		"":        CompressionDeflate,
+		"Deflate": CompressionDeflate,
+		"store":   CompressionStore,
+		"none":    CompressionStore,
+		" auto ":  CompressionAuto,
+	} {
+		compression, err := ParseCompression(input)
+		assert.NoError(t, err, input)
+		assert.Equal(t, expected, compression, input)
+	}
+
+	_, err := ParseCompression("bzip2")
+	assert.True(t, errors.Is(err, ErrInvalidCompression))
+}
+
+func TestIsCompressedType(t *testing.T) {
+	assert.True(t, IsCompressedType("image/jpeg"))
+	assert.True(t, IsCompressedType("application/pdf"))
+	assert.True(t, IsCompressedType("video/mp4"))
+	assert.True(t, IsCompressedType("application/vnd.openxmlformats-officedocument.wordprocessingml.document"))
+	assert.False(t, IsCompressedType("text/plain; charset=utf-8"))
+	assert.False(t, IsCompressedType("application/json"))
+	assert.False(t, IsCompressedType(""))
+}
+
+func readArchive(t *testing.T, format Format, data []byte) map[string]string {
+	t.Helper()
+	result := make(map[string]string)
+
+	if format == FormatZip {
+		reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		require.NoError(t, err)
+		for _, f := range reader.File {
+			rc, err := f.Open()
+			require.NoError(t, err)
+			content, err := io.ReadAll(rc)
+			rc.Close()
+			require.NoError(t, err)
+			result[f.Name] = string(content)
+		}
+		return result
+	}
+
+	var r io.Reader = bytes.NewReader(data)
+	switch format {
+	case FormatTarGz:
+		gz, err := gzip.NewReader(r)
+		require.NoError(t, err)
+		defer gz.Close()
+		r = gz
+	case FormatTarZst:
+		zr, err := zstd.NewReader(r)
+		require.NoError(t, err)
+		defer zr.Close()
+		r = zr
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		content, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		result[header.Name] = string(content)
+	}
+	return result
+}
+
+func TestZipWriter_Encrypted(t *testing.T) {
+	files := map[string]string{
+		"secret.txt": strings.Repeat("confidential ", 100),
+		"tiny.bin":   "x",
+		"empty.txt":  "",
+	}
+	const password = "s3cr3t-pa$$"
+
+	var buf bytes.Buffer
+	w, err := NewWriter(FormatZip, &buf, WithPassword(password), WithCompression(CompressionAuto, DefaultLevel))
+	require.NoError(t, err)
+	for _, name := range []string{"secret.txt", "tiny.bin", "empty.txt"} {
+		content := files[name]
+		entry := Entry{Name: name, Size: int64(len(content)), ModTime: time.Now()}
+		if name == "tiny.bin" {
+			entry.ContentType = "application/zip"
+		}
+		require.NoError(t, w.AddFile(entry, strings.NewReader(content)))
+	}
+	require.NoError(t, w.Close())
+
+	assert.NotContains(t, buf.String(), "confidential")
+
+	reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	require.Len(t, reader.File, len(files))
+
+	for _, f := range reader.File {
+		assert.Equal(t, aesMethod, f.Method)
+		assert.NotZero(t, f.Flags&0x1, "entry %s is not flagged as encrypted", f.Name)
+
+		content, err := decryptAESEntry(f, password)
+		require.NoError(t, err, f.Name)
+		assert.Equal(t, files[f.Name], string(content), f.Name)
+
+		_, err = decryptAESEntry(f, "wrong password")
+		assert.Error(t, err, f.Name)
+	}
+}
+
+func TestNewWriter_PasswordRequiresZip(t *testing.T) {
+	for _, format := range []Format{FormatTar, FormatTarGz, FormatTarZst} {
+		_, err := NewWriter(format, io.Discard, WithPassword("secret"))
+		assert.True(t, errors.Is(err, ErrEncryptionUnsupported), format)
+	}
+}
+
+// decryptAESEntry reads a WinZip AES-256 entry the way an unzip tool does,
+// independently of the writer: parse the extra field, check the password
+// verifier and the HMAC, then decrypt and inflate.
+func decryptAESEntry(f *zip.File, password string) ([]byte, error) {
+	method, strength, ok := parseAESExtra(f.Extra)
+	if !ok {
+		return nil, errors.New("no aes extra field")
+	}
+	if strength != 3 {
+		return nil, fmt.Errorf("unexpected aes strength %d", strength)
+	}
+
+	rc, err := f.OpenRaw()
+	if err != nil {
+		return nil, err
+	}
+	raw, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) < 16+2+10 {
+		return nil, errors.New("entry too short")
+	}
+	salt, verifier := raw[:16], raw[16:18]
+	data, authCode := raw[18:len(raw)-10], raw[len(raw)-10:]
+
+	key, err := pbkdf2.Key(sha1.New, password, salt, 1000, 66)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(key[64:], verifier) {
+		return nil, errors.New("wrong password")
+	}
+
+	mac := hmac.New(sha1.New, key[32:64])
+	mac.Write(data)
+	if !hmac.Equal(mac.Sum(nil)[:10], authCode) {
+		return nil, errors.New("authentication code mismatch")
+	}
+
+	block, err := aes.NewCipher(key[:32])
+	if err != nil {
+		return nil, err
+	}
+	plain := make([]byte, len(data))
+	var counter, stream [16]byte
+	for i := 0; i < len(data); i += 16 {
+		binary.LittleEndian.PutUint64(counter[:8], uint64(i/16+1))
+		block.Encrypt(stream[:], counter[:])
+		for j := i; j < len(data) && j < i+16; j++ {
+			plain[j] = data[j] ^ stream[j-i]
+		}
+	}
+
+	if method == zip.Deflate {
+		plain, err = io.ReadAll(flate.NewReader(bytes.NewReader(plain)))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if crc32.ChecksumIEEE(plain) != f.CRC32 {
+		return nil, errors.New("crc mismatch")
+	}
+	return plain, nil
+}
+
+func parseAESExtra(extra []byte) (method uint16, strength byte, ok bool) {
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra)
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		if len(extra) < 4+size {
+			return 0, 0, false
+		}
+		if id == 0x9901 && size == 7 && string(extra[6:8]) == "AE" {
+			return binary.LittleEndian.Uint16(extra[9:]), extra[8], true
+		}
+		extra = extra[4+size:]
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,86 @@
+package archive
+
+import (
+	"compress/flate"
+	"errors"
+	"fmt"
+	"mime"
+	"strings"
+)
+
+var ErrInvalidCompression = errors.New("invalid compression")
+
+// Compression selects how zip entries are stored. Tar archives are
+// compressed as a whole, so for them only the level matters.
+type Compression string
+
+const (
+	CompressionStore   Compression = "store"
+	CompressionDeflate Compression = "deflate"
+	// CompressionAuto stores data that is already compressed (see
+	// IsCompressedType) and deflates everything else.
+	CompressionAuto Compression = "auto"
+)
+
+const (
+	DefaultLevel = flate.DefaultCompression
+	MinLevel     = flate.NoCompression
+	MaxLevel     = flate.BestCompression
+)
+
+// ParseCompression accepts a compression name; an empty name means deflate.
+func ParseCompression(name string) (Compression, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "deflate":
+		return CompressionDeflate, nil
+	case "store", "none":
+		return CompressionStore, nil
+	case "auto":
+		return CompressionAuto, nil
+	}
+	return "", fmt.Errorf("%w: unknown method %q", ErrInvalidCompression, name)
+}
+
+// ValidateLevel checks a compression level: DefaultLevel or MinLevel..MaxLevel.
+func ValidateLevel(level int) error {
+	if level != DefaultLevel && (level < MinLevel || level > MaxLevel) {
+		return fmt.Errorf("%w: level %d is out of range %d..%d", ErrInvalidCompression, level, MinLevel, MaxLevel)
+	}
+	return nil
+}
+
+// compressedTypes are formats that gain nothing from another deflate pass.
+var compressedTypes = map[string]bool{
+	"application/pdf":              true,
+	"application/zip":              true,
+	"application/gzip":             true,
+	"application/x-gzip":           true,
+	"application/zstd":             true,
+	"application/x-bzip2":          true,
+	"application/x-xz":             true,
+	"application/x-7z-compressed":  true,
+	"application/vnd.rar":          true,
+	"application/x-rar-compressed": true,
+	"application/epub+zip":         true,
+	"image/jpeg":                   true,
+	"image/png":                    true,
+	"image/gif":                    true,
+	"image/webp":                   true,
+	"image/avif":                   true,
+	"image/heic":                   true,
+}
+
+// IsCompressedType reports whether data of this MIME type is already
+// compressed: the types above, audio, video and OOXML office documents.
+func IsCompressedType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	if compressedTypes[mediaType] {
+		return true
+	}
+	return strings.HasPrefix(mediaType, "audio/") ||
+		strings.HasPrefix(mediaType, "video/") ||
+		strings.HasPrefix(mediaType, "application/vnd.openxmlformats-officedocument.")
+}
@@ -4,14 +4,94 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/supchaser/test_task/internal/archive"
+	"github.com/supchaser/test_task/internal/utils/validate"
+)
+
+const defaultMaxObjectsPerTask = 3
+
+// Archive storage backends.
+const (
+	StorageLocal = "local"
+	StorageS3    = "s3"
 )
 
 type Config struct {
 	LogMode        string
 	ServerPort     string
 	MaxActiveTasks int
+	DataDir        string
+	MaxQueuedTasks int
+	// StorageDir holds downloads and archives being built, and with the
+	// local backend the finished archives as well.
+	StorageDir string
+	// StorageBackend keeps finished archives: local or s3.
+	StorageBackend string
+	// S3* configure the s3 backend; any S3-compatible service will do.
+	S3Endpoint  string
+	S3Region    string
+	S3Bucket    string
+	S3AccessKey string
+	S3SecretKey string `json:"-"`
+	// MaxObjectsPerTask limits how many objects a task may hold.
+	MaxObjectsPerTask int
+	// AutoFinalizeObjects is the object count that starts archiving without an
+	// explicit finalize call; 0 disables auto-finalization.
+	AutoFinalizeObjects int
+	// IdleTaskTTL expires waiting tasks without activity; 0 disables it.
+	IdleTaskTTL time.Duration
+	// TaskRetention removes finished tasks and their archives; 0 keeps them forever.
+	TaskRetention  time.Duration
+	ReaperInterval time.Duration
+	// JobTimeout limits how long building one archive may take; 0 disables it.
+	JobTimeout time.Duration
+	// DrainTimeout is how long shutdown waits for running archive jobs
+	// before interrupting them.
+	DrainTimeout time.Duration
+	// MaxDownloads caps simultaneous object downloads across all tasks,
+	// MaxDownloadsPerHost caps them per origin host.
+	MaxDownloads        int
+	MaxDownloadsPerHost int
+	// Retry* configure how the availability probe and downloads retry
+	// transient failures (connection errors, 429, 502, 503, 504).
+	RetryMaxAttempts int
+	RetryBaseBackoff time.Duration
+	RetryMaxBackoff  time.Duration
+	RetryJitter      float64
+	// MaxObjectSize and MaxArchiveSize limit a single object and the total
+	// size of the files in one archive, in bytes; 0 disables a limit.
+	MaxObjectSize  int64
+	MaxArchiveSize int64
+	// ArchiveReport adds REPORT.txt to archives next to manifest.json.
+	ArchiveReport bool
+	// Compression and CompressionLevel are used by tasks that choose none.
+	Compression      archive.Compression
+	CompressionLevel int
+	// FilePolicy lists accepted file types with their extensions and size limits.
+	FilePolicy validate.Policy
+	// Fetch* configure the outbound HTTP client used for user-supplied URLs.
+	FetchConnectTimeout        time.Duration
+	FetchTLSHandshakeTimeout   time.Duration
+	FetchResponseHeaderTimeout time.Duration
+	FetchTotalTimeout          time.Duration
+	FetchMaxRedirects          int
+	FetchUserAgent             string
+	FetchProxyURL              string `json:"-"`
+	FetchMaxIdleConns          int
+	FetchMaxIdleConnsPerHost   int
+	FetchMaxConnsPerHost       int
+	// FetchAllowPrivate lets users submit URLs on loopback, private and
+	// link-local addresses; meant for local development only.
+	FetchAllowPrivate   bool
+	FetchAllowedSchemes []string
+	FetchAllowedHosts   []string
+	FetchDeniedHosts    []string
+	FetchAllowedPorts   []int
+	FetchDeniedPorts    []int
 }
 
 func checkEnv(envVars []string) error {
@@ -54,10 +134,118 @@ func LoadConfig(envFile string) (*Config, error) {
 		return nil, fmt.Errorf("LoadConfig: %w", err)
 	}
 
+	maxObjects := getEnvInt("MAX_OBJECTS_PER_TASK", defaultMaxObjectsPerTask)
+	if maxObjects <= 0 {
+		return nil, fmt.Errorf("LoadConfig: MAX_OBJECTS_PER_TASK must be positive, got %d", maxObjects)
+	}
+
+	// a threshold above the object limit could never be reached; 0 turns
+	// auto-finalize off
+	autoFinalize := getEnvInt("AUTO_FINALIZE_OBJECTS", maxObjects)
+	if autoFinalize < 0 || autoFinalize > maxObjects {
+		return nil, fmt.Errorf("LoadConfig: AUTO_FINALIZE_OBJECTS must be between 0 and MAX_OBJECTS_PER_TASK (%d), got %d", maxObjects, autoFinalize)
+	}
+
+	// time.NewTicker panics on a non-positive interval
+	reaperInterval := getEnvDuration("REAPER_INTERVAL", time.Minute)
+	if reaperInterval <= 0 {
+		return nil, fmt.Errorf("LoadConfig: REAPER_INTERVAL must be positive, got %s", reaperInterval)
+	}
+
+	filePolicy := validate.DefaultPolicy()
+	if spec := os.Getenv("FILE_TYPES"); spec != "" {
+		filePolicy, err = validate.ParsePolicy(spec)
+		if err != nil {
+			return nil, fmt.Errorf("LoadConfig: FILE_TYPES: %w", err)
+		}
+	}
+
+	compression, err := archive.ParseCompression(os.Getenv("COMPRESSION"))
+	if err != nil {
+		return nil, fmt.Errorf("LoadConfig: COMPRESSION: %w", err)
+	}
+	compressionLevel := getEnvInt("COMPRESSION_LEVEL", archive.DefaultLevel)
+	if err := archive.ValidateLevel(compressionLevel); err != nil {
+		return nil, fmt.Errorf("LoadConfig: COMPRESSION_LEVEL: %w", err)
+	}
+
+	storageBackend := getEnvString("STORAGE_BACKEND", StorageLocal)
+	switch storageBackend {
+	case StorageLocal:
+	case StorageS3:
+		if os.Getenv("S3_ENDPOINT") == "" || os.Getenv("S3_BUCKET") == "" {
+			return nil, fmt.Errorf("LoadConfig: STORAGE_BACKEND=s3 requires S3_ENDPOINT and S3_BUCKET")
+		}
+	default:
+		return nil, fmt.Errorf("LoadConfig: STORAGE_BACKEND must be %s or %s, got %q", StorageLocal, StorageS3, storageBackend)
+	}
+
+	maxObjectSize, err := getEnvSize("MAX_OBJECT_SIZE", 100<<20)
+	if err != nil {
+		return nil, fmt.Errorf("LoadConfig: MAX_OBJECT_SIZE: %w", err)
+	}
+	maxArchiveSize, err := getEnvSize("MAX_ARCHIVE_SIZE", 500<<20)
+	if err != nil {
+		return nil, fmt.Errorf("LoadConfig: MAX_ARCHIVE_SIZE: %w", err)
+	}
+
 	return &Config{
 		LogMode:        os.Getenv("LOG_MODE"),
 		ServerPort:     os.Getenv("SERVER_PORT"),
 		MaxActiveTasks: stringToInt(os.Getenv("MAX_ACTIVE_TASKS")),
+		DataDir:        os.Getenv("DATA_DIR"),
+		MaxQueuedTasks: getEnvInt("MAX_QUEUED_TASKS", 0),
+
+		StorageDir:     getEnvString("STORAGE_DIR", "./storage"),
+		StorageBackend: storageBackend,
+		S3Endpoint:     os.Getenv("S3_ENDPOINT"),
+		S3Region:       getEnvString("S3_REGION", "us-east-1"),
+		S3Bucket:       os.Getenv("S3_BUCKET"),
+		S3AccessKey:    os.Getenv("S3_ACCESS_KEY"),
+		S3SecretKey:    os.Getenv("S3_SECRET_KEY"),
+
+		MaxObjectsPerTask:   maxObjects,
+		AutoFinalizeObjects: autoFinalize,
+
+		IdleTaskTTL:    getEnvDuration("IDLE_TASK_TTL", 0),
+		TaskRetention:  time.Duration(getEnvInt("TASK_RETENTION_HOURS", 0)) * time.Hour,
+		ReaperInterval: reaperInterval,
+		JobTimeout:     getEnvDuration("JOB_TIMEOUT", 30*time.Minute),
+		DrainTimeout:   getEnvDuration("DRAIN_TIMEOUT", 30*time.Second),
+
+		MaxDownloads:        getEnvInt("MAX_DOWNLOADS", 8),
+		MaxDownloadsPerHost: getEnvInt("MAX_DOWNLOADS_PER_HOST", 2),
+
+		RetryMaxAttempts: getEnvInt("RETRY_MAX_ATTEMPTS", 3),
+		RetryBaseBackoff: getEnvDuration("RETRY_BASE_BACKOFF", 500*time.Millisecond),
+		RetryMaxBackoff:  getEnvDuration("RETRY_MAX_BACKOFF", 10*time.Second),
+		RetryJitter:      getEnvFloat("RETRY_JITTER", 0.2),
+
+		MaxObjectSize:  maxObjectSize,
+		MaxArchiveSize: maxArchiveSize,
+		FilePolicy:     filePolicy,
+		ArchiveReport:  getEnvBool("ARCHIVE_REPORT", true),
+
+		Compression:      compression,
+		CompressionLevel: compressionLevel,
+
+		FetchConnectTimeout:        getEnvDuration("FETCH_CONNECT_TIMEOUT", 5*time.Second),
+		FetchTLSHandshakeTimeout:   getEnvDuration("FETCH_TLS_TIMEOUT", 5*time.Second),
+		FetchResponseHeaderTimeout: getEnvDuration("FETCH_HEADER_TIMEOUT", 15*time.Second),
+		FetchTotalTimeout:          getEnvDuration("FETCH_TOTAL_TIMEOUT", 5*time.Minute),
+		FetchMaxRedirects:          getEnvInt("FETCH_MAX_REDIRECTS", 5),
+		FetchUserAgent:             getEnvString("FETCH_USER_AGENT", "test_task-archiver/1.0"),
+		FetchProxyURL:              os.Getenv("FETCH_PROXY_URL"),
+		FetchMaxIdleConns:          getEnvInt("FETCH_MAX_IDLE_CONNS", 100),
+		FetchMaxIdleConnsPerHost:   getEnvInt("FETCH_MAX_IDLE_CONNS_PER_HOST", 10),
+		FetchMaxConnsPerHost:       getEnvInt("FETCH_MAX_CONNS_PER_HOST", 0),
+
+		FetchAllowPrivate:   getEnvBool("FETCH_ALLOW_PRIVATE", false),
+		FetchAllowedSchemes: getEnvList("FETCH_ALLOWED_SCHEMES", []string{"http", "https"}),
+		FetchAllowedHosts:   getEnvList("FETCH_ALLOWED_HOSTS", nil),
+		FetchDeniedHosts:    getEnvList("FETCH_DENIED_HOSTS", nil),
+		FetchAllowedPorts:   getEnvIntList("FETCH_ALLOWED_PORTS", nil),
+		FetchDeniedPorts:    getEnvIntList("FETCH_DENIED_PORTS", nil),
 	}, nil
 }
 
@@ -65,3 +253,107 @@ func stringToInt(s string) int {
 	i, _ := strconv.ParseInt(s, 10, 32)
 	return int(i)
 }
+
+func getEnvString(key, fallback string) string {
+	value, exists := os.LookupEnv(key)
+	if !exists || value == "" {
+		return fallback
+	}
+	return value
+}
+
+// getEnvSize reads a size like "100MB"; see validate.ParseSize.
+func getEnvSize(key string, fallback int64) (int64, error) {
+	value, exists := os.LookupEnv(key)
+	if !exists || value == "" {
+		return fallback, nil
+	}
+	return validate.ParseSize(value)
+}
+
+func getEnvBool(key string, fallback bool) bool {
+	value, exists := os.LookupEnv(key)
+	if !exists || value == "" {
+		return fallback
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return fallback
+	}
+	return b
+}
+
+// getEnvList reads a comma-separated list, skipping empty items.
+func getEnvList(key string, fallback []string) []string {
+	value, exists := os.LookupEnv(key)
+	if !exists || value == "" {
+		return fallback
+	}
+
+	items := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// getEnvIntList reads a comma-separated list of integers; any invalid item
+// makes the whole value fall back.
+func getEnvIntList(key string, fallback []int) []int {
+	items := getEnvList(key, nil)
+	if items == nil {
+		return fallback
+	}
+
+	values := make([]int, 0, len(items))
+	for _, item := range items {
+		i, err := strconv.Atoi(item)
+		if err != nil {
+			return fallback
+		}
+		values = append(values, i)
+	}
+	return values
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value, exists := os.LookupEnv(key)
+	if !exists || value == "" {
+		return fallback
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return fallback
+	}
+	return d
+}
+
+func getEnvFloat(key string, fallback float64) float64 {
+	value, exists := os.LookupEnv(key)
+	if !exists || value == "" {
+		return fallback
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fallback
+	}
+	return f
+}
+
+func getEnvInt(key string, fallback int) int {
+	value, exists := os.LookupEnv(key)
+	if !exists || value == "" {
+		return fallback
+	}
+
+	i, err := strconv.ParseInt(value, 10, 32)
+	if err != nil {
+		return fallback
+	}
+	return int(i)
+}
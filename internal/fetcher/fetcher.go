@@ -0,0 +1,186 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+var ErrTooManyRedirects = errors.New("too many redirects")
+
+type Config struct {
+	ConnectTimeout        time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+	// TotalTimeout bounds the whole request including reading the body.
+	TotalTimeout time.Duration
+	MaxRedirects int
+	UserAgent    string
+	// ProxyURL routes all requests through an HTTP(S) proxy. When empty the
+	// standard HTTP_PROXY/HTTPS_PROXY/NO_PROXY variables are used, unless
+	// a Guard is set.
+	ProxyURL            string
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	MaxConnsPerHost     int
+	IdleConnTimeout     time.Duration
+	// Guard restricts the destinations that may be requested. Nil disables
+	// the checks. With a guard set, proxies are only taken from ProxyURL so
+	// the environment cannot silently route around it.
+	Guard *Guard
+}
+
+func DefaultConfig() Config {
+	return Config{
+		ConnectTimeout:        5 * time.Second,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ResponseHeaderTimeout: 15 * time.Second,
+		TotalTimeout:          5 * time.Minute,
+		MaxRedirects:          5,
+		UserAgent:             "test_task-archiver/1.0",
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   10,
+		IdleConnTimeout:       90 * time.Second,
+	}
+}
+
+// Fetcher is the single outbound HTTP client used to probe and download objects.
+type Fetcher struct {
+	client    *http.Client
+	userAgent string
+	guard     *Guard
+}
+
+func New(cfg Config) (*Fetcher, error) {
+	proxy := http.ProxyFromEnvironment
+	if cfg.Guard != nil {
+		proxy = nil
+	}
+	if cfg.ProxyURL != "" {
+		proxyURL, err := url.Parse(cfg.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("parse proxy url: %w", err)
+		}
+		if proxyURL.Scheme != "http" && proxyURL.Scheme != "https" {
+			return nil, fmt.Errorf("unsupported proxy scheme %q", proxyURL.Scheme)
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   cfg.ConnectTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+	dial := dialer.DialContext
+	if cfg.Guard != nil {
+		guarded := *dialer
+		guarded.Control = cfg.Guard.control
+		dial = guarded.DialContext
+		if cfg.ProxyURL != "" {
+			// the proxy itself is trusted configuration; the target is
+			// still checked before the request and on every redirect
+			proxyAddr := proxyAddress(cfg.ProxyURL)
+			dial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+				if addr == proxyAddr {
+					return dialer.DialContext(ctx, network, addr)
+				}
+				return guarded.DialContext(ctx, network, addr)
+			}
+		}
+	}
+
+	transport := &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           dial,
+		TLSHandshakeTimeout:   cfg.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: cfg.ResponseHeaderTimeout,
+		MaxIdleConns:          cfg.MaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       cfg.MaxConnsPerHost,
+		IdleConnTimeout:       cfg.IdleConnTimeout,
+		ForceAttemptHTTP2:     true,
+	}
+
+	maxRedirects := cfg.MaxRedirects
+	guard := cfg.Guard
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   cfg.TotalTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > maxRedirects {
+				return fmt.Errorf("%w: stopped after %d", ErrTooManyRedirects, maxRedirects)
+			}
+			if guard != nil {
+				return guard.CheckURL(req.Context(), req.URL)
+			}
+			return nil
+		},
+	}
+
+	return &Fetcher{
+		client:    client,
+		userAgent: cfg.UserAgent,
+		guard:     cfg.Guard,
+	}, nil
+}
+
+// Default returns a fetcher built from DefaultConfig.
+func Default() *Fetcher {
+	f, err := New(DefaultConfig())
+	if err != nil {
+		// DefaultConfig has no proxy to parse, so this cannot happen
+		panic(err)
+	}
+	return f
+}
+
+func (f *Fetcher) Head(ctx context.Context, rawURL string) (*http.Response, error) {
+	return f.do(ctx, http.MethodHead, rawURL)
+}
+
+func (f *Fetcher) Get(ctx context.Context, rawURL string) (*http.Response, error) {
+	return f.do(ctx, http.MethodGet, rawURL)
+}
+
+func (f *Fetcher) do(ctx context.Context, method, rawURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("build request: %w", err)
+	}
+
+	if f.guard != nil {
+		if err := f.guard.CheckURL(ctx, req.URL); err != nil {
+			return nil, err
+		}
+	}
+
+	if f.userAgent != "" {
+		req.Header.Set("User-Agent", f.userAgent)
+	}
+
+	return f.client.Do(req)
+}
+
+// proxyAddress returns the host:port the transport dials for the proxy.
+func proxyAddress(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	if u.Port() != "" {
+		return u.Host
+	}
+	if u.Scheme == "https" {
+		return net.JoinHostPort(u.Hostname(), "443")
+	}
+	return net.JoinHostPort(u.Hostname(), "80")
+}
+
+// CloseIdleConnections drops pooled keep-alive connections.
+func (f *Fetcher) CloseIdleConnections() {
+	f.client.CloseIdleConnections()
+}
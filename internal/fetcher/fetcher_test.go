@@ -0,0 +1,102 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetcher_UserAgent(t *testing.T) {
+	var got string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("User-Agent")
+	}))
+	defer server.Close()
+
+	cfg := DefaultConfig()
+	cfg.UserAgent = "archiver-test"
+	f, err := New(cfg)
+	require.NoError(t, err)
+
+	resp, err := f.Head(context.Background(), server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, "archiver-test", got)
+}
+
+func TestFetcher_MaxRedirects(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	cfg := DefaultConfig()
+	cfg.MaxRedirects = 2
+	f, err := New(cfg)
+	require.NoError(t, err)
+
+	_, err = f.Get(context.Background(), server.URL+"/loop")
+	assert.True(t, errors.Is(err, ErrTooManyRedirects))
+}
+
+func TestFetcher_HeaderTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	cfg := DefaultConfig()
+	cfg.ResponseHeaderTimeout = 50 * time.Millisecond
+	f, err := New(cfg)
+	require.NoError(t, err)
+
+	started := time.Now()
+	_, err = f.Get(context.Background(), server.URL)
+	assert.Error(t, err)
+	assert.Less(t, time.Since(started), 2*time.Second)
+}
+
+func TestFetcher_TotalTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	cfg := DefaultConfig()
+	cfg.TotalTimeout = 100 * time.Millisecond
+	f, err := New(cfg)
+	require.NoError(t, err)
+
+	resp, err := f.Get(context.Background(), server.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	_, err = resp.Body.Read(make([]byte, 1))
+	assert.Error(t, err)
+}
+
+func TestNew_InvalidProxy(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.ProxyURL = "socks5://127.0.0.1:1080"
+	_, err := New(cfg)
+	assert.Error(t, err)
+
+	cfg.ProxyURL = "http://proxy.local:3128"
+	_, err = New(cfg)
+	assert.NoError(t, err)
+}
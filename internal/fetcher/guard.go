@@ -0,0 +1,186 @@
+package fetcher
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/supchaser/test_task/internal/utils/errs"
+)
+
+// sharedAddressSpace is the carrier-grade NAT range (RFC 6598), which
+// net.IP.IsPrivate does not cover.
+var sharedAddressSpace = &net.IPNet{
+	IP:   net.IPv4(100, 64, 0, 0),
+	Mask: net.CIDRMask(10, 32),
+}
+
+// Guard decides which outbound destinations may be requested on behalf of
+// users. Destinations are checked before the request, on every redirect and
+// again at dial time against the address actually connected to, so a host
+// that resolves differently the second time cannot slip through.
+type Guard struct {
+	// AllowPrivate disables the IP checks; meant for local development.
+	AllowPrivate bool
+	// AllowedSchemes defaults to http and https when empty.
+	AllowedSchemes []string
+	// AllowedHosts, when not empty, is the only set of hosts that may be
+	// requested. Entries match the host exactly; "*.example.com" matches
+	// any subdomain.
+	AllowedHosts []string
+	DeniedHosts  []string
+	// AllowedPorts, when not empty, is the only set of ports that may be used.
+	AllowedPorts []int
+	DeniedPorts  []int
+
+	resolver *net.Resolver
+}
+
+// CheckURL validates scheme, host and port of u and, unless private
+// addresses are allowed, every address the host resolves to.
+func (g *Guard) CheckURL(ctx context.Context, u *url.URL) error {
+	scheme := strings.ToLower(u.Scheme)
+	schemes := g.AllowedSchemes
+	if len(schemes) == 0 {
+		schemes = []string{"http", "https"}
+	}
+	if !slices.Contains(schemes, scheme) {
+		return fmt.Errorf("%w: scheme %q is not allowed", errs.ErrForbiddenURL, u.Scheme)
+	}
+
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "" {
+		return fmt.Errorf("%w: empty host", errs.ErrForbiddenURL)
+	}
+	if matchHost(g.DeniedHosts, host) {
+		return fmt.Errorf("%w: host %q is denied", errs.ErrForbiddenURL, host)
+	}
+	if len(g.AllowedHosts) > 0 && !matchHost(g.AllowedHosts, host) {
+		return fmt.Errorf("%w: host %q is not allowed", errs.ErrForbiddenURL, host)
+	}
+
+	port, err := urlPort(u, scheme)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errs.ErrForbiddenURL, err)
+	}
+	if err := g.checkPort(port); err != nil {
+		return err
+	}
+
+	if g.AllowPrivate {
+		return nil
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		return g.CheckIP(ip)
+	}
+
+	resolver := g.resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	addrs, err := resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("resolve host: %w", err)
+	}
+	for _, addr := range addrs {
+		if err := g.CheckIP(addr.IP); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CheckIP rejects loopback, private, link-local, multicast and unspecified addresses.
+func (g *Guard) CheckIP(ip net.IP) error {
+	if g.AllowPrivate {
+		return nil
+	}
+
+	switch {
+	case ip.IsLoopback(),
+		ip.IsPrivate(),
+		ip.IsLinkLocalUnicast(),
+		ip.IsLinkLocalMulticast(),
+		ip.IsInterfaceLocalMulticast(),
+		ip.IsMulticast(),
+		ip.IsUnspecified(),
+		sharedAddressSpace.Contains(ip):
+		return fmt.Errorf("%w: address %s is not public", errs.ErrForbiddenURL, ip)
+	}
+
+	return nil
+}
+
+func (g *Guard) checkPort(port int) error {
+	if slices.Contains(g.DeniedPorts, port) {
+		return fmt.Errorf("%w: port %d is denied", errs.ErrForbiddenURL, port)
+	}
+	if len(g.AllowedPorts) > 0 && !slices.Contains(g.AllowedPorts, port) {
+		return fmt.Errorf("%w: port %d is not allowed", errs.ErrForbiddenURL, port)
+	}
+	return nil
+}
+
+// control is a net.Dialer Control hook that checks the resolved address
+// right before the connection is made.
+func (g *Guard) control(network, address string, _ syscall.RawConn) error {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errs.ErrForbiddenURL, err)
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("%w: dial to unresolved address %q", errs.ErrForbiddenURL, address)
+	}
+	if err := g.CheckIP(ip); err != nil {
+		return err
+	}
+
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return fmt.Errorf("%w: invalid port %q", errs.ErrForbiddenURL, portStr)
+	}
+	return g.checkPort(port)
+}
+
+func matchHost(patterns []string, host string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+			continue
+		}
+		if host == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+func urlPort(u *url.URL, scheme string) (int, error) {
+	if p := u.Port(); p != "" {
+		port, err := strconv.Atoi(p)
+		if err != nil || port <= 0 || port > 65535 {
+			return 0, fmt.Errorf("invalid port %q", p)
+		}
+		return port, nil
+	}
+
+	switch scheme {
+	case "http":
+		return 80, nil
+	case "https":
+		return 443, nil
+	}
+	return 0, fmt.Errorf("no default port for scheme %q", scheme)
+}
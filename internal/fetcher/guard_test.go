@@ -0,0 +1,146 @@
+package fetcher
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/supchaser/test_task/internal/utils/errs"
+)
+
+func TestGuard_CheckIP(t *testing.T) {
+	guard := &Guard{}
+
+	blocked := []string{
+		"127.0.0.1",
+		"::1",
+		"10.1.2.3",
+		"172.16.0.1",
+		"192.168.1.1",
+		"169.254.169.254",
+		"fe80::1",
+		"fc00::1",
+		"224.0.0.1",
+		"ff02::1",
+		"0.0.0.0",
+		"100.64.0.1",
+		"::ffff:127.0.0.1",
+	}
+	for _, addr := range blocked {
+		assert.ErrorIs(t, guard.CheckIP(net.ParseIP(addr)), errs.ErrForbiddenURL, addr)
+	}
+
+	allowed := []string{"8.8.8.8", "2001:4860:4860::8888"}
+	for _, addr := range allowed {
+		assert.NoError(t, guard.CheckIP(net.ParseIP(addr)), addr)
+	}
+
+	assert.NoError(t, (&Guard{AllowPrivate: true}).CheckIP(net.ParseIP("127.0.0.1")))
+}
+
+func TestGuard_CheckURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		guard   *Guard
+		rawURL  string
+		wantErr bool
+	}{
+		{name: "PublicIP", guard: &Guard{}, rawURL: "http://8.8.8.8/a.pdf"},
+		{name: "Loopback", guard: &Guard{}, rawURL: "http://127.0.0.1/a.pdf", wantErr: true},
+		{name: "Metadata", guard: &Guard{}, rawURL: "http://169.254.169.254/latest", wantErr: true},
+		{name: "FileScheme", guard: &Guard{AllowPrivate: true}, rawURL: "file:///etc/passwd", wantErr: true},
+		{name: "SchemeNotAllowed", guard: &Guard{AllowPrivate: true, AllowedSchemes: []string{"https"}}, rawURL: "http://example.com/a.pdf", wantErr: true},
+		{name: "DeniedHost", guard: &Guard{AllowPrivate: true, DeniedHosts: []string{"*.internal"}}, rawURL: "http://files.internal/a.pdf", wantErr: true},
+		{name: "AllowedHost", guard: &Guard{AllowPrivate: true, AllowedHosts: []string{"example.com"}}, rawURL: "http://example.com/a.pdf"},
+		{name: "HostNotAllowed", guard: &Guard{AllowPrivate: true, AllowedHosts: []string{"example.com"}}, rawURL: "http://example.org/a.pdf", wantErr: true},
+		{name: "SubdomainAllowed", guard: &Guard{AllowPrivate: true, AllowedHosts: []string{"*.example.com"}}, rawURL: "https://cdn.example.com/a.pdf"},
+		{name: "DeniedPort", guard: &Guard{AllowPrivate: true, DeniedPorts: []int{22}}, rawURL: "http://example.com:22/a.pdf", wantErr: true},
+		{name: "PortNotAllowed", guard: &Guard{AllowPrivate: true, AllowedPorts: []int{443}}, rawURL: "http://example.com/a.pdf", wantErr: true},
+		{name: "DefaultPortAllowed", guard: &Guard{AllowPrivate: true, AllowedPorts: []int{443}}, rawURL: "https://example.com/a.pdf"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(tt.rawURL)
+			require.NoError(t, err)
+
+			err = tt.guard.CheckURL(context.Background(), u)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, errs.ErrForbiddenURL)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestFetcher_GuardBlocksLoopback(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer server.Close()
+
+	cfg := DefaultConfig()
+	cfg.Guard = &Guard{}
+	f, err := New(cfg)
+	require.NoError(t, err)
+
+	_, err = f.Get(context.Background(), server.URL)
+	assert.ErrorIs(t, err, errs.ErrForbiddenURL)
+	assert.Equal(t, 0, requests)
+}
+
+func TestFetcher_GuardChecksRedirects(t *testing.T) {
+	internal := 0
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		internal++
+	}))
+	defer target.Close()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL, http.StatusFound)
+	})
+	origin := httptest.NewServer(mux)
+	defer origin.Close()
+
+	originURL, err := url.Parse(origin.URL)
+	require.NoError(t, err)
+
+	// the origin is reachable, but the port the redirect points to is denied
+	cfg := DefaultConfig()
+	cfg.Guard = &Guard{
+		AllowPrivate: true,
+		AllowedPorts: []int{mustPort(t, originURL)},
+	}
+	f, err := New(cfg)
+	require.NoError(t, err)
+
+	_, err = f.Get(context.Background(), origin.URL+"/redirect")
+	assert.ErrorIs(t, err, errs.ErrForbiddenURL)
+	assert.Equal(t, 0, internal)
+}
+
+func TestGuard_DialControl(t *testing.T) {
+	guard := &Guard{}
+
+	assert.ErrorIs(t, guard.control("tcp", "127.0.0.1:80", nil), errs.ErrForbiddenURL)
+	assert.ErrorIs(t, guard.control("tcp", "[fd00::1]:443", nil), errs.ErrForbiddenURL)
+	assert.NoError(t, guard.control("tcp", "8.8.8.8:443", nil))
+
+	guard.DeniedPorts = []int{25}
+	assert.ErrorIs(t, guard.control("tcp", "8.8.8.8:25", nil), errs.ErrForbiddenURL)
+}
+
+func mustPort(t *testing.T, u *url.URL) int {
+	t.Helper()
+	port, err := urlPort(u, u.Scheme)
+	require.NoError(t, err)
+	return port
+}
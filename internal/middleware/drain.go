@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/supchaser/test_task/internal/utils/responses"
+)
+
+// DrainMiddleware answers 503 to requests that would start new work once
+// draining reports true. Reads such as task status and archive downloads
+// are still served until the server stops.
+func DrainMiddleware(draining func() bool, retryAfter time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if draining() && r.Method != http.MethodGet && r.Method != http.MethodHead {
+				w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+				w.Header().Set("Connection", "close")
+				responses.DoBadResponseAndLog(w, http.StatusServiceUnavailable, "server is shutting down")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -13,6 +13,7 @@ func LoggingMiddleware(next http.Handler) http.Handler {
 			zap.String("method", r.Method),
 			zap.String("path", r.URL.Path),
 			zap.String("remote_addr", r.RemoteAddr),
+			logger.RequestIDField(r.Context()),
 		)
 		next.ServeHTTP(w, r)
 	})
@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Local keeps archives as files under a root directory.
+type Local struct {
+	root string
+}
+
+// NewLocal returns a store rooted at root. The directory is created on the
+// first Put.
+func NewLocal(root string) *Local {
+	return &Local{root: root}
+}
+
+func (l *Local) path(key string) (string, error) {
+	if err := validateKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(l.root, filepath.FromSlash(key)), nil
+}
+
+// tempPattern names the files Put writes before renaming them into place.
+const tempPattern = ".put-*"
+
+// Put writes the archive next to its final name, syncs it and renames it
+// into place, so readers never see a partial file, not even after a crash.
+func (l *Local) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	target, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return fmt.Errorf("create storage directory: %w", err)
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(target), tempPattern)
+	if err != nil {
+		return fmt.Errorf("create temp file: %w", err)
+	}
+	defer os.Remove(file.Name())
+
+	written, err := io.Copy(file, r)
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("write archive: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("sync archive: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("close archive: %w", err)
+	}
+	if written != size {
+		return fmt.Errorf("write archive: got %d bytes, expected %d", written, size)
+	}
+
+	if err := os.Rename(file.Name(), target); err != nil {
+		return fmt.Errorf("move archive into place: %w", err)
+	}
+	if err := syncDir(filepath.Dir(target)); err != nil {
+		return fmt.Errorf("sync storage directory: %w", err)
+	}
+	return nil
+}
+
+// syncDir makes a rename in dir durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// Open returns the archive file; it implements io.ReadSeeker.
+func (l *Local) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	p, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open archive: %w", err)
+	}
+	return file, nil
+}
+
+func (l *Local) Stat(ctx context.Context, key string) (Info, error) {
+	p, err := l.path(key)
+	if err != nil {
+		return Info{}, err
+	}
+
+	info, err := os.Stat(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return Info{}, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	if err != nil {
+		return Info{}, fmt.Errorf("stat archive: %w", err)
+	}
+	return Info{Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+// Delete removes the archive; a missing archive is not an error.
+func (l *Local) Delete(ctx context.Context, key string) error {
+	p, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove archive: %w", err)
+	}
+	return nil
+}
+
+// RemoveTemp deletes the files left behind by a Put that never finished,
+// for example because the process crashed. It must not run concurrently
+// with Put and returns the number of files removed.
+func (l *Local) RemoveTemp() (int, error) {
+	removed := 0
+	err := filepath.WalkDir(l.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if ok, _ := filepath.Match(tempPattern, d.Name()); !ok {
+			return nil
+		}
+		if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		removed++
+		return nil
+	})
+	if err != nil {
+		return removed, fmt.Errorf("remove temp files: %w", err)
+	}
+	return removed, nil
+}
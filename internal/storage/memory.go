@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Memory keeps archives in memory. It is meant for tests.
+type Memory struct {
+	mu      sync.RWMutex
+	objects map[string]memoryObject
+}
+
+type memoryObject struct {
+	data    []byte
+	modTime time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{objects: make(map[string]memoryObject)}
+}
+
+func (m *Memory) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("read archive: %w", err)
+	}
+	if int64(len(data)) != size {
+		return fmt.Errorf("read archive: got %d bytes, expected %d", len(data), size)
+	}
+
+	m.mu.Lock()
+	m.objects[key] = memoryObject{data: data, modTime: time.Now()}
+	m.mu.Unlock()
+	return nil
+}
+
+// Open returns a reader that implements io.ReadSeeker.
+func (m *Memory) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	obj, err := m.get(key)
+	if err != nil {
+		return nil, err
+	}
+	return readSeekNopCloser{bytes.NewReader(obj.data)}, nil
+}
+
+func (m *Memory) Stat(ctx context.Context, key string) (Info, error) {
+	obj, err := m.get(key)
+	if err != nil {
+		return Info{}, err
+	}
+	return Info{Size: int64(len(obj.data)), ModTime: obj.modTime}, nil
+}
+
+func (m *Memory) Delete(ctx context.Context, key string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	delete(m.objects, key)
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *Memory) get(key string) (memoryObject, error) {
+	if err := validateKey(key); err != nil {
+		return memoryObject{}, err
+	}
+
+	m.mu.RLock()
+	obj, ok := m.objects[key]
+	m.mu.RUnlock()
+	if !ok {
+		return memoryObject{}, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return obj, nil
+}
+
+type readSeekNopCloser struct {
+	*bytes.Reader
+}
+
+func (readSeekNopCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,30 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotFound   = errors.New("archive not found in storage")
+	ErrInvalidKey = errors.New("invalid storage key")
+)
+
+// Info describes a stored archive.
+type Info struct {
+	Size    int64
+	ModTime time.Time
+}
+
+// validateKey accepts clean relative slash-separated keys, so that no
+// backend can be made to write outside of its root or bucket.
+func validateKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, `\`) ||
+		path.Clean(key) != key || key == ".." || strings.HasPrefix(key, "../") {
+		return fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	return nil
+}
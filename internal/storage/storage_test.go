@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type store interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Stat(ctx context.Context, key string) (Info, error)
+	Delete(ctx context.Context, key string) error
+}
+
+func TestStores(t *testing.T) {
+	stores := map[string]func(t *testing.T) store{
+		"Local":  func(t *testing.T) store { return NewLocal(t.TempDir() + "/archives") },
+		"Memory": func(t *testing.T) store { return NewMemory() },
+		"S3":     func(t *testing.T) store { return newTestS3(t) },
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			s := newStore(t)
+
+			_, err := s.Stat(ctx, "task_1.zip")
+			assert.ErrorIs(t, err, ErrNotFound)
+			_, err = s.Open(ctx, "task_1.zip")
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			content := "archive content"
+			require.NoError(t, s.Put(ctx, "task_1.zip", strings.NewReader(content), int64(len(content))))
+
+			info, err := s.Stat(ctx, "task_1.zip")
+			require.NoError(t, err)
+			assert.Equal(t, int64(len(content)), info.Size)
+			assert.False(t, info.ModTime.IsZero())
+
+			body, err := s.Open(ctx, "task_1.zip")
+			require.NoError(t, err)
+			data, err := io.ReadAll(body)
+			body.Close()
+			require.NoError(t, err)
+			assert.Equal(t, content, string(data))
+
+			// a short reader must not leave a truncated archive behind
+			err = s.Put(ctx, "task_2.zip", strings.NewReader("short"), 100)
+			assert.Error(t, err)
+			_, err = s.Stat(ctx, "task_2.zip")
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			require.NoError(t, s.Delete(ctx, "task_1.zip"))
+			_, err = s.Stat(ctx, "task_1.zip")
+			assert.ErrorIs(t, err, ErrNotFound)
+			assert.NoError(t, s.Delete(ctx, "task_1.zip"), "deleting a missing archive is not an error")
+
+			for _, key := range []string{"", "../escape.zip", "/abs.zip", "a/../b.zip", `dir\file.zip`} {
+				assert.ErrorIs(t, s.Put(ctx, key, strings.NewReader(""), 0), ErrInvalidKey, key)
+			}
+		})
+	}
+}
+
+func TestLocal_RemoveTemp(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "archives")
+	s := NewLocal(root)
+
+	removed, err := s.RemoveTemp()
+	require.NoError(t, err, "a missing root has nothing to clean")
+	assert.Zero(t, removed)
+
+	require.NoError(t, s.Put(context.Background(), "task_1.zip", strings.NewReader("done"), 4))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "nested"), 0o755))
+	for _, name := range []string{".put-123", "nested/.put-456"} {
+		require.NoError(t, os.WriteFile(filepath.Join(root, name), []byte("partial"), 0o644))
+	}
+
+	removed, err = s.RemoveTemp()
+	require.NoError(t, err)
+	assert.Equal(t, 2, removed)
+	assert.NoFileExists(t, filepath.Join(root, ".put-123"))
+	assert.NoFileExists(t, filepath.Join(root, "nested", ".put-456"))
+	assert.FileExists(t, filepath.Join(root, "task_1.zip"))
+}
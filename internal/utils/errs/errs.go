@@ -3,9 +3,25 @@ package errs
 import "errors"
 
 var (
-	ErrTaskNotFound      = errors.New("task not found")
-	ErrMaxTasksReached   = errors.New("server is busy (max tasks limit)")
-	ErrMaxObjectsReached = errors.New("maximum objects per task reached")
-	ErrInvalidFileType   = errors.New("invalid file type (allowed: .pdf, .jpeg)")
-	ErrFileUnavailable   = errors.New("file is unavailable")
+	ErrTaskNotFound       = errors.New("task not found")
+	ErrMaxTasksReached    = errors.New("server is busy (max tasks limit)")
+	ErrMaxObjectsReached  = errors.New("maximum objects per task reached")
+	ErrInvalidFileType    = errors.New("invalid file type")
+	ErrFileTooLarge       = errors.New("file is too large")
+	ErrArchiveTooLarge    = errors.New("archive size limit reached")
+	ErrFileUnavailable    = errors.New("file is unavailable")
+	ErrInvalidTaskStatus  = errors.New("operation is not allowed in current task status")
+	ErrNoObjects          = errors.New("task has no objects")
+	ErrObjectNotFound     = errors.New("object not found")
+	ErrForbiddenURL       = errors.New("url is not allowed")
+	ErrInvalidFormat      = errors.New("invalid archive format")
+	ErrEncryptionFormat   = errors.New("password protection requires zip format")
+	ErrInvalidCompression = errors.New("invalid compression")
+	ErrStreamFormat       = errors.New("streaming requires zip format")
+	ErrArchiveNotStored   = errors.New("archive was streamed and is not stored")
+	ErrArchiveNotReady    = errors.New("archive not ready")
+	ErrArchiveMissing     = errors.New("archive file missing")
+	ErrShuttingDown       = errors.New("server is shutting down")
+	ErrInvalidFilter      = errors.New("invalid purge filter")
+	ErrVersionNotFound    = errors.New("archive version not found")
 )
@@ -0,0 +1,26 @@
+package logger
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx that carries the request ID, so work
+// started on behalf of a request can be told apart in the logs.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID carried by ctx, or an empty string.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// RequestIDField is the log field for the request ID carried by ctx.
+func RequestIDField(ctx context.Context) zap.Field {
+	return zap.String("request_id", RequestID(ctx))
+}
@@ -2,6 +2,7 @@ package logger
 
 import (
 	"bytes"
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -129,3 +130,12 @@ func TestLoggerOutput(t *testing.T) {
 	assert.Contains(t, output, "test output message")
 	assert.Contains(t, output, "INFO")
 }
+
+func TestRequestID(t *testing.T) {
+	ctx := context.Background()
+	assert.Empty(t, RequestID(ctx))
+
+	ctx = WithRequestID(ctx, "abc123")
+	assert.Equal(t, "abc123", RequestID(ctx))
+	assert.Equal(t, zap.String("request_id", "abc123"), RequestIDField(ctx))
+}
@@ -94,12 +94,103 @@ func ResponseErrorAndLog(w http.ResponseWriter, err error, funcName string) {
 			zap.String("error", err.Error()),
 		)
 
+	case errors.Is(err, errs.ErrForbiddenURL):
+		DoBadResponseAndLog(w, http.StatusForbidden, "url is not allowed")
+		logger.Warn(funcName,
+			zap.String("error", err.Error()),
+		)
+
+	case errors.Is(err, errs.ErrFileTooLarge):
+		DoBadResponseAndLog(w, http.StatusRequestEntityTooLarge, "file is too large")
+		logger.Warn(funcName,
+			zap.String("error", err.Error()),
+		)
+
+	case errors.Is(err, errs.ErrArchiveTooLarge):
+		DoBadResponseAndLog(w, http.StatusRequestEntityTooLarge, "archive size limit reached")
+		logger.Warn(funcName,
+			zap.String("error", err.Error()),
+		)
+
 	case errors.Is(err, errs.ErrFileUnavailable):
 		DoBadResponseAndLog(w, http.StatusBadRequest, "file is unavailable")
 		logger.Warn(funcName,
 			zap.String("error", err.Error()),
 		)
 
+	case errors.Is(err, errs.ErrInvalidTaskStatus):
+		DoBadResponseAndLog(w, http.StatusConflict, "operation is not allowed in current task status")
+		logger.Warn(funcName,
+			zap.String("error", err.Error()),
+		)
+
+	case errors.Is(err, errs.ErrInvalidFormat):
+		DoBadResponseAndLog(w, http.StatusBadRequest, "invalid archive format")
+		logger.Warn(funcName,
+			zap.String("error", err.Error()),
+		)
+
+	case errors.Is(err, errs.ErrEncryptionFormat):
+		DoBadResponseAndLog(w, http.StatusBadRequest, "password protection requires zip format")
+		logger.Warn(funcName,
+			zap.String("error", err.Error()),
+		)
+
+	case errors.Is(err, errs.ErrInvalidCompression):
+		DoBadResponseAndLog(w, http.StatusBadRequest, "invalid compression")
+		logger.Warn(funcName,
+			zap.String("error", err.Error()),
+		)
+
+	case errors.Is(err, errs.ErrStreamFormat):
+		DoBadResponseAndLog(w, http.StatusBadRequest, "streaming requires zip format")
+		logger.Warn(funcName,
+			zap.String("error", err.Error()),
+		)
+
+	case errors.Is(err, errs.ErrArchiveNotStored):
+		DoBadResponseAndLog(w, http.StatusGone, "archive was streamed and is not stored")
+		logger.Warn(funcName,
+			zap.String("error", err.Error()),
+		)
+
+	case errors.Is(err, errs.ErrArchiveNotReady):
+		DoBadResponseAndLog(w, http.StatusNotFound, "archive not ready")
+		logger.Warn(funcName,
+			zap.String("error", err.Error()),
+		)
+
+	case errors.Is(err, errs.ErrArchiveMissing):
+		DoBadResponseAndLog(w, http.StatusInternalServerError, "archive file missing")
+		logger.Error(funcName,
+			zap.String("error", err.Error()),
+		)
+
+	case errors.Is(err, errs.ErrVersionNotFound):
+		DoBadResponseAndLog(w, http.StatusNotFound, "archive version not found")
+		logger.Warn(funcName,
+			zap.String("error", err.Error()),
+		)
+
+	case errors.Is(err, errs.ErrInvalidFilter):
+		DoBadResponseAndLog(w, http.StatusBadRequest, "invalid purge filter")
+		logger.Warn(funcName,
+			zap.String("error", err.Error()),
+		)
+
+	case errors.Is(err, errs.ErrShuttingDown):
+		w.Header().Set("Connection", "close")
+		DoBadResponseAndLog(w, http.StatusServiceUnavailable, "server is shutting down")
+		logger.Warn(funcName,
+			zap.String("error", err.Error()),
+		)
+
+	case errors.Is(err, errs.ErrNoObjects):
+		DoBadResponseAndLog(w, http.StatusBadRequest, "task has no objects")
+		logger.Warn(funcName,
+			zap.String("error", err.Error()),
+		)
+
 	default:
 		DoBadResponseAndLog(w, http.StatusInternalServerError, "internal error")
 		logger.Error(funcName,
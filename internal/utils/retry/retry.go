@@ -0,0 +1,172 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/supchaser/test_task/internal/utils/errs"
+)
+
+type Policy struct {
+	// MaxAttempts is the total number of attempts, including the first one.
+	MaxAttempts int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// Jitter spreads every delay randomly by up to this fraction in both directions.
+	Jitter float64
+}
+
+func DefaultPolicy() Policy {
+	return Policy{
+		MaxAttempts: 3,
+		BaseBackoff: 500 * time.Millisecond,
+		MaxBackoff:  10 * time.Second,
+		Jitter:      0.2,
+	}
+}
+
+// Error marks a failed attempt as worth retrying. RetryAfter is the delay
+// requested by the server, zero if it did not ask for one.
+type Error struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Retryable wraps err so that Do tries again.
+func Retryable(err error, retryAfter time.Duration) error {
+	return &Error{Err: err, RetryAfter: retryAfter}
+}
+
+// Do calls fn until it succeeds, returns an error not wrapped with Retryable,
+// runs out of attempts or ctx is done. The last error is returned unwrapped.
+func (p Policy) Do(ctx context.Context, fn func(attempt int) error) error {
+	maxAttempts := max(p.MaxAttempts, 1)
+
+	for attempt := 1; ; attempt++ {
+		err := fn(attempt)
+		if err == nil {
+			return nil
+		}
+
+		var retryErr *Error
+		if !errors.As(err, &retryErr) {
+			return err
+		}
+		if attempt >= maxAttempts {
+			return retryErr.Err
+		}
+
+		delay := p.Backoff(attempt)
+		if retryErr.RetryAfter > delay {
+			if p.MaxBackoff > 0 && retryErr.RetryAfter > p.MaxBackoff {
+				return fmt.Errorf("%w (server asked to retry in %s)", retryErr.Err, retryErr.RetryAfter)
+			}
+			delay = retryErr.RetryAfter
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Join(retryErr.Err, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// Backoff returns the delay after the given failed attempt: exponential
+// growth from BaseBackoff, capped by MaxBackoff, with jitter applied.
+func (p Policy) Backoff(attempt int) time.Duration {
+	delay := p.BaseBackoff
+	for i := 1; i < attempt && (p.MaxBackoff <= 0 || delay < p.MaxBackoff); i++ {
+		delay *= 2
+	}
+	if p.MaxBackoff > 0 && delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+
+	if p.Jitter > 0 {
+		spread := (rand.Float64()*2 - 1) * p.Jitter
+		delay = time.Duration(float64(delay) * (1 + spread))
+	}
+
+	return delay
+}
+
+// IsRetryableStatus reports whether the origin answered with a status that
+// usually goes away on its own.
+func IsRetryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// IsRetryableError reports whether a transport error is worth another
+// attempt. Only failures that usually go away on their own are: timeouts,
+// reset or refused connections and a body cut off midway. Anything else,
+// such as a certificate that does not verify, a malformed URL or too many
+// redirects, fails the same way every time. A finished caller context is
+// never retried.
+func IsRetryableError(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || err == nil {
+		return false
+	}
+
+	if errors.Is(err, errs.ErrForbiddenURL) {
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF)
+}
+
+// ParseRetryAfter understands both forms of the Retry-After header:
+// delay in seconds and HTTP date.
+func ParseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+
+	if at, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(at); wait > 0 {
+			return wait
+		}
+	}
+
+	return 0
+}
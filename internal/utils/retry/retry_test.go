@@ -0,0 +1,226 @@
+package retry
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fastPolicy(attempts int) Policy {
+	return Policy{
+		MaxAttempts: attempts,
+		BaseBackoff: time.Millisecond,
+		MaxBackoff:  10 * time.Millisecond,
+	}
+}
+
+func TestPolicy_Do(t *testing.T) {
+	errTransient := errors.New("transient")
+	errPermanent := errors.New("permanent")
+
+	tests := []struct {
+		name          string
+		policy        Policy
+		results       []error
+		expectedCalls int
+		expectedError error
+	}{
+		{
+			name:          "successFirstTry",
+			policy:        fastPolicy(3),
+			results:       []error{nil},
+			expectedCalls: 1,
+			expectedError: nil,
+		},
+		{
+			name:          "successAfterRetries",
+			policy:        fastPolicy(3),
+			results:       []error{Retryable(errTransient, 0), Retryable(errTransient, 0), nil},
+			expectedCalls: 3,
+			expectedError: nil,
+		},
+		{
+			name:          "permanentErrorStops",
+			policy:        fastPolicy(3),
+			results:       []error{errPermanent},
+			expectedCalls: 1,
+			expectedError: errPermanent,
+		},
+		{
+			name:          "attemptsExhausted",
+			policy:        fastPolicy(2),
+			results:       []error{Retryable(errTransient, 0), Retryable(errTransient, 0)},
+			expectedCalls: 2,
+			expectedError: errTransient,
+		},
+		{
+			name:          "zeroAttemptsMeansOne",
+			policy:        fastPolicy(0),
+			results:       []error{Retryable(errTransient, 0)},
+			expectedCalls: 1,
+			expectedError: errTransient,
+		},
+		{
+			name:          "retryAfterAboveMaxBackoff",
+			policy:        fastPolicy(3),
+			results:       []error{Retryable(errTransient, time.Hour)},
+			expectedCalls: 1,
+			expectedError: errTransient,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := tt.policy.Do(context.Background(), func(attempt int) error {
+				calls++
+				assert.Equal(t, calls, attempt)
+				return tt.results[attempt-1]
+			})
+
+			assert.Equal(t, tt.expectedCalls, calls)
+			if tt.expectedError == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.expectedError)
+				var retryErr *Error
+				assert.False(t, errors.As(err, &retryErr))
+			}
+		})
+	}
+}
+
+func TestPolicy_Do_RespectsRetryAfter(t *testing.T) {
+	policy := fastPolicy(2)
+	policy.MaxBackoff = time.Second
+
+	started := time.Now()
+	err := policy.Do(context.Background(), func(attempt int) error {
+		if attempt == 1 {
+			return Retryable(errors.New("busy"), 50*time.Millisecond)
+		}
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(started), 50*time.Millisecond)
+}
+
+func TestPolicy_Do_ContextCancelled(t *testing.T) {
+	policy := Policy{MaxAttempts: 5, BaseBackoff: time.Hour}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	calls := 0
+	err := policy.Do(ctx, func(attempt int) error {
+		calls++
+		return Retryable(errors.New("transient"), 0)
+	})
+
+	assert.Equal(t, 1, calls)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestPolicy_Backoff(t *testing.T) {
+	policy := Policy{BaseBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+
+	assert.Equal(t, 100*time.Millisecond, policy.Backoff(1))
+	assert.Equal(t, 200*time.Millisecond, policy.Backoff(2))
+	assert.Equal(t, 400*time.Millisecond, policy.Backoff(3))
+	assert.Equal(t, time.Second, policy.Backoff(10))
+	assert.Equal(t, time.Second, policy.Backoff(100))
+
+	policy.Jitter = 0.5
+	for range 100 {
+		delay := policy.Backoff(1)
+		assert.GreaterOrEqual(t, delay, 50*time.Millisecond)
+		assert.LessOrEqual(t, delay, 150*time.Millisecond)
+	}
+}
+
+func TestIsRetryableStatus(t *testing.T) {
+	assert.True(t, IsRetryableStatus(http.StatusTooManyRequests))
+	assert.True(t, IsRetryableStatus(http.StatusBadGateway))
+	assert.True(t, IsRetryableStatus(http.StatusServiceUnavailable))
+	assert.True(t, IsRetryableStatus(http.StatusGatewayTimeout))
+	assert.False(t, IsRetryableStatus(http.StatusOK))
+	assert.False(t, IsRetryableStatus(http.StatusNotFound))
+	assert.False(t, IsRetryableStatus(http.StatusInternalServerError))
+}
+
+func TestIsRetryableError(t *testing.T) {
+	reset := &url.Error{Op: "Get", URL: "http://host/a.pdf", Err: &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}}
+	refused := &url.Error{Op: "Get", URL: "http://host/a.pdf", Err: &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}}
+	timeout := &url.Error{Op: "Get", URL: "http://host/a.pdf", Err: os.ErrDeadlineExceeded}
+
+	assert.True(t, IsRetryableError(context.Background(), reset))
+	assert.True(t, IsRetryableError(context.Background(), refused))
+	assert.True(t, IsRetryableError(context.Background(), timeout))
+	assert.True(t, IsRetryableError(context.Background(), &url.Error{Op: "Get", URL: "http://host/a.pdf", Err: io.EOF}))
+	assert.True(t, IsRetryableError(context.Background(), fmt.Errorf("save response body: %w", io.ErrUnexpectedEOF)))
+
+	assert.False(t, IsRetryableError(context.Background(), &net.DNSError{Err: "no such host", IsNotFound: true}))
+	assert.False(t, IsRetryableError(context.Background(), errors.New("unsupported protocol scheme \"ftp\"")))
+	assert.False(t, IsRetryableError(context.Background(), &url.Error{Op: "Get", URL: "http://host/a.pdf", Err: errors.New("stopped after 5 redirects")}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.False(t, IsRetryableError(ctx, reset))
+}
+
+func TestIsRetryableError_CertificateNotRetried(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	// the default client does not trust the test certificate
+	_, err := http.Get(server.URL)
+	require.Error(t, err)
+	var certErr *tls.CertificateVerificationError
+	require.ErrorAs(t, err, &certErr)
+	assert.False(t, IsRetryableError(context.Background(), err))
+
+	attempts := 0
+	err = DefaultPolicy().Do(context.Background(), func(int) error {
+		attempts++
+		resp, err := http.Get(server.URL)
+		if err != nil {
+			if IsRetryableError(context.Background(), err) {
+				return Retryable(err, 0)
+			}
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 1, attempts)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	assert.Equal(t, time.Duration(0), ParseRetryAfter(""))
+	assert.Equal(t, 120*time.Second, ParseRetryAfter("120"))
+	assert.Equal(t, time.Duration(0), ParseRetryAfter("-5"))
+	assert.Equal(t, time.Duration(0), ParseRetryAfter("soon"))
+
+	at := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	wait := ParseRetryAfter(at)
+	assert.Greater(t, wait, 50*time.Second)
+	assert.LessOrEqual(t, wait, time.Minute)
+
+	past := time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat)
+	assert.Equal(t, time.Duration(0), ParseRetryAfter(past))
+}
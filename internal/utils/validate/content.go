@@ -0,0 +1,157 @@
+package validate
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/supchaser/test_task/internal/utils/errs"
+)
+
+var magicNumbers = []struct {
+	mimeType string
+	prefix   []byte
+}{
+	{mimeType: "application/pdf", prefix: []byte("%PDF-")},
+	{mimeType: "image/jpeg", prefix: []byte{0xFF, 0xD8, 0xFF}},
+}
+
+// genericTypes say nothing about the actual content, so the decision is
+// left to the file name and the magic bytes.
+var genericTypes = map[string]bool{
+	"":                           true,
+	"application/octet-stream":   true,
+	"binary/octet-stream":        true,
+	"application/download":       true,
+	"application/force-download": true,
+}
+
+// typeAliases maps non-standard MIME types seen in the wild to canonical ones.
+var typeAliases = map[string]string{
+	"image/jpg":         "image/jpeg",
+	"image/pjpeg":       "image/jpeg",
+	"application/x-pdf": "application/pdf",
+}
+
+// NormalizeType strips parameters and lowercases a MIME type.
+func NormalizeType(value string) string {
+	mediaType, _, err := mime.ParseMediaType(value)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(value))
+	}
+	if alias, ok := typeAliases[mediaType]; ok {
+		return alias
+	}
+	return mediaType
+}
+
+// DeclaredType returns the type the origin claims for the file: the
+// Content-Type header unless it is generic, then the extension of the
+// Content-Disposition filename, then the extension of the URL path.
+// It returns an empty string when none of them tells anything.
+//
+// The URL path is only matched against the policy's own extensions:
+// links like get.php?id=5 or view.aspx often serve the file itself, and a
+// guess of text/html from them must not reject it before the content is
+// sniffed.
+func (p Policy) DeclaredType(header http.Header, rawURL string) string {
+	if contentType := NormalizeType(header.Get("Content-Type")); !genericTypes[contentType] {
+		return contentType
+	}
+
+	if name := DispositionFilename(header.Get("Content-Disposition")); name != "" {
+		if t := p.TypeByExtension(path.Ext(name)); t != "" {
+			return t
+		}
+	}
+
+	if u, err := url.Parse(rawURL); err == nil {
+		return p.policyTypeByExtension(path.Ext(u.Path))
+	}
+
+	return ""
+}
+
+// DispositionFilename extracts the file name from a Content-Disposition header.
+func DispositionFilename(value string) string {
+	if value == "" {
+		return ""
+	}
+	_, params, err := mime.ParseMediaType(value)
+	if err != nil {
+		return ""
+	}
+	return params["filename"]
+}
+
+// DetectType recognizes the content by its first bytes.
+func DetectType(head []byte) string {
+	for _, magic := range magicNumbers {
+		if bytes.HasPrefix(head, magic.prefix) {
+			return magic.mimeType
+		}
+	}
+	return NormalizeType(http.DetectContentType(head))
+}
+
+// ValidateDeclaredType rejects a file whose declared type is known and not
+// allowed. An unknown type passes; the content is checked while downloading.
+func (p Policy) ValidateDeclaredType(declared string) error {
+	if declared == "" || p.Allows(declared) {
+		return nil
+	}
+	return p.InvalidTypeError("declared " + declared)
+}
+
+// ValidateContent checks the first bytes of the body against the policy and
+// the declared type. It returns the type the file is accepted as.
+func (p Policy) ValidateContent(declared string, head []byte) (string, error) {
+	detected := DetectType(head)
+
+	if declared != "" && declared != detected {
+		// containers and plain text cannot be told apart by magic bytes,
+		// so the declared type is trusted if the content is of its family
+		if p.Allows(declared) && sameFamily(declared, detected) {
+			return declared, nil
+		}
+		if p.Allows(detected) {
+			return detected, p.InvalidTypeError(fmt.Sprintf("declared %s, detected %s", declared, detected))
+		}
+	}
+
+	if !p.Allows(detected) {
+		return detected, p.InvalidTypeError("detected " + detected)
+	}
+
+	return detected, nil
+}
+
+// ValidateSize rejects files larger than the limit of their type.
+func (p Policy) ValidateSize(mimeType string, size int64) error {
+	if limit := p.MaxSize(mimeType); limit > 0 && size > limit {
+		return fmt.Errorf("%w: %s is limited to %d bytes", errs.ErrFileTooLarge, mimeType, limit)
+	}
+	return nil
+}
+
+// sameFamily reports whether detected is what sniffing yields for files of
+// the declared type: zip for office documents, plain text for text formats.
+func sameFamily(declared, detected string) bool {
+	switch detected {
+	case "application/zip":
+		return strings.HasSuffix(declared, "+zip") ||
+			strings.HasPrefix(declared, "application/vnd.openxmlformats-officedocument.") ||
+			strings.HasPrefix(declared, "application/vnd.oasis.opendocument.") ||
+			declared == "application/epub+zip" ||
+			declared == "application/java-archive"
+	case "text/plain":
+		return strings.HasPrefix(declared, "text/") ||
+			declared == "application/json" ||
+			declared == "application/xml"
+	}
+	return false
+}
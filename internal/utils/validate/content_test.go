@@ -0,0 +1,103 @@
+package validate
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/supchaser/test_task/internal/utils/errs"
+)
+
+func TestDeclaredType(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		disposition string
+		url         string
+		expected    string
+	}{
+		{name: "contentType", contentType: "application/pdf", url: "https://host/file", expected: "application/pdf"},
+		{name: "contentTypeWithParams", contentType: "text/html; charset=utf-8", url: "https://host/a.pdf", expected: "text/html"},
+		{name: "jpgAlias", contentType: "image/jpg", url: "https://host/a", expected: "image/jpeg"},
+		{name: "genericUsesDisposition", contentType: "application/octet-stream", disposition: `attachment; filename="a.PDF"`, url: "https://host/download?id=5", expected: "application/pdf"},
+		{name: "genericUsesURL", contentType: "application/octet-stream", url: "https://host/photo.jpg?size=big", expected: "image/jpeg"},
+		{name: "nothingKnown", url: "https://host/download?id=5", expected: ""},
+		{name: "scriptURLTellsNothing", contentType: "application/octet-stream", url: "https://host/get.php?id=5", expected: ""},
+		{name: "pageURLTellsNothing", contentType: "application/octet-stream", url: "https://host/view.aspx", expected: ""},
+		{name: "htmlURLTellsNothing", url: "https://host/report.html", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.contentType != "" {
+				header.Set("Content-Type", tt.contentType)
+			}
+			if tt.disposition != "" {
+				header.Set("Content-Disposition", tt.disposition)
+			}
+			assert.Equal(t, tt.expected, DefaultPolicy().DeclaredType(header, tt.url))
+		})
+	}
+}
+
+func TestValidateDeclaredType(t *testing.T) {
+	policy := DefaultPolicy()
+	assert.NoError(t, policy.ValidateDeclaredType(""))
+	assert.NoError(t, policy.ValidateDeclaredType("application/pdf"))
+	assert.ErrorIs(t, policy.ValidateDeclaredType("text/html"), errs.ErrInvalidFileType)
+
+	png := Policy{Types: []FileType{{MIMEType: "image/png", Extensions: []string{".png"}}}}
+	assert.NoError(t, png.ValidateDeclaredType("image/png"))
+	assert.ErrorIs(t, png.ValidateDeclaredType("application/pdf"), errs.ErrInvalidFileType)
+}
+
+func TestValidateContent(t *testing.T) {
+	tests := []struct {
+		name          string
+		declared      string
+		head          []byte
+		expectedType  string
+		expectedError error
+	}{
+		{name: "pdf", declared: "application/pdf", head: []byte("%PDF-1.4"), expectedType: "application/pdf"},
+		{name: "jpeg", head: []byte{0xFF, 0xD8, 0xFF, 0xE0}, expectedType: "image/jpeg"},
+		{name: "html", head: []byte("<!DOCTYPE html><html>"), expectedType: "text/html", expectedError: errs.ErrInvalidFileType},
+		{name: "mismatch", declared: "image/jpeg", head: []byte("%PDF-1.4"), expectedType: "application/pdf", expectedError: errs.ErrInvalidFileType},
+		{name: "empty", head: nil, expectedType: "text/plain", expectedError: errs.ErrInvalidFileType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			detected, err := DefaultPolicy().ValidateContent(tt.declared, tt.head)
+			assert.Equal(t, tt.expectedType, detected)
+			assert.ErrorIs(t, err, tt.expectedError)
+		})
+	}
+}
+
+func TestValidateContent_SameFamily(t *testing.T) {
+	policy, err := ParsePolicy("application/vnd.openxmlformats-officedocument.wordprocessingml.document:.docx;text/csv:.csv")
+	assert.NoError(t, err)
+
+	docx := "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	detected, err := policy.ValidateContent(docx, []byte("PK\x03\x04rest"))
+	assert.NoError(t, err)
+	assert.Equal(t, docx, detected)
+
+	detected, err = policy.ValidateContent("text/csv", []byte("a,b,c\n1,2,3\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, "text/csv", detected)
+
+	// a bare zip without a declared document type is not accepted
+	_, err = policy.ValidateContent("", []byte("PK\x03\x04rest"))
+	assert.ErrorIs(t, err, errs.ErrInvalidFileType)
+}
+
+func TestValidateSize(t *testing.T) {
+	policy := Policy{Types: []FileType{{MIMEType: "application/pdf", MaxSize: 10}}}
+
+	assert.NoError(t, policy.ValidateSize("application/pdf", 10))
+	assert.ErrorIs(t, policy.ValidateSize("application/pdf", 11), errs.ErrFileTooLarge)
+	assert.NoError(t, policy.ValidateSize("image/jpeg", 1000))
+}
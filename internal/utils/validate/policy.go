@@ -0,0 +1,178 @@
+package validate
+
+import (
+	"fmt"
+	"mime"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/supchaser/test_task/internal/utils/errs"
+)
+
+// FileType is one accepted kind of file.
+type FileType struct {
+	MIMEType   string   `json:"mime_type"`
+	Extensions []string `json:"extensions"`
+	// MaxSize is the largest accepted file of this type in bytes; 0 means no limit.
+	MaxSize int64 `json:"max_size,omitempty"`
+}
+
+// Policy lists the file types objects may have.
+type Policy struct {
+	Types []FileType `json:"types"`
+}
+
+func DefaultPolicy() Policy {
+	return Policy{
+		Types: []FileType{
+			{MIMEType: "application/pdf", Extensions: []string{".pdf"}},
+			{MIMEType: "image/jpeg", Extensions: []string{".jpeg", ".jpg"}},
+		},
+	}
+}
+
+// ParsePolicy reads a policy from its config form: types separated by ";",
+// each as "mime/type:.ext1,.ext2[:max size]", for example
+// "application/pdf:.pdf:20MB;image/png:.png". Sizes accept B, KB, MB and GB.
+func ParsePolicy(spec string) (Policy, error) {
+	policy := Policy{Types: make([]FileType, 0)}
+
+	for _, item := range strings.Split(spec, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		parts := strings.Split(item, ":")
+		if len(parts) < 2 || len(parts) > 3 {
+			return Policy{}, fmt.Errorf("file type %q: expected mime:extensions[:max size]", item)
+		}
+
+		fileType := FileType{MIMEType: NormalizeType(parts[0])}
+		if fileType.MIMEType == "" || !strings.Contains(fileType.MIMEType, "/") {
+			return Policy{}, fmt.Errorf("file type %q: invalid mime type", item)
+		}
+
+		for _, ext := range strings.Split(parts[1], ",") {
+			ext = strings.ToLower(strings.TrimSpace(ext))
+			if ext == "" {
+				continue
+			}
+			if !strings.HasPrefix(ext, ".") {
+				ext = "." + ext
+			}
+			fileType.Extensions = append(fileType.Extensions, ext)
+		}
+
+		if len(parts) == 3 {
+			size, err := ParseSize(parts[2])
+			if err != nil {
+				return Policy{}, fmt.Errorf("file type %q: %w", item, err)
+			}
+			fileType.MaxSize = size
+		}
+
+		policy.Types = append(policy.Types, fileType)
+	}
+
+	if len(policy.Types) == 0 {
+		return Policy{}, fmt.Errorf("no file types in %q", spec)
+	}
+
+	return policy, nil
+}
+
+// ParseSize parses sizes like "512", "100KB" or "1.5GB" into bytes.
+func ParseSize(value string) (int64, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		bytes  int64
+	}{
+		{suffix: "GB", bytes: 1 << 30},
+		{suffix: "MB", bytes: 1 << 20},
+		{suffix: "KB", bytes: 1 << 10},
+		{suffix: "B", bytes: 1},
+	} {
+		if number, ok := strings.CutSuffix(value, unit.suffix); ok {
+			value = strings.TrimSpace(number)
+			multiplier = unit.bytes
+			break
+		}
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+
+	return int64(number * float64(multiplier)), nil
+}
+
+// Lookup returns the policy entry for a MIME type.
+func (p Policy) Lookup(mimeType string) (FileType, bool) {
+	for _, fileType := range p.Types {
+		if fileType.MIMEType == mimeType {
+			return fileType, true
+		}
+	}
+	return FileType{}, false
+}
+
+// Allows reports whether files of the MIME type are accepted.
+func (p Policy) Allows(mimeType string) bool {
+	_, ok := p.Lookup(mimeType)
+	return ok
+}
+
+// MaxSize returns the size limit for the MIME type, 0 if there is none.
+func (p Policy) MaxSize(mimeType string) int64 {
+	fileType, _ := p.Lookup(mimeType)
+	return fileType.MaxSize
+}
+
+// TypeByExtension maps a file extension to a MIME type, preferring the
+// extensions configured in the policy over the system table.
+func (p Policy) TypeByExtension(ext string) string {
+	if t := p.policyTypeByExtension(ext); t != "" {
+		return t
+	}
+	return NormalizeType(mime.TypeByExtension(ext))
+}
+
+// policyTypeByExtension maps an extension only through the policy, so an
+// extension the policy does not list tells nothing.
+func (p Policy) policyTypeByExtension(ext string) string {
+	if ext == "" {
+		return ""
+	}
+	ext = strings.ToLower(ext)
+
+	for _, fileType := range p.Types {
+		if slices.Contains(fileType.Extensions, ext) {
+			return fileType.MIMEType
+		}
+	}
+	return ""
+}
+
+// InvalidTypeError builds the invalid file type error listing what the
+// policy accepts.
+func (p Policy) InvalidTypeError(detail string) error {
+	return fmt.Errorf("%w (allowed: %s): %s", errs.ErrInvalidFileType, p.describe(), detail)
+}
+
+func (p Policy) describe() string {
+	names := make([]string, 0, len(p.Types))
+	for _, fileType := range p.Types {
+		if len(fileType.Extensions) > 0 {
+			names = append(names, strings.Join(fileType.Extensions, ", "))
+		} else {
+			names = append(names, fileType.MIMEType)
+		}
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,86 @@
+package validate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/supchaser/test_task/internal/utils/errs"
+)
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		name      string
+		spec      string
+		expected  Policy
+		wantError bool
+	}{
+		{
+			name: "default",
+			spec: "application/pdf:.pdf;image/jpeg:.jpeg,.jpg",
+			expected: Policy{Types: []FileType{
+				{MIMEType: "application/pdf", Extensions: []string{".pdf"}},
+				{MIMEType: "image/jpeg", Extensions: []string{".jpeg", ".jpg"}},
+			}},
+		},
+		{
+			name: "withSizes",
+			spec: " image/png : png : 5MB ; text/csv:.CSV:512",
+			expected: Policy{Types: []FileType{
+				{MIMEType: "image/png", Extensions: []string{".png"}, MaxSize: 5 << 20},
+				{MIMEType: "text/csv", Extensions: []string{".csv"}, MaxSize: 512},
+			}},
+		},
+		{name: "empty", spec: "", wantError: true},
+		{name: "noExtensions", spec: "application/pdf", wantError: true},
+		{name: "badMime", spec: "pdf:.pdf", wantError: true},
+		{name: "badSize", spec: "application/pdf:.pdf:lots", wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := ParsePolicy(tt.spec)
+			if tt.wantError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, policy)
+		})
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := map[string]int64{
+		"100":   100,
+		"1KB":   1024,
+		"1.5MB": 3 << 19,
+		"2gb":   2 << 30,
+		"10 B":  10,
+	}
+	for value, expected := range tests {
+		size, err := ParseSize(value)
+		assert.NoError(t, err, value)
+		assert.Equal(t, expected, size, value)
+	}
+
+	_, err := ParseSize("-1")
+	assert.Error(t, err)
+}
+
+func TestPolicy_TypeByExtension(t *testing.T) {
+	policy := Policy{Types: []FileType{{MIMEType: "application/x-custom", Extensions: []string{".pdf"}}}}
+
+	assert.Equal(t, "application/x-custom", policy.TypeByExtension(".PDF"))
+	assert.Equal(t, "image/png", policy.TypeByExtension(".png"))
+	assert.Equal(t, "", policy.TypeByExtension(""))
+}
+
+func TestPolicy_InvalidTypeError(t *testing.T) {
+	policy, err := ParsePolicy("application/pdf:.pdf;image/png:.png;text/csv:.csv")
+	assert.NoError(t, err)
+
+	err = policy.InvalidTypeError("detected text/html")
+
+	assert.ErrorIs(t, err, errs.ErrInvalidFileType)
+	assert.Equal(t, "invalid file type (allowed: .pdf, .png, .csv): detected text/html", err.Error())
+}
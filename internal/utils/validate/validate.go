@@ -1,35 +1,43 @@
 package validate
 
 import (
-	"path/filepath"
-	"strings"
+	"fmt"
 
 	"github.com/supchaser/test_task/internal/utils/errs"
 )
 
 const (
-	maxObjectsPerTask = 3
+	DefaultMaxObjectsPerTask = 3
 )
 
-var allowedExtensions = map[string]bool{
-	".pdf":  true,
-	".jpeg": true,
-	".jpg":  true,
-}
+// ValidateObjectLimit checks whether one more object fits into a task.
+// A non-positive maxObjects falls back to DefaultMaxObjectsPerTask.
+func ValidateObjectLimit(currentObjects, maxObjects int) error {
+	if maxObjects <= 0 {
+		maxObjects = DefaultMaxObjectsPerTask
+	}
 
-func ValidateObjectLimit(currentObjects int) error {
-	if currentObjects >= maxObjectsPerTask {
+	if currentObjects >= maxObjects {
 		return errs.ErrMaxObjectsReached
 	}
 
 	return nil
 }
 
-func ValidateFileExtension(url string) error {
-	ext := strings.ToLower(filepath.Ext(url))
-	if _, ok := allowedExtensions[ext]; !ok {
-		return errs.ErrInvalidFileType
+// ValidateObjectSize checks a single object against the per-object limit.
+// A non-positive maxSize disables the check.
+func ValidateObjectSize(size, maxSize int64) error {
+	if maxSize > 0 && size > maxSize {
+		return fmt.Errorf("%w: object is limited to %d bytes", errs.ErrFileTooLarge, maxSize)
 	}
+	return nil
+}
 
+// ValidateArchiveSize checks the total size of the archive contents against
+// the per-archive limit. A non-positive maxSize disables the check.
+func ValidateArchiveSize(size, maxSize int64) error {
+	if maxSize > 0 && size > maxSize {
+		return fmt.Errorf("%w: archive is limited to %d bytes", errs.ErrArchiveTooLarge, maxSize)
+	}
 	return nil
 }